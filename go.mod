@@ -4,14 +4,14 @@ go 1.23.3
 
 require (
 	github.com/disgoorg/disgo v0.18.13
+	github.com/disgoorg/json v1.2.0
 	github.com/disgoorg/snowflake/v2 v2.0.3
+	github.com/gorilla/websocket v1.5.3
 	github.com/huandu/go-sqlbuilder v1.32.0
 	github.com/mattn/go-sqlite3 v1.14.24
 )
 
 require (
-	github.com/disgoorg/json v1.2.0 // indirect
-	github.com/gorilla/websocket v1.5.3 // indirect
 	github.com/huandu/xstrings v1.4.0 // indirect
 	github.com/sasha-s/go-csync v0.0.0-20240107134140-fcbab37b09ad // indirect
 	golang.org/x/crypto v0.27.0 // indirect
@@ -0,0 +1,158 @@
+package cache
+
+import (
+	"container/list"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrFull is returned by TryAdd when no key can be added without evicting another.
+var ErrFull = errors.New("cache: full")
+
+type Stats struct {
+	Hits        uint64
+	Misses      uint64
+	Evictions   uint64
+	Expirations uint64
+}
+
+type entry[K comparable] struct {
+	key       K
+	expiresAt time.Time
+}
+
+// TTL is a bounded set of keys that expire after a fixed duration.
+// When full, the key closest to expiring is evicted first.
+type TTL[K comparable] struct {
+	capacity int
+	ttl      time.Duration
+
+	mu      sync.Mutex
+	entries map[K]*list.Element
+	order   *list.List
+	stats   Stats
+}
+
+func NewTTL[K comparable](capacity int, ttl time.Duration) *TTL[K] {
+	return &TTL[K]{
+		capacity: capacity,
+		ttl:      ttl,
+		entries:  map[K]*list.Element{},
+		order:    list.New(),
+	}
+}
+
+func (c *TTL[K]) Add(key K) {
+	now := time.Now()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.removeExpired(now)
+
+	if el, ok := c.entries[key]; ok {
+		el.Value.(*entry[K]).expiresAt = now.Add(c.ttl)
+		c.order.MoveToBack(el)
+		return
+	}
+
+	c.entries[key] = c.order.PushBack(&entry[K]{key: key, expiresAt: now.Add(c.ttl)})
+
+	for c.order.Len() > c.capacity {
+		c.remove(c.order.Front())
+		c.stats.Evictions++
+	}
+}
+
+// TryAdd adds key unless it is present, reporting whether it was added. Unlike Add,
+// it never evicts keys before they expire and returns ErrFull instead.
+func (c *TTL[K]) TryAdd(key K) (bool, error) {
+	now := time.Now()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.removeExpired(now)
+
+	_, ok := c.entries[key]
+	c.count(ok)
+	if ok {
+		return false, nil
+	}
+	if c.order.Len() >= c.capacity {
+		return false, ErrFull
+	}
+
+	c.entries[key] = c.order.PushBack(&entry[K]{key: key, expiresAt: now.Add(c.ttl)})
+	return true, nil
+}
+
+func (c *TTL[K]) Contains(key K) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.removeExpired(time.Now())
+
+	_, ok := c.entries[key]
+	c.count(ok)
+	return ok
+}
+
+// Take removes key and reports whether it was present.
+func (c *TTL[K]) Take(key K) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.removeExpired(time.Now())
+
+	el, ok := c.entries[key]
+	c.count(ok)
+	if ok {
+		c.remove(el)
+	}
+	return ok
+}
+
+func (c *TTL[K]) Remove(key K) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.entries[key]; ok {
+		c.remove(el)
+	}
+}
+
+func (c *TTL[K]) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.order.Len()
+}
+
+func (c *TTL[K]) Stats() Stats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.stats
+}
+
+func (c *TTL[K]) count(hit bool) {
+	if hit {
+		c.stats.Hits++
+	} else {
+		c.stats.Misses++
+	}
+}
+
+func (c *TTL[K]) remove(el *list.Element) {
+	delete(c.entries, el.Value.(*entry[K]).key)
+	c.order.Remove(el)
+}
+
+func (c *TTL[K]) removeExpired(now time.Time) {
+	for el := c.order.Front(); el != nil && !now.Before(el.Value.(*entry[K]).expiresAt); el = c.order.Front() {
+		c.remove(el)
+		c.stats.Expirations++
+	}
+}
@@ -1,10 +1,79 @@
 package config
 
+import "time"
+
 type Config struct {
 	DBPath   string
 	ProxyURL string
 	BotToken string
 
-	ForwarderHookName string
-	MaxAttachmentSize int
+	ForwarderHookName   string
+	DefaultNameTemplate string
+	MaxAttachmentSize   int
+	FanoutWorkers       int
+	EditDebounce        time.Duration
+
+	MaxRevisionsPerMessage int
+
+	AuthorRateLimitBurst   int
+	AuthorRateLimitRefill  time.Duration
+	ChannelRateLimitBurst  int
+	ChannelRateLimitRefill time.Duration
+	RateLimitNoticeEmoji   string
+
+	EchoCacheSize          int
+	EchoCacheTTL           time.Duration
+	EchoCacheStatsInterval time.Duration
+
+	PinsFromOwnerOnly   bool
+	TypingRelayInterval time.Duration
+
+	SinkWorkers     int
+	SinkMaxAttempts int
+	SinkRetryDelay  time.Duration
+
+	APIListenAddr  string
+	APIMaxBodySize int64
+
+	StreamBufferSize int
+
+	FeedPollInterval      time.Duration
+	FeedMaxSize           int64
+	FeedMaxEntriesPerPoll int
+	FeedSummaryLength     int
+
+	IRCServer         string
+	IRCTLS            bool
+	IRCNick           string
+	IRCPassword       string
+	IRCChannels       map[string]string
+	IRCAvatarTemplate string
+
+	MatrixHomeserverURL  string
+	MatrixServerName     string
+	MatrixListenAddr     string
+	MatrixASToken        string
+	MatrixHSToken        string
+	MatrixBotLocalpart   string
+	MatrixGhostPrefix    string
+	MatrixRooms          map[string]string
+	MatrixAvatarTemplate string
+
+	TelegramAPIURL         string
+	TelegramToken          string
+	TelegramPollTimeout    time.Duration
+	TelegramChats          map[string]string
+	TelegramAvatarTemplate string
+
+	SlackAPIURL   string
+	SlackAppToken string
+	SlackBotToken string
+	SlackChannels map[string]string
+
+	FederationInstanceName string
+	FederationListenAddr   string
+	FederationPeerURLs     map[string]string
+	FederationPeerSecrets  map[string]string
+	FederationChannels     []string
+	FederationMaxBodySize  int64
 }
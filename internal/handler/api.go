@@ -0,0 +1,284 @@
+package handler
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/mandriota/bridge-discord-bot/internal/repository"
+	"github.com/mandriota/bridge-discord-bot/internal/transport"
+	"github.com/mandriota/bridge-discord-bot/internal/transport/api"
+)
+
+const (
+	apiEventsPingInterval = 30 * time.Second
+	apiEventsPongTimeout  = apiEventsPingInterval + 10*time.Second
+	apiEventsWriteTimeout = 10 * time.Second
+	apiEventsReadLimit    = 1 << 10
+
+	// apiEventsProtocol is the WebSocket subprotocol of the event stream. Browsers cannot set headers of
+	// WebSocket requests, so they offer the token as another subprotocol, prefixed by apiTokenProtocolPrefix.
+	// Unlike query parameters, subprotocols are not written to access logs and browser history.
+	apiEventsProtocol      = "bridge.events.v1"
+	apiTokenProtocolPrefix = "bridge.token."
+)
+
+type apiAttachment struct {
+	Filename    string `json:"filename"`
+	ContentType string `json:"content_type"`
+	Data        []byte `json:"data"`
+}
+
+type apiMessageCreate struct {
+	Username    string          `json:"username"`
+	AvatarURL   string          `json:"avatar_url"`
+	Content     string          `json:"content"`
+	ReplyTo     string          `json:"reply_to"`
+	Attachments []apiAttachment `json:"attachments"`
+}
+
+type apiMessageCopy struct {
+	ChannelID string `json:"channel_id"`
+	Transport string `json:"transport"`
+	MessageID string `json:"message_id"`
+}
+
+type apiMessageCreated struct {
+	ID       string           `json:"id"`
+	Messages []apiMessageCopy `json:"messages"`
+}
+
+// ServeAPI serves the HTTP API posting messages into virtual channels until ctx is done.
+func (h *EventHandler) ServeAPI(ctx context.Context) error {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /api/v1/messages", h.handleAPIMessageCreate)
+	mux.HandleFunc("GET /api/v1/events", func(w http.ResponseWriter, r *http.Request) {
+		h.handleAPIEvents(ctx, w, r)
+	})
+
+	server := &http.Server{
+		Addr:    h.Cfg.APIListenAddr,
+		Handler: mux,
+	}
+
+	stop := context.AfterFunc(ctx, func() {
+		server.Shutdown(context.Background())
+	})
+	defer stop()
+
+	if err := server.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+func writeAPIError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": message})
+}
+
+// authorizeAPI returns the virtual channel key and the hash of the request's token, writing an error response if there is none.
+// WebSocket requests may offer the token as a subprotocol instead of the Authorization header.
+func (h *EventHandler) authorizeAPI(w http.ResponseWriter, r *http.Request) (virtualChannelKey, tokenHash string, ok bool) {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok && websocket.IsWebSocketUpgrade(r) {
+		for _, protocol := range websocket.Subprotocols(r) {
+			if protocolToken, ok := strings.CutPrefix(protocol, apiTokenProtocolPrefix); ok {
+				token = protocolToken
+				break
+			}
+		}
+	}
+	if token == "" {
+		writeAPIError(w, http.StatusUnauthorized, "missing bearer token")
+		return "", "", false
+	}
+
+	tokenHash = repository.HashAPIToken(token)
+	virtualChannelKey, err := repository.LoadAPITokenVirtualChannelKey(h.Ctx, h.DB, tokenHash)
+	if errors.Is(err, sql.ErrNoRows) {
+		writeAPIError(w, http.StatusUnauthorized, "invalid token")
+		return "", "", false
+	} else if err != nil {
+		h.Client.Logger().Error("failed to load API token", "error", err)
+		writeAPIError(w, http.StatusInternalServerError, "internal error")
+		return "", "", false
+	}
+
+	return virtualChannelKey, tokenHash, true
+}
+
+func (h *EventHandler) handleAPIMessageCreate(w http.ResponseWriter, r *http.Request) {
+	virtualChannelKey, tokenHash, ok := h.authorizeAPI(w, r)
+	if !ok {
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, h.Cfg.APIMaxBodySize)
+
+	payload := apiMessageCreate{}
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		if maxBytesErr := (*http.MaxBytesError)(nil); errors.As(err, &maxBytesErr) {
+			writeAPIError(w, http.StatusRequestEntityTooLarge, "request body too large")
+			return
+		}
+		writeAPIError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if strings.TrimSpace(payload.Content) == "" && len(payload.Attachments) == 0 {
+		writeAPIError(w, http.StatusBadRequest, "message has neither content nor attachments")
+		return
+	}
+	if payload.Username == "" {
+		payload.Username = "API"
+	}
+
+	files := make([]transport.File, 0, len(payload.Attachments))
+	for _, attachment := range payload.Attachments {
+		if attachment.Filename == "" {
+			writeAPIError(w, http.StatusBadRequest, "attachment has no filename")
+			return
+		}
+		if len(attachment.Data) > h.Cfg.MaxAttachmentSize {
+			writeAPIError(w, http.StatusRequestEntityTooLarge, "attachment too large")
+			return
+		}
+		files = append(files, transport.File{
+			Name:        attachment.Filename,
+			ContentType: attachment.ContentType,
+			Size:        len(attachment.Data),
+			Body:        attachment.Data,
+		})
+	}
+
+	endpoint, err := repository.LinkEndpoint(h.Ctx, h.DB, virtualChannelKey, api.Name, virtualChannelKey, "HTTP API")
+	if err != nil {
+		h.Client.Logger().Error("failed to link API endpoint", "error", err)
+		writeAPIError(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+
+	messageID := transport.NewID().String()
+	msg, _, err := h.fromIncoming(endpoint, transport.Incoming{
+		Message: transport.Message{
+			// usernames are chosen freely by clients, so authors are told apart by their tokens
+			AuthorID:  tokenHash[:16],
+			Username:  payload.Username,
+			AvatarURL: payload.AvatarURL,
+			Content:   payload.Content,
+			Files:     files,
+			ReplyTo:   payload.ReplyTo,
+		},
+		ID:     messageID,
+		Origin: "API",
+	})
+	if err != nil {
+		h.Client.Logger().Error("failed to map API message", "error", err)
+		writeAPIError(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+
+	forwarded, err := h.bridgeCreate(msg)
+	if errors.Is(err, errThrottled) {
+		writeAPIError(w, http.StatusTooManyRequests, "rate limit exceeded")
+		return
+	} else if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+
+	created := apiMessageCreated{ID: messageID, Messages: []apiMessageCopy{}}
+	for _, messageCopy := range forwarded.Wait() {
+		created.Messages = append(created.Messages, apiMessageCopy{
+			ChannelID: messageCopy.Endpoint.ChannelID.String(),
+			Transport: messageCopy.Endpoint.Transport,
+			MessageID: messageCopy.RemoteID,
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(created)
+}
+
+var eventsUpgrader = websocket.Upgrader{
+	// the token subprotocol is never selected, so it is not echoed back
+	Subprotocols: []string{apiEventsProtocol},
+	// requests are authenticated by tokens rather than cookies, so any page may connect
+	CheckOrigin: func(r *http.Request) bool {
+		return true
+	},
+}
+
+// handleAPIEvents streams events of the token's virtual channel over a WebSocket until either side closes it or ctx is done.
+func (h *EventHandler) handleAPIEvents(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	virtualChannelKey, _, ok := h.authorizeAPI(w, r)
+	if !ok {
+		return
+	}
+
+	conn, err := eventsUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	subscription := h.Stream.Subscribe(virtualChannelKey)
+	defer subscription.Close()
+
+	// holders of a token may post into the virtual channel, but not link channels to it
+	virtualChannelHash := repository.HashVirtualChannelKey(virtualChannelKey)
+
+	// subscribers only send control frames, reading processes them and notices the connection closing
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+
+		conn.SetReadLimit(apiEventsReadLimit)
+		conn.SetReadDeadline(time.Now().Add(apiEventsPongTimeout))
+		conn.SetPongHandler(func(string) error {
+			return conn.SetReadDeadline(time.Now().Add(apiEventsPongTimeout))
+		})
+
+		for {
+			if _, _, err := conn.NextReader(); err != nil {
+				return
+			}
+		}
+	}()
+
+	pingTicker := time.NewTicker(apiEventsPingInterval)
+	defer pingTicker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseGoingAway, ""), time.Now().Add(apiEventsWriteTimeout))
+			return
+		case <-closed:
+			return
+		case <-pingTicker.C:
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(apiEventsWriteTimeout)); err != nil {
+				return
+			}
+		case event, ok := <-subscription.Events():
+			if !ok {
+				conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.ClosePolicyViolation, "subscriber too slow"), time.Now().Add(apiEventsWriteTimeout))
+				return
+			}
+
+			event.VirtualChannel = virtualChannelHash
+			conn.SetWriteDeadline(time.Now().Add(apiEventsWriteTimeout))
+			if err := conn.WriteJSON(event); err != nil {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,181 @@
+package handler
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	_ "github.com/mattn/go-sqlite3"
+
+	"github.com/mandriota/bridge-discord-bot/internal/repository"
+	"github.com/mandriota/bridge-discord-bot/internal/stream"
+)
+
+const (
+	alphaToken = "alpha-token"
+	betaToken  = "beta-token"
+)
+
+// newAPIServer serves the API of a handler with a token for each of the virtual channels alpha and beta.
+func newAPIServer(t *testing.T) (*EventHandler, *httptest.Server) {
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	db := (*sql.DB)(nil)
+	if err := repository.InitDB(ctx, &db, filepath.Join(t.TempDir(), "bridge.db")); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	for token, virtualChannelKey := range map[string]string{alphaToken: "alpha", betaToken: "beta"} {
+		if err := repository.SaveAPIToken(ctx, db, repository.HashAPIToken(token), virtualChannelKey); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	h := &EventHandler{Ctx: ctx, DB: db, Stream: stream.New(4)}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /api/v1/messages", h.handleAPIMessageCreate)
+	mux.HandleFunc("GET /api/v1/events", func(w http.ResponseWriter, r *http.Request) {
+		h.handleAPIEvents(ctx, w, r)
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	return h, server
+}
+
+func TestAPIMessageCreateUnauthorized(t *testing.T) {
+	_, server := newAPIServer(t)
+
+	for name, authorization := range map[string]string{
+		"missing token": "",
+		"invalid token": "Bearer wrong-token",
+		"wrong scheme":  "Basic " + alphaToken,
+	} {
+		req, _ := http.NewRequest(http.MethodPost, server.URL+"/api/v1/messages", strings.NewReader(`{"content":"hi"}`))
+		if authorization != "" {
+			req.Header.Set("Authorization", authorization)
+		}
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusUnauthorized {
+			t.Errorf("%s: responded %s", name, resp.Status)
+		}
+	}
+}
+
+func dialEvents(server *httptest.Server, query string, header http.Header, protocols ...string) (*websocket.Conn, *http.Response, error) {
+	dialer := websocket.Dialer{Subprotocols: protocols, HandshakeTimeout: 5 * time.Second}
+	return dialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/api/v1/events"+query, header)
+}
+
+func TestAPIEventsUnauthorized(t *testing.T) {
+	_, server := newAPIServer(t)
+
+	for name, test := range map[string]struct {
+		query     string
+		header    http.Header
+		protocols []string
+	}{
+		"missing token":    {},
+		"invalid token":    {header: http.Header{"Authorization": {"Bearer wrong-token"}}},
+		"invalid protocol": {protocols: []string{apiEventsProtocol, apiTokenProtocolPrefix + "wrong-token"}},
+		// query parameters end up in access logs, so they are not accepted
+		"query parameter": {query: "?access_token=" + alphaToken},
+	} {
+		conn, resp, err := dialEvents(server, test.query, test.header, test.protocols...)
+		if err == nil {
+			conn.Close()
+			t.Errorf("%s: connected", name)
+			continue
+		}
+		if resp == nil || resp.StatusCode != http.StatusUnauthorized {
+			t.Errorf("%s: failed with %v", name, err)
+		}
+	}
+}
+
+func TestAPIEvents(t *testing.T) {
+	h, server := newAPIServer(t)
+
+	alpha, _, err := dialEvents(server, "", http.Header{"Authorization": {"Bearer " + alphaToken}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer alpha.Close()
+
+	beta, resp, err := dialEvents(server, "", nil, apiEventsProtocol, apiTokenProtocolPrefix+betaToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer beta.Close()
+	// the token is never echoed back
+	if beta.Subprotocol() != apiEventsProtocol || strings.Contains(resp.Header.Get("Sec-WebSocket-Protocol"), betaToken) {
+		t.Errorf("selected subprotocol %q", resp.Header.Get("Sec-WebSocket-Protocol"))
+	}
+
+	// both subscriptions are registered once their handlers run, which follows the handshake
+	for deadline := time.Now().Add(5 * time.Second); ; {
+		h.Stream.Publish(stream.Event{Type: stream.EventForwarded, VirtualChannel: "alpha", MessageID: "probe"})
+		h.Stream.Publish(stream.Event{Type: stream.EventForwarded, VirtualChannel: "beta", MessageID: "probe"})
+
+		alpha.SetReadDeadline(time.Now().Add(50 * time.Millisecond))
+		beta.SetReadDeadline(time.Now().Add(50 * time.Millisecond))
+		event := stream.Event{}
+		if alpha.ReadJSON(&event) == nil && beta.ReadJSON(&event) == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("subscriptions were not registered")
+		}
+	}
+
+	h.Stream.Publish(stream.Event{Type: stream.EventEdited, VirtualChannel: "alpha", MessageID: "1"})
+	h.Stream.Publish(stream.Event{Type: stream.EventDeleted, VirtualChannel: "beta", MessageID: "2"})
+	h.Stream.Publish(stream.Event{Type: stream.EventEdited, VirtualChannel: "alpha", MessageID: "3"})
+
+	for name, test := range map[string]struct {
+		conn           *websocket.Conn
+		virtualChannel string
+		messageIDs     []string
+	}{
+		"alpha": {alpha, "alpha", []string{"1", "3"}},
+		"beta":  {beta, "beta", []string{"2"}},
+	} {
+		test.conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		for _, messageID := range test.messageIDs {
+			event := stream.Event{}
+			// probes published while waiting for the other subscription may still be queued
+			for event.MessageID == "" || event.MessageID == "probe" {
+				if err := test.conn.ReadJSON(&event); err != nil {
+					t.Fatalf("%s: %v", name, err)
+				}
+			}
+			if event.MessageID != messageID {
+				t.Errorf("%s received message %s, want %s", name, event.MessageID, messageID)
+			}
+			// subscribers learn the hash of the virtual channel key, which cannot link channels
+			if event.VirtualChannel != repository.HashVirtualChannelKey(test.virtualChannel) {
+				t.Errorf("%s received virtual channel %q", name, event.VirtualChannel)
+			}
+		}
+	}
+
+	// nothing of the other virtual channel arrives
+	alpha.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+	if event := (stream.Event{}); alpha.ReadJSON(&event) == nil && event.MessageID != "probe" {
+		t.Errorf("alpha received %+v", event)
+	}
+}
@@ -0,0 +1,168 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/mandriota/bridge-discord-bot/internal/repository"
+	"github.com/mandriota/bridge-discord-bot/internal/sink"
+	"github.com/mandriota/bridge-discord-bot/internal/texts"
+	"github.com/mandriota/bridge-discord-bot/internal/transport"
+	"github.com/mandriota/bridge-discord-bot/internal/transport/feed"
+)
+
+const feedFetchTimeout = 30 * time.Second
+
+// PollFeeds polls all feeds every FeedPollInterval until ctx is done, posting their new entries to their virtual channels.
+func (h *EventHandler) PollFeeds(ctx context.Context) {
+	client := sink.NewClient(feedFetchTimeout)
+
+	ticker := time.NewTicker(h.Cfg.FeedPollInterval)
+	defer ticker.Stop()
+
+	for {
+		feeds, err := repository.LoadAllFeeds(ctx, h.DB)
+		if err != nil {
+			h.Client.Logger().Error("failed to load feeds", "error", err)
+		}
+
+		for _, f := range feeds {
+			if ctx.Err() != nil {
+				return
+			}
+			h.pollFeed(ctx, client, f)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (h *EventHandler) pollFeed(ctx context.Context, client *http.Client, f repository.Feed) {
+	parsed, err := feed.Fetch(ctx, client, f.URL, h.Cfg.FeedMaxSize)
+	if err != nil {
+		h.Client.Logger().Warn("failed to fetch feed", "error", err, "feed_id", f.ID, "url", f.URL)
+		return
+	}
+
+	// entries published before the feed was added are recorded, but not posted
+	if !f.Primed {
+		for _, entry := range parsed.Entries {
+			if _, err := repository.SaveFeedEntry(ctx, h.DB, f.ID, entry.GUID); err != nil {
+				h.Client.Logger().Error("failed to save feed entry", "error", err, "feed_id", f.ID)
+				return
+			}
+		}
+		if err := repository.SaveFeedPrimed(ctx, h.DB, f.ID); err != nil {
+			h.Client.Logger().Error("failed to save feed state", "error", err, "feed_id", f.ID)
+		}
+		return
+	}
+
+	feedID := strconv.FormatInt(f.ID, 10)
+	endpoint, err := repository.LinkEndpoint(ctx, h.DB, f.VirtualChannelKey, feed.Name, feedID, "feed "+f.URL)
+	if err != nil {
+		h.Client.Logger().Error("failed to link feed endpoint", "error", err, "feed_id", f.ID)
+		return
+	}
+
+	name := f.Name
+	if name == "" {
+		name = parsed.Title
+	}
+	if name == "" {
+		name = "Feed"
+	}
+
+	posted := 0
+	for _, entry := range parsed.Entries {
+		// the rest is posted by the next polls, so a feed catching up does not flood its virtual channel
+		if posted == h.Cfg.FeedMaxEntriesPerPoll {
+			return
+		}
+
+		saved, err := repository.SaveFeedEntry(ctx, h.DB, f.ID, entry.GUID)
+		if err != nil {
+			h.Client.Logger().Error("failed to save feed entry", "error", err, "feed_id", f.ID)
+			return
+		} else if !saved {
+			continue
+		}
+
+		msg, _, err := h.fromIncoming(endpoint, transport.Incoming{
+			Message: transport.Message{
+				AuthorID:  feedID,
+				Username:  name,
+				AvatarURL: f.AvatarURL,
+				Content:   h.feedEntryContent(entry),
+			},
+			ID:     entry.GUID,
+			Origin: parsed.Title,
+		})
+		if err != nil {
+			h.Client.Logger().Error("failed to map feed entry", "error", err, "feed_id", f.ID)
+		} else {
+			_, err = h.bridgeCreate(msg)
+		}
+		if err != nil {
+			// posted by the next poll instead
+			if err := repository.DeleteFeedEntry(ctx, h.DB, f.ID, entry.GUID); err != nil {
+				h.Client.Logger().Error("failed to delete feed entry", "error", err, "feed_id", f.ID)
+			}
+			return
+		}
+		posted++
+	}
+}
+
+// feedEntryContent renders the entry as its linked title in bold, followed by the start of its summary.
+func (h *EventHandler) feedEntryContent(entry feed.Entry) string {
+	sb := strings.Builder{}
+
+	title := texts.EscapeMarkdown(entry.Title)
+	if title == "" {
+		title = "Untitled"
+	}
+
+	sb.WriteString("**")
+	if entry.Link != "" {
+		sb.WriteString("[")
+		sb.WriteString(title)
+		sb.WriteString("](")
+		sb.WriteString(strings.NewReplacer("(", "%28", ")", "%29", " ", "%20").Replace(entry.Link))
+		sb.WriteString(")")
+	} else {
+		sb.WriteString(title)
+	}
+	sb.WriteString("**")
+
+	if summary := truncateSummary(entry.SummaryText(), h.Cfg.FeedSummaryLength); summary != "" {
+		sb.WriteString("\n")
+		sb.WriteString(texts.EscapeMarkdown(summary))
+	}
+
+	return sb.String()
+}
+
+// truncateSummary cuts s to at most n runes at a word boundary, marking the cut with an ellipsis.
+func truncateSummary(s string, n int) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+
+	cut := s[:texts.NthRune(s, n)]
+	if i := strings.LastIndexFunc(cut, unicode.IsSpace); i > 0 {
+		cut = cut[:i]
+	}
+	return strings.TrimRightFunc(cut, func(r rune) bool {
+		return unicode.IsSpace(r) || unicode.IsPunct(r)
+	}) + "…"
+}
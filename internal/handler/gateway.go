@@ -0,0 +1,39 @@
+package handler
+
+import (
+	"github.com/disgoorg/disgo/bot"
+	"github.com/disgoorg/disgo/events"
+	"github.com/disgoorg/disgo/gateway"
+	"github.com/disgoorg/disgo/handlers"
+	"github.com/disgoorg/snowflake/v2"
+)
+
+// GuildMessageDeleteBulk is dispatched once per bulk deletion, before disgo splits it
+// into a GuildMessageDelete event per message.
+type GuildMessageDeleteBulk struct {
+	*events.GenericEvent
+	MessageIDs []snowflake.ID
+	ChannelID  snowflake.ID
+	GuildID    snowflake.ID
+}
+
+func GatewayHandlers() map[gateway.EventType]bot.GatewayEventHandler {
+	gatewayHandlers := handlers.GetGatewayHandlers()
+
+	defaultDeleteBulkHandler := gatewayHandlers[gateway.EventTypeMessageDeleteBulk]
+	gatewayHandlers[gateway.EventTypeMessageDeleteBulk] = bot.NewGatewayEventHandler(gateway.EventTypeMessageDeleteBulk,
+		func(client bot.Client, sequenceNumber int, shardID int, event gateway.EventMessageDeleteBulk) {
+			if event.GuildID != nil {
+				client.EventManager().DispatchEvent(&GuildMessageDeleteBulk{
+					GenericEvent: events.NewGenericEvent(client, sequenceNumber, shardID),
+					MessageIDs:   event.IDs,
+					ChannelID:    event.ChannelID,
+					GuildID:      *event.GuildID,
+				})
+			}
+			defaultDeleteBulkHandler.HandleGatewayEvent(client, sequenceNumber, shardID, event)
+		},
+	)
+
+	return gatewayHandlers
+}
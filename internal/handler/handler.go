@@ -1,87 +1,437 @@
 package handler
 
 import (
-	"bytes"
 	"context"
-	"crypto/sha256"
+	"crypto/rand"
 	"database/sql"
 	"encoding/hex"
+	"errors"
 	"fmt"
+	"net/url"
+	"regexp"
+	"slices"
+	"strconv"
 	"strings"
 	"sync"
-	"unicode"
+	"time"
+	"unicode/utf8"
 
+	"github.com/disgoorg/disgo/bot"
 	"github.com/disgoorg/disgo/discord"
 	"github.com/disgoorg/disgo/events"
 	"github.com/disgoorg/disgo/rest"
-	"github.com/disgoorg/disgo/webhook"
 	"github.com/disgoorg/json"
 	"github.com/disgoorg/snowflake/v2"
+	"github.com/mandriota/bridge-discord-bot/internal/cache"
 	"github.com/mandriota/bridge-discord-bot/internal/config"
+	"github.com/mandriota/bridge-discord-bot/internal/ratelimit"
 	"github.com/mandriota/bridge-discord-bot/internal/repository/dbqueries"
 	"github.com/mandriota/bridge-discord-bot/internal/repository"
+	"github.com/mandriota/bridge-discord-bot/internal/sequencer"
+	"github.com/mandriota/bridge-discord-bot/internal/sink"
+	"github.com/mandriota/bridge-discord-bot/internal/stream"
 	"github.com/mandriota/bridge-discord-bot/internal/texts"
+	"github.com/mandriota/bridge-discord-bot/internal/transport"
+	"github.com/mandriota/bridge-discord-bot/internal/transport/feed"
+)
+
+const (
+	bulkDeleteMaxMessages = 100
+	bulkDeleteMaxAge      = 14*24*time.Hour - time.Hour
+
+	maxEmbedFields           = 25
+	maxEmbedFieldValueLength = 1024
+	maxEmbedLength           = 6000
+
+	// interactions must be answered within 3 seconds
+	urlCheckTimeout = 2 * time.Second
+
+	// previews of older messages are fetched from Discord instead
+	previewMaxAge = 90 * 24 * time.Hour
+	// edit history of older messages is dropped
+	revisionMaxAge = 90 * 24 * time.Hour
+
+	unknownChannelCode rest.JSONErrorCode = 10003
+	unknownMessageCode rest.JSONErrorCode = 10008
 )
 
 type EventHandler struct {
 	Ctx context.Context
 	Cfg config.Config
 
+	Client         bot.Client
 	Rest           rest.Rest
 	DB             *sql.DB
-	recentDelCache sync.Map
+	Transports     transport.Registry
+	AuthorLimiter  *ratelimit.Limiter
+	ChannelLimiter *ratelimit.Limiter
+	EchoCache      *cache.TTL[Echo]
+	Fanout         *sequencer.Sequencer[snowflake.ID]
+	Edits          *sequencer.Debouncer[snowflake.ID]
+	Sinks          *sink.Dispatcher
+	Stream         *stream.Hub
+	lastTypingAt   sync.Map
+	sinkPatterns   sync.Map
+}
+
+// Echo is a change the bridge made to a message, expected to come back as an event of its platform.
+// Reactions are not bridged, so only deletions and edits echo.
+type Echo struct {
+	Kind      EchoKind
+	MessageID snowflake.ID
 }
 
+type EchoKind uint8
+
+const (
+	EchoDelete EchoKind = iota
+	EchoEdit
+)
+
 //=:handler:messages
 
-func (h *EventHandler) tryWriteReferenceHeader(w *strings.Builder, targetGuildID, targetChannelID snowflake.ID, msgRef *discord.MessageReference) error {
-	if msgRef == nil {
-		return nil
+// bridgeMessage is a message entering the bridge through any transport.
+type bridgeMessage struct {
+	Source    transport.Endpoint
+	MessageID snowflake.ID
+	RemoteID  string
+	// AuthorID is the Discord user ID of the author, or 0 for authors on other platforms.
+	AuthorID  snowflake.ID
+	AuthorKey string
+	Identity  authorIdentity
+	Origin    string
+	// Content is the text as written by the author, Body additionally quotes forwarded messages.
+	Content   string
+	Body      string
+	ReplyTo   *repository.MessageRef
+	Files     []transport.File
+	Voice     bool
+	Timestamp time.Time
+}
+
+func (h *EventHandler) fromDiscordMessage(guildID snowflake.ID, message discord.Message) bridgeMessage {
+	body := &strings.Builder{}
+	body.WriteString(message.Content)
+	h.writeForwardedSnapshots(body, message)
+
+	origin := ""
+	if guild, ok := h.Client.Caches().Guild(guildID); ok {
+		origin = guild.Name
 	}
 
-	relatedMsgID, err := repository.LoadDirelatedMessageID(h.Ctx, h.DB, targetChannelID, *msgRef.MessageID)
-	if err != nil {
-		return err
+	replyTo := (*repository.MessageRef)(nil)
+	if msgRef := message.MessageReference; isReply(msgRef) {
+		replyTo = &repository.MessageRef{ChannelID: *msgRef.ChannelID, MessageID: *msgRef.MessageID}
+	}
+
+	timestamp := message.CreatedAt
+	if message.EditedTimestamp != nil {
+		timestamp = *message.EditedTimestamp
 	}
 
-	referredMsg, err := h.Rest.GetMessage(*msgRef.ChannelID, *msgRef.MessageID)
+	attachments := messageAttachments(message)
+
+	return bridgeMessage{
+		Source:    transport.Endpoint{ChannelID: message.ChannelID, Transport: transport.Discord},
+		MessageID: message.ID,
+		RemoteID:  message.ID.String(),
+		AuthorID:  message.Author.ID,
+		AuthorKey: message.Author.ID.String(),
+		Identity:  resolveAuthorIdentity(h.Client.Caches(), guildID, message),
+		Origin:    origin,
+		Content:   message.Content,
+		Body:      body.String(),
+		ReplyTo:   replyTo,
+		Files:     discordFiles(attachments),
+		Voice:     message.Flags.Has(discord.MessageFlagIsVoiceMessage) && len(attachments) == 1,
+		Timestamp: timestamp,
+	}
+}
+
+// remoteMessageID translates a message ID used in the bridge to the ID of the message on the endpoint's platform.
+func (h *EventHandler) remoteMessageID(endpoint transport.Endpoint, messageID snowflake.ID) (string, error) {
+	if endpoint.Transport == transport.Discord {
+		return messageID.String(), nil
+	}
+	return repository.LoadRemoteMessageID(h.Ctx, h.DB, endpoint.ChannelID, messageID)
+}
+
+// localMessageID translates the ID of a message on the endpoint's platform to the ID used in the bridge,
+// generating one for messages on other platforms seen for the first time, as reported by created.
+func (h *EventHandler) localMessageID(endpoint transport.Endpoint, remoteID string) (messageID snowflake.ID, created bool, err error) {
+	if endpoint.Transport == transport.Discord {
+		messageID, err = snowflake.Parse(remoteID)
+		return messageID, false, err
+	}
+
+	messageID, err = repository.LoadLocalMessageID(h.Ctx, h.DB, endpoint.ChannelID, remoteID)
+	if !errors.Is(err, sql.ErrNoRows) {
+		return messageID, false, err
+	}
+
+	generatedID := transport.NewID()
+	if err := repository.SaveRemoteMessageID(h.Ctx, h.DB, endpoint.ChannelID, generatedID, remoteID); err != nil {
+		return 0, false, err
+	}
+
+	// the mapping saved first wins when the same message is received concurrently
+	messageID, err = repository.LoadLocalMessageID(h.Ctx, h.DB, endpoint.ChannelID, remoteID)
+	if err != nil || messageID != generatedID {
+		return messageID, false, err
+	}
+
+	// replies and deletions on the platform refer to a single part of a split message
+	if parts := transport.MessageIDParts(remoteID); len(parts) > 1 {
+		return messageID, true, repository.SaveRemoteMessageParts(h.Ctx, h.DB, endpoint.ChannelID, messageID, parts)
+	}
+	return messageID, true, nil
+}
+
+func (h *EventHandler) endpointGuildID(endpoint transport.Endpoint) snowflake.ID {
+	if endpoint.Transport != transport.Discord {
+		return 0
+	}
+	if channel, ok := h.Client.Caches().GuildMessageChannel(endpoint.ChannelID); ok {
+		return channel.GuildID()
+	}
+	return 0
+}
+
+func (h *EventHandler) resolveOriginalMessage(channelID, messageID snowflake.ID) (repository.MessageRef, error) {
+	original, err := repository.LoadOriginalMessage(h.Ctx, h.DB, messageID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return repository.MessageRef{ChannelID: channelID, MessageID: messageID}, nil
+	}
+	return original, err
+}
+
+func (h *EventHandler) loadReferencePreview(replyTo, original repository.MessageRef) (authorID snowflake.ID, content string, found bool, err error) {
+	authorID, content, err = repository.LoadPreview(h.Ctx, h.DB, original.MessageID)
+	if err == nil {
+		return authorID, content, true, nil
+	} else if !errors.Is(err, sql.ErrNoRows) {
+		return 0, "", false, err
+	}
+
+	referredMsg, err := h.Rest.GetMessage(replyTo.ChannelID, replyTo.MessageID)
+	if restErr := (rest.Error{}); errors.As(err, &restErr) && (restErr.Code == unknownMessageCode || restErr.Code == unknownChannelCode) {
+		// neither cached nor fetchable: the referenced message is gone
+		return 0, "", false, nil
+	} else if err != nil {
+		return 0, "", false, err
+	}
+	content = referredMsg.Content[texts.SkipPrefixedLine(referredMsg.Content, "-#"):]
+
+	if referredMsg.WebhookID == nil {
+		return referredMsg.Author.ID, content, true, nil
+	}
+
+	// copies are shown with the name rendered for their channel, mapped to the author when forwarded
+	authorID, err = repository.LoadAuthorID(h.Ctx, h.DB, referredMsg.Author.Username)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return 0, "", false, err
+	}
+	return authorID, content, true, nil
+}
+
+func isReply(msgRef *discord.MessageReference) bool {
+	return msgRef != nil && msgRef.Type == discord.MessageReferenceTypeDefault && msgRef.ChannelID != nil && msgRef.MessageID != nil
+}
+
+// tryWriteReferenceHeader writes the reply header for the target and returns the ID of the
+// copy of the replied message in the target, or 0 if it was not forwarded there.
+func (h *EventHandler) tryWriteReferenceHeader(w *strings.Builder, target transport.Endpoint, replyTo *repository.MessageRef) (snowflake.ID, error) {
+	if replyTo == nil {
+		return 0, nil
+	}
+
+	original, err := h.resolveOriginalMessage(replyTo.ChannelID, replyTo.MessageID)
 	if err != nil {
-		return err
+		return 0, err
+	}
+
+	relatedMsgID := original.MessageID
+	if original.ChannelID != target.ChannelID {
+		relatedMsgID, err = repository.LoadRelatedMessageID(h.Ctx, h.DB, target.ChannelID, original.MessageID)
+		if errors.Is(err, sql.ErrNoRows) {
+			relatedMsgID = 0
+		} else if err != nil {
+			return 0, err
+		}
 	}
 
-	referredMsgAuthorID, err := repository.LoadAuthorID(h.Ctx, h.DB, referredMsg.Author.Username)
+	referredMsgAuthorID, referredMsgPreview, found, err := h.loadReferencePreview(*replyTo, original)
 	if err != nil {
-		return err
+		return relatedMsgID, err
+	}
+
+	targetGuildID := h.endpointGuildID(target)
+
+	w.WriteString("-# ↵")
+	if relatedMsgID != 0 && targetGuildID != 0 {
+		w.WriteByte(' ')
+		w.WriteString(messageURL(targetGuildID, target.ChannelID, relatedMsgID))
+	}
+	if !found {
+		w.WriteString(" *original message deleted*\n")
+		return relatedMsgID, nil
+	}
+	// mentions only render on Discord
+	if referredMsgAuthorID != 0 && targetGuildID != 0 {
+		w.WriteString(" (<@")
+		w.WriteString(referredMsgAuthorID.String())
+		w.WriteString(">)")
 	}
 
-	referredMsgPreview := referredMsg.Content[texts.SkipPrefixedLine(referredMsg.Content, "-#"):]
+	referredMsgPreview, cut := texts.Preview(referredMsgPreview, 128)
 	cutIndicator := ""
-	referredMsgPreviewWindow := texts.NthRune(referredMsgPreview, 128)
-	if referredMsgPreviewWindow < len(referredMsgPreview) {
+	if cut {
 		cutIndicator = " **. . .**"
-		referredMsgPreview = referredMsgPreview[:referredMsgPreviewWindow]
-
-		lastSpace := strings.LastIndexFunc(referredMsgPreview, unicode.IsSpace)
-		if lastSpace > 0 {
-			referredMsgPreview = referredMsgPreview[:lastSpace]
-		}
 	}
-	referredMsgPreview = strings.TrimRightFunc(referredMsgPreview, unicode.IsSpace)
 
-	w.WriteString("-# ↵ https://discord.com/channels/")
-	w.WriteString(targetGuildID.String())
-	w.WriteByte('/')
-	w.WriteString(targetChannelID.String())
-	w.WriteByte('/')
-	w.WriteString(relatedMsgID.String())
-	w.WriteString(" (<@")
-	w.WriteString(referredMsgAuthorID.String())
-	w.WriteString(">)\n-# > ")
+	w.WriteString("\n-# > ")
 	w.WriteString(referredMsgPreview)
 	w.WriteString(cutIndicator)
 	w.WriteByte('\n')
 
-	return nil
+	return relatedMsgID, nil
+}
+
+func (h *EventHandler) writeForwardedSnapshots(w *strings.Builder, message discord.Message) {
+	msgRef := message.MessageReference
+	if msgRef == nil || msgRef.Type != discord.MessageReferenceTypeForward {
+		return
+	}
+
+	for _, snapshot := range message.MessageSnapshots {
+		if w.Len() > 0 {
+			w.WriteByte('\n')
+		}
+
+		w.WriteString("-# ↪ *Forwarded*")
+		if msgRef.GuildID != nil {
+			if guild, ok := h.Client.Caches().Guild(*msgRef.GuildID); ok {
+				w.WriteString(" from **")
+				w.WriteString(guild.Name)
+				w.WriteString("**")
+			}
+		}
+		if msgRef.ChannelID != nil && msgRef.MessageID != nil {
+			w.WriteString(" https://discord.com/channels/")
+			if msgRef.GuildID != nil {
+				w.WriteString(msgRef.GuildID.String())
+			} else {
+				w.WriteString("@me")
+			}
+			w.WriteByte('/')
+			w.WriteString(msgRef.ChannelID.String())
+			w.WriteByte('/')
+			w.WriteString(msgRef.MessageID.String())
+		}
+		w.WriteByte('\n')
+
+		if snapshot.Message.Content == "" {
+			continue
+		}
+		for _, line := range strings.Split(snapshot.Message.Content, "\n") {
+			w.WriteString("> ")
+			w.WriteString(line)
+			w.WriteByte('\n')
+		}
+	}
+}
+
+func (h *EventHandler) saveReferenceData(tx repository.Execer, msg *bridgeMessage) error {
+	if err := repository.SavePreview(h.Ctx, tx, msg.Source.ChannelID, msg.MessageID, msg.AuthorID, msg.Content); err != nil {
+		return err
+	}
+	if err := repository.DeletePreviewsBefore(h.Ctx, tx, snowflake.New(time.Now().Add(-previewMaxAge))); err != nil {
+		return err
+	}
+	if err := repository.DeleteContentRevisionsBefore(h.Ctx, tx, snowflake.New(time.Now().Add(-revisionMaxAge))); err != nil {
+		return err
+	}
+
+	// copies forwarded before name templates, or with a template of the username alone, are shown with the username
+	if msg.AuthorID != 0 {
+		if err := repository.SaveAuthorMapping(h.Ctx, tx, msg.Identity.Username, msg.AuthorID); err != nil {
+			return err
+		}
+	}
+
+	if msg.ReplyTo == nil {
+		return nil
+	}
+
+	original, err := h.resolveOriginalMessage(msg.ReplyTo.ChannelID, msg.ReplyTo.MessageID)
+	if err != nil {
+		return err
+	}
+	return repository.SaveReply(h.Ctx, tx, msg.Source.ChannelID, msg.MessageID, original.MessageID)
+}
+
+func (h *EventHandler) checkRateLimit(msg *bridgeMessage) (allowed bool, err error) {
+	virtualChannelKeys, err := repository.LoadVirtualChannelKeys(h.Ctx, h.DB, msg.Source.ChannelID)
+	if err != nil {
+		return false, err
+	}
+
+	type bucket struct {
+		limiter *ratelimit.Limiter
+		key     string
+	}
+
+	allowed = true
+	notify := false
+	taken := []bucket{}
+
+	for _, virtualChannelKey := range virtualChannelKeys {
+		for _, b := range []bucket{
+			{h.AuthorLimiter, virtualChannelKey + "/" + msg.AuthorKey},
+			{h.ChannelLimiter, virtualChannelKey + "/" + msg.Source.ChannelID.String()},
+		} {
+			bucketAllowed, bucketNotify := b.limiter.Allow(b.key)
+			if bucketAllowed {
+				taken = append(taken, b)
+			}
+			allowed = allowed && bucketAllowed
+			notify = notify || bucketNotify
+		}
+	}
+
+	// throttled messages are not bridged anywhere, so they cost no tokens
+	if !allowed {
+		for _, b := range taken {
+			b.limiter.Refund(b.key)
+		}
+	}
+
+	if notify && h.Cfg.RateLimitNoticeEmoji != "" {
+		if sourceTransport, ok := h.Transports[msg.Source.Transport]; ok {
+			if err := sourceTransport.React(h.Ctx, msg.Source, msg.RemoteID, h.Cfg.RateLimitNoticeEmoji); err != nil && !errors.Is(err, transport.ErrUnsupported) {
+				h.Client.Logger().Error("failed to add rate limit notice reaction", "error", err)
+			}
+		}
+	}
+
+	return allowed, nil
+}
+
+func (h *EventHandler) renderWebhookName(msg *bridgeMessage, targetChannelID snowflake.ID) string {
+	nameTemplate, err := repository.LoadNameTemplate(h.Ctx, h.DB, msg.Source.ChannelID, targetChannelID)
+	if err != nil {
+		h.Client.Logger().Error("failed to load name template", "error", err)
+	}
+	if nameTemplate == "" {
+		nameTemplate = h.Cfg.DefaultNameTemplate
+	}
+
+	return texts.SanitizeWebhookName(texts.ExpandTemplate(nameTemplate, map[string]string{
+		"username":     msg.Identity.Username,
+		"display_name": msg.Identity.DisplayName,
+		"guild_name":   msg.Origin,
+		"guild_short":  texts.Abbreviate(msg.Origin, 16),
+	}), msg.Identity.Username)
 }
 
 func (h *EventHandler) OnGuildMessageCreate(e *events.GuildMessageCreate) {
@@ -89,165 +439,910 @@ func (h *EventHandler) OnGuildMessageCreate(e *events.GuildMessageCreate) {
 		return
 	}
 
-	targetChannels, err := repository.LoadRelatedChannels(h.Ctx, h.DB, e.ChannelID)
+	h.bridgeCreate(h.fromDiscordMessage(e.GuildID, e.Message))
+}
+
+var errThrottled = errors.New("message throttled")
+
+// forwardedCopy is a copy of a message created by forwarding it to an endpoint.
+type forwardedCopy struct {
+	Endpoint transport.Endpoint
+	RemoteID string
+}
+
+// forwarding tracks forwards of a message to its targets.
+type forwarding struct {
+	wg     sync.WaitGroup
+	mu     sync.Mutex
+	copies []forwardedCopy
+}
+
+// Wait blocks until the message has been forwarded to all targets and returns the created copies.
+func (f *forwarding) Wait() []forwardedCopy {
+	f.wg.Wait()
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.copies
+}
+
+func (h *EventHandler) bridgeCreate(msg bridgeMessage) (*forwarding, error) {
+	targets, err := repository.LoadRelatedEndpoints(h.Ctx, h.DB, msg.Source.ChannelID)
 	if err != nil {
-		e.Client().Logger().Error("failed to load related channels", "error", err)
+		h.Client.Logger().Error("failed to load related endpoints", "error", err)
+		return nil, err
+	}
+
+	sinks, err := repository.LoadSinks(h.Ctx, h.DB, msg.Source.ChannelID)
+	if err != nil {
+		h.Client.Logger().Error("failed to load sinks", "error", err)
+	}
+
+	if len(targets) == 0 && len(sinks) == 0 {
+		return &forwarding{}, nil
+	}
+
+	if allowed, err := h.checkRateLimit(&msg); err != nil {
+		h.Client.Logger().Error("failed to check rate limit", "error", err)
+		return nil, err
+	} else if !allowed {
+		h.Client.Logger().Debug("message throttled", "channel_id", msg.Source.ChannelID, "author", msg.AuthorKey)
+		h.publishStreamEvent(msg.Source, transport.Endpoint{}, stream.Event{Type: stream.EventDropped, MessageID: msg.MessageID.String(), Reason: "throttled"})
+		return nil, errThrottled
+	}
+
+	if err := h.saveReferenceData(h.DB, &msg); err != nil {
+		h.Client.Logger().Error("failed to save reference data", "error", err)
+	}
+
+	if err := repository.SaveContentRevision(h.Ctx, h.DB, msg.Source.ChannelID, msg.MessageID, 0, msg.Content, msg.Timestamp, h.Cfg.MaxRevisionsPerMessage); err != nil {
+		h.Client.Logger().Error("failed to save content revision", "error", err)
+	}
+
+	h.publishToSinks(sinks, sink.EventCreate, msg.Body, sink.Event{Timestamp: msg.Timestamp, Message: sinkMessage(&msg)})
+
+	prepared := preparedMessage{}
+	prepared.footer, prepared.files = processMessageAttachments(&h.Cfg, h.Client.Logger(), msg.Files, false)
+	prepared.voice = msg.Voice && len(prepared.files) == 1
+
+	f := &forwarding{}
+	f.wg.Add(len(targets))
+
+	for _, target := range targets {
+		// sequenced per target channel, so a reply is never forwarded before the message it refers to
+		h.Fanout.Go(target.ChannelID, func() {
+			defer f.wg.Done()
+
+			if remoteID, ok := h.forwardMessage(&msg, &prepared, target); ok {
+				f.mu.Lock()
+				f.copies = append(f.copies, forwardedCopy{Endpoint: target, RemoteID: remoteID})
+				f.mu.Unlock()
+			}
+		})
+	}
+
+	return f, nil
+}
+
+type preparedMessage struct {
+	footer string
+	files  []transport.File
+	voice  bool
+}
+
+func (h *EventHandler) forwardMessage(msg *bridgeMessage, prepared *preparedMessage, target transport.Endpoint) (remoteID string, ok bool) {
+	targetTransport, ok := h.Transports[target.Transport]
+	if !ok {
+		h.Client.Logger().Error("unknown transport", "transport", target.Transport, "channel_id", target.ChannelID)
+		return "", false
+	}
+
+	header := &strings.Builder{}
+	relatedMsgID, err := h.tryWriteReferenceHeader(header, target, msg.ReplyTo)
+	if err != nil {
+		h.Client.Logger().Error("failed to fetch hook message ID", "error", err)
+	}
+	content := msg.Body + prepared.footer
+
+	if header.Len() == 0 && content == "" && len(prepared.files) == 0 {
+		h.Client.Logger().Error("unsupported message")
+		h.publishStreamEvent(msg.Source, target, stream.Event{Type: stream.EventDropped, MessageID: msg.MessageID.String(), Reason: "unsupported"})
+		return "", false
+	}
+
+	webhookName := h.renderWebhookName(msg, target.ChannelID)
+	if msg.AuthorID != 0 {
+		if err := repository.SaveAuthorMapping(h.Ctx, h.DB, webhookName, msg.AuthorID); err != nil {
+			h.Client.Logger().Error("failed to save author mapping", "error", err)
+		}
+	}
+
+	outgoing := transport.Message{
+		AuthorID:  msg.AuthorKey,
+		Username:  webhookName,
+		AvatarURL: msg.Identity.AvatarURL,
+		Header:    header.String(),
+		Content:   content,
+		Files:     prepared.files,
+		Voice:     prepared.voice,
+	}
+	if relatedMsgID != 0 {
+		outgoing.ReplyTo, _ = h.remoteMessageID(target, relatedMsgID)
+	}
+
+	remoteID, err = targetTransport.Send(h.Ctx, target, outgoing)
+	if errors.Is(err, transport.ErrUnsupported) {
+		return "", false
+	} else if err != nil {
+		h.Client.Logger().Error("failed to forward message", "error", err, "transport", target.Transport)
+		h.publishStreamEvent(msg.Source, target, stream.Event{Type: stream.EventFailed, MessageID: msg.MessageID.String(), Reason: "forward"})
+		return "", false
+	}
+
+	h.publishStreamEvent(msg.Source, target, stream.Event{Type: stream.EventForwarded, MessageID: msg.MessageID.String(), TargetMessageID: remoteID})
+
+	forwardedMessageID, _, err := h.localMessageID(target, remoteID)
+	if err != nil {
+		h.Client.Logger().Error("failed to save remote message ID", "error", err)
+		return remoteID, true
+	}
+
+	if err := repository.SaveMessageMapping(h.Ctx, h.DB, msg.Source.ChannelID, msg.MessageID, target.ChannelID, forwardedMessageID); err != nil {
+		h.Client.Logger().Error("failed to save message mapping", "error", err)
+	}
+	return remoteID, true
+}
+
+func (h *EventHandler) OnGuildMessageUpdate(e *events.GuildMessageUpdate) {
+	if h.EchoCache.Take(Echo{EchoEdit, e.Message.ID}) || e.Message.Author.Bot {
 		return
 	}
 
-	tx, err := h.DB.BeginTx(h.Ctx, nil)
+	h.bridgeUpdate(h.fromDiscordMessage(e.GuildID, e.Message))
+}
+
+func (h *EventHandler) bridgeUpdate(msg bridgeMessage) {
+	// latest revision wins within the debounce window, and edits of one message never propagate concurrently
+	h.Edits.Do(msg.MessageID, func() {
+		if sinks, err := repository.LoadSinks(h.Ctx, h.DB, msg.Source.ChannelID); err != nil {
+			h.Client.Logger().Error("failed to load sinks", "error", err)
+		} else {
+			h.publishToSinks(sinks, sink.EventUpdate, msg.Body, sink.Event{Timestamp: msg.Timestamp, Message: sinkMessage(&msg)})
+		}
+
+		if h.propagateUpdate(&msg) {
+			h.refreshReplies(msg.MessageID)
+		}
+	})
+}
+
+// refreshReplies re-renders the copies of replies to the message, so their headers quote its new content.
+// Replies bridged from other transports are left as they are, as their platforms cannot be asked for them again.
+func (h *EventHandler) refreshReplies(messageID snowflake.ID) {
+	replies, err := repository.LoadReplies(h.Ctx, h.DB, messageID)
 	if err != nil {
-		e.Client().Logger().Error("failed to begin transaction", "error", err)
+		h.Client.Logger().Error("failed to load replies", "error", err)
 		return
 	}
-	defer tx.Rollback()
 
-	if err := repository.SaveAuthorMapping(h.Ctx, tx, e.Message.Author.Username, e.Message.Author.ID); err != nil {
-		e.Client().Logger().Error("failed to save author mapping", "error", err)
+	for _, reply := range replies {
+		// a pending edit of the reply renders the new header as well
+		h.Edits.DoUnlessPending(reply.MessageID, func() {
+			h.refreshReply(reply)
+		})
 	}
+}
 
-	contentCommonFooter, contentCommonFileAttach, contentCommonFileBodies := processMessageAttachments(&h.Cfg, e.GenericGuildMessage, false)
+func (h *EventHandler) refreshReply(reply repository.MessageRef) {
+	replyChannel, ok := h.Client.Caches().GuildMessageChannel(reply.ChannelID)
+	if !ok {
+		return
+	}
 
-	for _, targetChannelID := range targetChannels {
-		forwarderWebhook, err := loadOrCreateWebhook(&h.Cfg, e.Client(), targetChannelID)
-		if err != nil {
-			e.Client().Logger().Error("failed to get/create webhook", "error", err)
-			continue
+	replyMsg, err := h.Rest.GetMessage(reply.ChannelID, reply.MessageID)
+	if err != nil {
+		h.Client.Logger().Error("failed to fetch reply for header refresh", "error", err)
+		return
+	}
+	replyBridgeMsg := h.fromDiscordMessage(replyChannel.GuildID(), *replyMsg)
+
+	targets, err := repository.LoadRelatedEndpoints(h.Ctx, h.DB, reply.ChannelID)
+	if err != nil {
+		h.Client.Logger().Error("failed to load related endpoints", "error", err)
+		return
+	}
+
+	contentCommonFooter, _ := processMessageAttachments(&h.Cfg, h.Client.Logger(), replyBridgeMsg.Files, true)
+
+	// the content is unchanged, so no revision is allocated; copies are rewritten after pending edits of their channels
+	for _, target := range targets {
+		h.Fanout.Go(target.ChannelID, func() {
+			h.updateForwardedMessage(&replyBridgeMsg, contentCommonFooter, target, 0)
+		})
+	}
+}
+
+func (h *EventHandler) propagateUpdate(msg *bridgeMessage) (bridged bool) {
+	targets, err := repository.LoadRelatedEndpoints(h.Ctx, h.DB, msg.Source.ChannelID)
+	if err != nil {
+		h.Client.Logger().Error("failed to load related endpoints", "error", err)
+		return false
+	}
+
+	if len(targets) == 0 {
+		return false
+	}
+
+	if err := repository.SavePreview(h.Ctx, h.DB, msg.Source.ChannelID, msg.MessageID, msg.AuthorID, msg.Content); err != nil {
+		h.Client.Logger().Error("failed to save preview", "error", err)
+	}
+
+	// allocated before fan-out, as revisions of overlapping fan-outs are only saved once their tasks finish
+	revision, err := repository.SaveNextRevision(h.Ctx, h.DB, msg.MessageID)
+	if err != nil {
+		h.Client.Logger().Error("failed to allocate revision", "error", err)
+		return true
+	}
+
+	if err := repository.SaveContentRevision(h.Ctx, h.DB, msg.Source.ChannelID, msg.MessageID, revision, msg.Content, msg.Timestamp, h.Cfg.MaxRevisionsPerMessage); err != nil {
+		h.Client.Logger().Error("failed to save content revision", "error", err)
+	}
+
+	contentCommonFooter, _ := processMessageAttachments(&h.Cfg, h.Client.Logger(), msg.Files, true)
+
+	for _, target := range targets {
+		h.Fanout.Go(target.ChannelID, func() {
+			h.updateForwardedMessage(msg, contentCommonFooter, target, revision)
+		})
+	}
+
+	return true
+}
+
+// updateForwardedMessage edits the copy of the message in the target unless it shows a newer revision already.
+// Zero revisions rewrite the copy without checking or recording revisions.
+func (h *EventHandler) updateForwardedMessage(msg *bridgeMessage, contentCommonFooter string, target transport.Endpoint, revision int) {
+	targetTransport, ok := h.Transports[target.Transport]
+	if !ok {
+		h.Client.Logger().Error("unknown transport", "transport", target.Transport, "channel_id", target.ChannelID)
+		return
+	}
+
+	relatedMessageID, err := repository.LoadRelatedMessageID(h.Ctx, h.DB, target.ChannelID, msg.MessageID)
+	if err != nil {
+		h.Client.Logger().Error("failed to fetch related message ID for update", "error", err)
+		return
+	}
+
+	if revision != 0 {
+		if currentRevision, err := repository.LoadRevision(h.Ctx, h.DB, target.ChannelID, msg.MessageID); err != nil {
+			h.Client.Logger().Error("failed to load revision", "error", err)
+			return
+		} else if currentRevision >= revision {
+			return
 		}
+	}
 
-		content := &strings.Builder{}
-		if err := h.tryWriteReferenceHeader(content, forwarderWebhook.GuildID, targetChannelID, e.Message.MessageReference); err != nil {
-			e.Client().Logger().Error("failed to fetch hook message ID", "error", err)
+	remoteID, err := h.remoteMessageID(target, relatedMessageID)
+	if err != nil {
+		h.Client.Logger().Error("failed to load remote message ID", "error", err)
+		return
+	}
+
+	// webhook edits cannot rename the message, but replies to it look the author up by the rendered name
+	webhookName := h.renderWebhookName(msg, target.ChannelID)
+	if msg.AuthorID != 0 {
+		if err := repository.SaveAuthorMapping(h.Ctx, h.DB, webhookName, msg.AuthorID); err != nil {
+			h.Client.Logger().Error("failed to save author mapping", "error", err)
 		}
-		content.WriteString(e.Message.Content)
-		content.WriteString(contentCommonFooter)
+	}
 
-		if content.Len() == 0 && len(contentCommonFileAttach) == 0 {
-			e.Client().Logger().Error("unsupported message")
-			continue
+	header := &strings.Builder{}
+	relatedReplyID, err := h.tryWriteReferenceHeader(header, target, msg.ReplyTo)
+	if err != nil {
+		h.Client.Logger().Error("failed to fetch hook message ID", "error", err)
+	}
+
+	outgoing := transport.Message{
+		AuthorID:  msg.AuthorKey,
+		Username:  webhookName,
+		AvatarURL: msg.Identity.AvatarURL,
+		Header:    header.String(),
+		Content:   msg.Body + contentCommonFooter,
+	}
+	if relatedReplyID != 0 {
+		outgoing.ReplyTo, _ = h.remoteMessageID(target, relatedReplyID)
+	}
+
+	h.EchoCache.Add(Echo{EchoEdit, relatedMessageID})
+	if err := targetTransport.Edit(h.Ctx, target, remoteID, outgoing); errors.Is(err, transport.ErrUnsupported) {
+		h.EchoCache.Remove(Echo{EchoEdit, relatedMessageID})
+		return
+	} else if err != nil {
+		h.EchoCache.Remove(Echo{EchoEdit, relatedMessageID})
+		h.Client.Logger().Error("failed to update forwarded message", "error", err, "transport", target.Transport)
+		h.publishStreamEvent(msg.Source, target, stream.Event{Type: stream.EventFailed, MessageID: msg.MessageID.String(), TargetMessageID: remoteID, Reason: "update"})
+		return
+	}
+
+	h.publishStreamEvent(msg.Source, target, stream.Event{Type: stream.EventEdited, MessageID: msg.MessageID.String(), TargetMessageID: remoteID})
+
+	if revision == 0 {
+		return
+	}
+	if err := repository.SaveRevision(h.Ctx, h.DB, target.ChannelID, msg.MessageID, revision); err != nil {
+		h.Client.Logger().Error("failed to save revision", "error", err)
+	}
+}
+
+func (h *EventHandler) OnGuildMessageDelete(e *events.GuildMessageDelete) {
+	if h.EchoCache.Take(Echo{EchoDelete, e.MessageID}) || e.Message.Author.Bot {
+		return
+	}
+
+	h.bridgeDelete(transport.Endpoint{ChannelID: e.ChannelID, Transport: transport.Discord}, e.MessageID)
+}
+
+func (h *EventHandler) bridgeDelete(source transport.Endpoint, messageID snowflake.ID) {
+	h.publishDeletes(source, []snowflake.ID{messageID})
+
+	if err := repository.DeletePreviews(h.Ctx, h.DB, []snowflake.ID{messageID}); err != nil {
+		h.Client.Logger().Error("failed to delete preview", "error", err)
+	}
+	if err := repository.DeleteContentRevisions(h.Ctx, h.DB, []snowflake.ID{messageID}); err != nil {
+		h.Client.Logger().Error("failed to delete content revisions", "error", err)
+	}
+
+	targets, err := repository.LoadRelatedEndpoints(h.Ctx, h.DB, source.ChannelID)
+	if err != nil {
+		h.Client.Logger().Error("failed to load related endpoints", "error", err)
+		return
+	}
+
+	for _, target := range targets {
+		h.Fanout.Go(target.ChannelID, func() {
+			h.deleteForwardedMessage(source, messageID, target)
+		})
+	}
+}
+
+func (h *EventHandler) deleteForwardedMessage(source transport.Endpoint, originalMessageID snowflake.ID, target transport.Endpoint) {
+	targetTransport, ok := h.Transports[target.Transport]
+	if !ok {
+		h.Client.Logger().Error("unknown transport", "transport", target.Transport, "channel_id", target.ChannelID)
+		return
+	}
+
+	relatedMessageID, err := repository.LoadRelatedMessageID(h.Ctx, h.DB, target.ChannelID, originalMessageID)
+	if err != nil {
+		h.Client.Logger().Error("failed to fetch related message ID for deletion", "error", err)
+		return
+	}
+
+	remoteID, err := h.remoteMessageID(target, relatedMessageID)
+	if err != nil {
+		h.Client.Logger().Error("failed to load remote message ID", "error", err)
+		return
+	}
+
+	// registered before deleting, as the echoed delete event may be handled before Delete returns
+	h.EchoCache.Add(Echo{EchoDelete, relatedMessageID})
+	if err := targetTransport.Delete(h.Ctx, target, remoteID); err != nil {
+		if !errors.Is(err, transport.ErrUnsupported) {
+			h.Client.Logger().Error("failed to delete forwarded message", "error", err, "transport", target.Transport)
+			h.publishStreamEvent(source, target, stream.Event{Type: stream.EventFailed, MessageID: originalMessageID.String(), TargetMessageID: remoteID, Reason: "delete"})
 		}
+		h.EchoCache.Remove(Echo{EchoDelete, relatedMessageID})
+		return
+	}
 
-		messageBuilder := discord.NewWebhookMessageCreateBuilder().
-			SetAllowedMentions(&discord.AllowedMentions{}).
-			SetUsername(e.Message.Author.Username).
-			SetContent(content.String())
+	h.publishStreamEvent(source, target, stream.Event{Type: stream.EventDeleted, MessageID: originalMessageID.String(), TargetMessageID: remoteID})
+}
 
-		if url := e.Message.Author.AvatarURL(); url != nil {
-			messageBuilder.SetAvatarURL(*url)
-		} else {
-			messageBuilder.SetAvatarURL(fmt.Sprintf("%s/embed/avatars/%d.png", discord.CDN, e.Message.Author.ID))
+func (h *EventHandler) OnGuildMessageDeleteBulk(e *GuildMessageDeleteBulk) {
+	// purges of channels that are not linked would only crowd echoes out of the cache
+	if virtualChannelKeys, err := repository.LoadVirtualChannelKeys(h.Ctx, h.DB, e.ChannelID); err != nil {
+		e.Client().Logger().Error("failed to load virtual channel keys", "error", err)
+		return
+	} else if len(virtualChannelKeys) == 0 {
+		return
+	}
+
+	source := transport.Endpoint{ChannelID: e.ChannelID, Transport: transport.Discord}
+
+	purgedMessageIDs := make([]snowflake.ID, 0, len(e.MessageIDs))
+	for _, messageID := range e.MessageIDs {
+		if !h.EchoCache.Contains(Echo{EchoDelete, messageID}) {
+			purgedMessageIDs = append(purgedMessageIDs, messageID)
 		}
+		// consumed by OnGuildMessageDelete, which disgo dispatches for every message of the bulk afterwards
+		h.EchoCache.Add(Echo{EchoDelete, messageID})
+	}
+
+	h.publishDeletes(source, purgedMessageIDs)
+
+	if err := repository.DeletePreviews(h.Ctx, h.DB, purgedMessageIDs); err != nil {
+		e.Client().Logger().Error("failed to delete previews", "error", err)
+	}
 
-		for i, attachDownloaded := range contentCommonFileAttach {
-			attach := e.Message.Attachments[attachDownloaded]
-			desc := ""
-			if attach.Description != nil {
-				desc = *attach.Description
+	targets, err := repository.LoadRelatedEndpoints(h.Ctx, h.DB, e.ChannelID)
+	if err != nil {
+		e.Client().Logger().Error("failed to load related endpoints", "error", err)
+		return
+	}
+
+	// purged copies take their originals and sibling copies with them, like purged originals take their copies
+	mappings, err := repository.LoadMessageMappings(h.Ctx, h.DB, purgedMessageIDs)
+	if err != nil {
+		e.Client().Logger().Error("failed to load message mappings for bulk deletion", "error", err)
+		return
+	}
+
+	purged := map[snowflake.ID]bool{}
+	for _, messageID := range purgedMessageIDs {
+		purged[messageID] = true
+	}
+	originalMessageIDs := slices.Clone(purgedMessageIDs)
+	for _, mapping := range mappings {
+		if !purged[mapping.Original.MessageID] {
+			originalMessageIDs = append(originalMessageIDs, mapping.Original.MessageID)
+		}
+	}
+	if err := repository.DeleteContentRevisions(h.Ctx, h.DB, originalMessageIDs); err != nil {
+		e.Client().Logger().Error("failed to delete content revisions", "error", err)
+	}
+
+	messageIDsByChannel := map[snowflake.ID][]snowflake.ID{}
+	originals := map[snowflake.ID]bool{}
+	for _, mapping := range mappings {
+		for _, ref := range []repository.MessageRef{mapping.Original, mapping.Copy} {
+			if !purged[ref.MessageID] {
+				purged[ref.MessageID] = true
+				messageIDsByChannel[ref.ChannelID] = append(messageIDsByChannel[ref.ChannelID], ref.MessageID)
 			}
-			messageBuilder.AddFile(attach.Filename, desc, bytes.NewReader(contentCommonFileBodies[i]))
+		}
+		originals[mapping.Original.MessageID] = true
+	}
+
+	for _, target := range targets {
+		if messageIDs := messageIDsByChannel[target.ChannelID]; len(messageIDs) > 0 {
+			h.Fanout.Go(target.ChannelID, func() {
+				h.deleteMessagesInBatches(source, target, messageIDs, originals)
+			})
+		}
+	}
+}
+
+// deleteMessagesInBatches bulk deletes up to 100 messages per request in Discord channels, falling back to
+// single deletions for messages too old for bulk deletion, when bulk deletion fails and on other platforms.
+// Originals in Discord channels are not webhook messages, so they are deleted by the bot itself.
+func (h *EventHandler) deleteMessagesInBatches(source, target transport.Endpoint, messageIDs []snowflake.ID, originals map[snowflake.ID]bool) {
+	targetTransport, ok := h.Transports[target.Transport]
+	if !ok {
+		h.Client.Logger().Error("unknown transport", "transport", target.Transport, "channel_id", target.ChannelID)
+		return
+	}
+
+	bulkDeletable := []snowflake.ID{}
+	singleDeletable := []snowflake.ID{}
+
+	for _, messageID := range messageIDs {
+		h.EchoCache.Add(Echo{EchoDelete, messageID})
+		if target.Transport == transport.Discord && time.Since(messageID.Time()) < bulkDeleteMaxAge {
+			bulkDeletable = append(bulkDeletable, messageID)
+		} else {
+			singleDeletable = append(singleDeletable, messageID)
+		}
+	}
+
+	for len(bulkDeletable) > 0 {
+		batch := bulkDeletable[:min(len(bulkDeletable), bulkDeleteMaxMessages)]
+		bulkDeletable = bulkDeletable[len(batch):]
+
+		if len(batch) < 2 {
+			singleDeletable = append(singleDeletable, batch...)
+			continue
 		}
 
-		forwarderClient := webhook.New(forwarderWebhook.ID(), forwarderWebhook.Token)
-		webhookMessage, err := forwarderClient.CreateMessage(messageBuilder.Build())
+		if err := h.Rest.BulkDeleteMessages(target.ChannelID, batch); err != nil {
+			h.Client.Logger().Error("failed to bulk delete forwarded messages", "error", err, "channel_id", target.ChannelID)
+			singleDeletable = append(singleDeletable, batch...)
+			continue
+		}
+
+		for _, messageID := range batch {
+			h.publishStreamEvent(source, target, stream.Event{Type: stream.EventDeleted, TargetMessageID: messageID.String()})
+		}
+	}
+
+	for _, messageID := range singleDeletable {
+		remoteID, err := h.remoteMessageID(target, messageID)
 		if err != nil {
-			e.Client().Logger().Error("failed to send message via webhook", "error", err)
+			h.Client.Logger().Error("failed to load remote message ID", "error", err)
+			continue
 		}
-		forwarderClient.Close(h.Ctx)
 
-		if err := repository.SaveMessageMapping(h.Ctx, tx, e.Message.ChannelID, e.MessageID, webhookMessage.ChannelID, webhookMessage.ID); err != nil {
-			e.Client().Logger().Error("failed to save message mapping", "error", err)
+		if target.Transport == transport.Discord && originals[messageID] {
+			err = h.Rest.DeleteMessage(target.ChannelID, messageID)
+		} else {
+			err = targetTransport.Delete(h.Ctx, target, remoteID)
 		}
+		if err != nil {
+			if !errors.Is(err, transport.ErrUnsupported) {
+				h.Client.Logger().Error("failed to delete forwarded message", "error", err, "transport", target.Transport)
+				h.publishStreamEvent(source, target, stream.Event{Type: stream.EventFailed, TargetMessageID: remoteID, Reason: "delete"})
+			}
+			h.EchoCache.Remove(Echo{EchoDelete, messageID})
+			continue
+		}
+
+		h.publishStreamEvent(source, target, stream.Event{Type: stream.EventDeleted, TargetMessageID: remoteID})
+	}
+}
+
+//=:handler:transports
+
+func (h *EventHandler) fromIncoming(endpoint transport.Endpoint, msg transport.Incoming) (bridgeMessage, bool, error) {
+	messageID, created, err := h.localMessageID(endpoint, msg.ID)
+	if err != nil {
+		return bridgeMessage{}, false, err
+	}
+
+	replyTo := (*repository.MessageRef)(nil)
+	if msg.ReplyTo != "" {
+		replyToID, err := repository.LoadLocalMessageID(h.Ctx, h.DB, endpoint.ChannelID, msg.ReplyTo)
+		if err == nil {
+			replyTo = &repository.MessageRef{ChannelID: endpoint.ChannelID, MessageID: replyToID}
+		} else if !errors.Is(err, sql.ErrNoRows) {
+			return bridgeMessage{}, false, err
+		}
+	}
+
+	return bridgeMessage{
+		Source:    endpoint,
+		MessageID: messageID,
+		RemoteID:  msg.ID,
+		AuthorKey: endpoint.Transport + ":" + msg.AuthorID,
+		Identity: authorIdentity{
+			Username:    msg.Username,
+			DisplayName: msg.Username,
+			AvatarURL:   msg.AvatarURL,
+		},
+		Origin:    msg.Origin,
+		Content:   msg.Content,
+		Body:      msg.Content,
+		ReplyTo:   replyTo,
+		Files:     msg.Files,
+		Voice:     msg.Voice,
+		Timestamp: time.Now(),
+	}, created, nil
+}
+
+func (h *EventHandler) ReceiveCreate(endpoint transport.Endpoint, msg transport.Incoming) {
+	bridgeMsg, created, err := h.fromIncoming(endpoint, msg)
+	if err != nil {
+		h.Client.Logger().Error("failed to map incoming message", "error", err, "transport", endpoint.Transport)
+		return
+	}
+	// redelivered messages, as retried by peers, and messages forwarded by the bridge itself are already mapped
+	if !created {
+		h.Client.Logger().Debug("skipping already bridged message", "transport", endpoint.Transport, "remote_id", msg.ID)
+		return
 	}
 
-	if err := tx.Commit(); err != nil {
-		e.Client().Logger().Error("failed to commit transaction", "error", err)
+	h.bridgeCreate(bridgeMsg)
+}
+
+func (h *EventHandler) ReceiveUpdate(endpoint transport.Endpoint, msg transport.Incoming) {
+	bridgeMsg, _, err := h.fromIncoming(endpoint, msg)
+	if err != nil {
+		h.Client.Logger().Error("failed to map incoming message", "error", err, "transport", endpoint.Transport)
 		return
 	}
+
+	if h.EchoCache.Take(Echo{EchoEdit, bridgeMsg.MessageID}) {
+		return
+	}
+
+	h.bridgeUpdate(bridgeMsg)
 }
 
-func (h *EventHandler) OnGuildMessageUpdate(e *events.GuildMessageUpdate) {
-	if e.Message.Author.Bot {
+func (h *EventHandler) ReceiveDelete(endpoint transport.Endpoint, remoteID string) {
+	messageID, err := repository.LoadLocalMessageID(h.Ctx, h.DB, endpoint.ChannelID, remoteID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return
+	} else if err != nil {
+		h.Client.Logger().Error("failed to load local message ID", "error", err, "transport", endpoint.Transport)
 		return
 	}
 
-	targetChannels, err := repository.LoadRelatedChannels(h.Ctx, h.DB, e.ChannelID)
+	if h.EchoCache.Take(Echo{EchoDelete, messageID}) {
+		return
+	}
+
+	h.bridgeDelete(endpoint, messageID)
+}
+
+//=:handler:sinks
+
+func sinkMessage(msg *bridgeMessage) sink.Message {
+	sinkMsg := sink.Message{
+		ID:        msg.MessageID.String(),
+		ChannelID: msg.Source.ChannelID.String(),
+		Transport: msg.Source.Transport,
+		Origin:    msg.Origin,
+		Author: &sink.Author{
+			ID:          msg.AuthorKey,
+			Username:    msg.Identity.Username,
+			DisplayName: msg.Identity.DisplayName,
+			AvatarURL:   msg.Identity.AvatarURL,
+		},
+		Content:     msg.Body,
+		Attachments: make([]sink.Attachment, 0, len(msg.Files)),
+	}
+	if msg.ReplyTo != nil {
+		sinkMsg.ReplyTo = msg.ReplyTo.MessageID.String()
+	}
+
+	for _, file := range msg.Files {
+		sinkMsg.Attachments = append(sinkMsg.Attachments, sink.Attachment{
+			Filename:    file.Name,
+			URL:         file.URL,
+			Size:        file.Size,
+			ContentType: file.ContentType,
+		})
+	}
+
+	return sinkMsg
+}
+
+// publishToSinks publishes the event to the sinks subscribed to its type whose pattern, if any, matches content.
+func (h *EventHandler) publishToSinks(sinks []repository.Sink, eventType, content string, event sink.Event) {
+	event.Type = eventType
+
+	for _, s := range sinks {
+		if s.Events != "" && !slices.Contains(strings.Split(s.Events, ","), eventType) {
+			continue
+		}
+
+		if s.Pattern != "" && eventType != sink.EventDelete {
+			pattern, err := h.sinkPattern(s.Pattern)
+			if err != nil {
+				h.Client.Logger().Error("invalid sink pattern", "error", err, "sink_id", s.ID)
+				continue
+			}
+			if !pattern.MatchString(content) {
+				continue
+			}
+		}
+
+		event.VirtualChannel = s.VirtualChannelKey
+		h.Sinks.Publish(sink.Target{URL: s.URL, Secret: s.Secret}, event)
+	}
+}
+
+// sinkPattern compiles the pattern of a sink once, as sinks are loaded again for every event.
+func (h *EventHandler) sinkPattern(expr string) (*regexp.Regexp, error) {
+	if pattern, ok := h.sinkPatterns.Load(expr); ok {
+		return pattern.(*regexp.Regexp), nil
+	}
+
+	pattern, err := regexp.Compile(expr)
 	if err != nil {
-		e.Client().Logger().Error("failed to load related channels", "error", err)
+		return nil, err
+	}
+	h.sinkPatterns.Store(expr, pattern)
+	return pattern, nil
+}
+
+func (h *EventHandler) publishDeletes(source transport.Endpoint, messageIDs []snowflake.ID) {
+	if len(messageIDs) == 0 {
+		return
+	}
+
+	sinks, err := repository.LoadSinks(h.Ctx, h.DB, source.ChannelID)
+	if err != nil {
+		h.Client.Logger().Error("failed to load sinks", "error", err)
 		return
 	}
 
-	contentCommonFooter, _, _ := processMessageAttachments(&h.Cfg, e.GenericGuildMessage, true)
+	for _, messageID := range messageIDs {
+		h.publishToSinks(sinks, sink.EventDelete, "", sink.Event{
+			Timestamp: time.Now(),
+			Message: sink.Message{
+				ID:          messageID.String(),
+				ChannelID:   source.ChannelID.String(),
+				Transport:   source.Transport,
+				Attachments: []sink.Attachment{},
+			},
+		})
+	}
+}
+
+//=:handler:stream
 
-	for _, targetChannelID := range targetChannels {
-		relatedMessageID, err := repository.LoadRelatedMessageID(h.Ctx, h.DB, targetChannelID, e.MessageID)
+func streamEndpoint(endpoint transport.Endpoint) *stream.Endpoint {
+	return &stream.Endpoint{ChannelID: endpoint.ChannelID.String(), Transport: endpoint.Transport}
+}
+
+// publishStreamEvent publishes the event to subscribers of the virtual channels the message passed through,
+// which are those linking source and target, or all virtual channels of source when there is no target.
+func (h *EventHandler) publishStreamEvent(source, target transport.Endpoint, event stream.Event) {
+	if !h.Stream.Active() {
+		return
+	}
+
+	virtualChannelKeys, err := repository.LoadVirtualChannelKeys(h.Ctx, h.DB, source.ChannelID)
+	if err != nil {
+		h.Client.Logger().Error("failed to load virtual channel keys", "error", err)
+		return
+	}
+
+	if target.ChannelID != 0 {
+		targetVirtualChannelKeys, err := repository.LoadVirtualChannelKeys(h.Ctx, h.DB, target.ChannelID)
 		if err != nil {
-			e.Client().Logger().Error("failed to fetch related message ID for update", "error", err)
+			h.Client.Logger().Error("failed to load virtual channel keys", "error", err)
+			return
+		}
+
+		virtualChannelKeys = slices.DeleteFunc(virtualChannelKeys, func(virtualChannelKey string) bool {
+			return !slices.Contains(targetVirtualChannelKeys, virtualChannelKey)
+		})
+		event.Target = streamEndpoint(target)
+	}
+
+	event.Timestamp = time.Now()
+	event.Source = streamEndpoint(source)
+
+	for _, virtualChannelKey := range virtualChannelKeys {
+		event.VirtualChannel = virtualChannelKey
+		h.Stream.Publish(event)
+	}
+}
+
+//=:handler:typing
+
+func (h *EventHandler) OnGuildMemberTypingStart(e *events.GuildMemberTypingStart) {
+	if h.Cfg.TypingRelayInterval <= 0 || e.Member.User.Bot || e.UserID == e.Client().ID() {
+		return
+	}
+
+	targets, err := repository.LoadRelatedEndpoints(h.Ctx, h.DB, e.ChannelID)
+	if err != nil {
+		e.Client().Logger().Error("failed to load related endpoints", "error", err)
+		return
+	}
+
+	now := time.Now()
+
+	for _, target := range targets {
+		if target.Transport != transport.Discord {
 			continue
 		}
 
-		forwarderWebhook, err := loadOrCreateWebhook(&h.Cfg, e.Client(), targetChannelID)
-		if err != nil {
-			e.Client().Logger().Error("failed to load or create webhook", "error", err)
+		// Discord shows a typing indicator for about 10 seconds, so one per interval covers every typist
+		if lastTypingAt, ok := h.lastTypingAt.Load(target.ChannelID); ok && now.Sub(lastTypingAt.(time.Time)) < h.Cfg.TypingRelayInterval {
 			continue
 		}
+		h.lastTypingAt.Store(target.ChannelID, now)
+
+		if err := h.Rest.SendTyping(target.ChannelID); err != nil {
+			e.Client().Logger().Error("failed to relay typing indicator", "error", err)
+		}
+	}
+}
+
+//=:handler:pins
+
+func (h *EventHandler) isOwnerGuild(e *events.GuildChannelPinsUpdate) (bool, error) {
+	ownerChannels, err := repository.LoadOwnerChannels(h.Ctx, h.DB, e.ChannelID)
+	if err != nil {
+		return false, err
+	}
+
+	for _, ownerChannelID := range ownerChannels {
+		if ownerChannel, ok := e.Client().Caches().GuildMessageChannel(ownerChannelID); ok && ownerChannel.GuildID() == e.GuildID {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
 
-		content := &strings.Builder{}
-		if err := h.tryWriteReferenceHeader(content, forwarderWebhook.GuildID, targetChannelID, e.Message.MessageReference); err != nil {
-			e.Client().Logger().Error("failed to fetch hook message ID", "error", err)
+func (h *EventHandler) propagatePin(e *events.GuildChannelPinsUpdate, messageID snowflake.ID, pinned bool) {
+	messageCopies, err := repository.LoadMessageCopies(h.Ctx, h.DB, e.ChannelID, messageID)
+	if err != nil {
+		e.Client().Logger().Error("failed to load message copies", "error", err)
+		return
+	}
+
+	for _, messageCopy := range messageCopies {
+		// copies on other platforms have no pins
+		if _, ok := e.Client().Caches().GuildMessageChannel(messageCopy.ChannelID); !ok {
+			continue
 		}
-		content.WriteString(e.Message.Content)
-		content.WriteString(contentCommonFooter)
 
-		messageBuilder := discord.NewWebhookMessageUpdateBuilder().
-			SetContent(content.String())
+		// the pins table is updated before the API call so the echoed pins update event diffs to nothing
+		if pinned {
+			err = repository.SavePin(h.Ctx, h.DB, messageCopy.ChannelID, messageCopy.MessageID)
+		} else {
+			err = repository.DeletePin(h.Ctx, h.DB, messageCopy.ChannelID, messageCopy.MessageID)
+		}
+		if err != nil {
+			e.Client().Logger().Error("failed to save pin state", "error", err)
+			continue
+		}
 
-		forwarderClient := webhook.New(forwarderWebhook.ID(), forwarderWebhook.Token)
+		if messageCopy.ChannelID == e.ChannelID {
+			continue
+		}
 
-		if _, err := forwarderClient.UpdateMessage(relatedMessageID, messageBuilder.Build()); err != nil {
-			e.Client().Logger().Error("failed to update forwarded message via webhook", "error", err)
+		if pinned {
+			err = h.Rest.PinMessage(messageCopy.ChannelID, messageCopy.MessageID)
+		} else {
+			err = h.Rest.UnpinMessage(messageCopy.ChannelID, messageCopy.MessageID)
+		}
+		if err != nil {
+			e.Client().Logger().Error("failed to propagate pin", "error", err, "channel_id", messageCopy.ChannelID, "pinned", pinned)
 		}
+	}
+}
 
-		forwarderClient.Close(h.Ctx)
+func (h *EventHandler) OnGuildChannelPinsUpdate(e *events.GuildChannelPinsUpdate) {
+	targetChannels, err := repository.LoadRelatedChannels(h.Ctx, h.DB, e.ChannelID)
+	if err != nil {
+		e.Client().Logger().Error("failed to load related channels", "error", err)
+		return
 	}
-}
 
-func (h *EventHandler) OnGuildMessageDelete(e *events.GuildMessageDelete) {
-	if e.Message.Author.Bot {
+	if len(targetChannels) == 0 {
 		return
 	}
 
-	if _, ok := h.recentDelCache.LoadAndDelete(e.MessageID); ok {
+	knownPins, err := repository.LoadPins(h.Ctx, h.DB, e.ChannelID)
+	if err != nil {
+		e.Client().Logger().Error("failed to load pins", "error", err)
 		return
 	}
 
-	targetChannels, err := repository.LoadRelatedChannels(h.Ctx, h.DB, e.ChannelID)
+	pinnedMessages, err := h.Rest.GetPinnedMessages(e.ChannelID)
 	if err != nil {
-		e.Client().Logger().Error("failed to load related channels", "error", err)
+		e.Client().Logger().Error("failed to fetch pinned messages", "error", err)
 		return
 	}
 
-	for _, targetChannelID := range targetChannels {
-		relatedMessageID, err := repository.LoadRelatedMessageID(h.Ctx, h.DB, targetChannelID, e.MessageID)
-		if err != nil {
-			e.Client().Logger().Error("failed to fetch related message ID for deletion", "error", err)
-			continue
+	// pins made before the channel was first seen are recorded without being propagated
+	if firstSeen, err := repository.SavePinChannel(h.Ctx, h.DB, e.ChannelID); err != nil {
+		e.Client().Logger().Error("failed to save pin channel", "error", err)
+		return
+	} else if firstSeen {
+		for _, pinnedMessage := range pinnedMessages {
+			if err := repository.SavePin(h.Ctx, h.DB, e.ChannelID, pinnedMessage.ID); err != nil {
+				e.Client().Logger().Error("failed to save pin state", "error", err)
+			}
+			knownPins[pinnedMessage.ID] = struct{}{}
 		}
+	}
 
-		forwarderWebhook, err := loadOrCreateWebhook(&h.Cfg, e.Client(), targetChannelID)
-		if err != nil {
-			e.Client().Logger().Error("failed to load or create webhook", "error", err)
-			continue
+	if h.Cfg.PinsFromOwnerOnly {
+		if isOwner, err := h.isOwnerGuild(e); err != nil {
+			e.Client().Logger().Error("failed to check virtual channel owner", "error", err)
+			return
+		} else if !isOwner {
+			return
 		}
+	}
 
-		forwarderClient := webhook.New(forwarderWebhook.ID(), forwarderWebhook.Token)
-
-		if err := forwarderClient.DeleteMessage(relatedMessageID); err != nil {
-			e.Client().Logger().Error("failed to delete forwarded message via webhook", "error", err)
-		} else {
-			h.recentDelCache.Store(relatedMessageID, nil)
+	for _, pinnedMessage := range pinnedMessages {
+		if _, ok := knownPins[pinnedMessage.ID]; ok {
+			delete(knownPins, pinnedMessage.ID)
+			continue
 		}
+		h.propagatePin(e, pinnedMessage.ID, true)
+	}
 
-		forwarderClient.Close(h.Ctx)
+	for unpinnedMessageID := range knownPins {
+		h.propagatePin(e, unpinnedMessageID, false)
 	}
 }
 
@@ -268,6 +1363,11 @@ func (h *EventHandler) InitCommands(appID snowflake.ID) error {
 					Name:        "note",
 					Description: "note about virtual channel",
 				},
+				discord.ApplicationCommandOptionString{
+					Name:        "name_template",
+					Description: "display name of forwarded messages, e.g. {display_name} • {guild_short}",
+					MaxLength:   json.Ptr(texts.MaxWebhookNameLength),
+				},
 			},
 			DefaultMemberPermissions: json.NewNullablePtr(discord.PermissionManageChannels),
 			Contexts:                 []discord.InteractionContextType{discord.InteractionContextTypeGuild},
@@ -297,6 +1397,138 @@ func (h *EventHandler) InitCommands(appID snowflake.ID) error {
 			DefaultMemberPermissions: json.NewNullablePtr(discord.PermissionManageChannels),
 			Contexts:                 []discord.InteractionContextType{discord.InteractionContextTypeGuild},
 		},
+		discord.SlashCommandCreate{
+			Name:        "sink",
+			Description: "manages HTTP sinks receiving messages of virtual channels",
+			Options: []discord.ApplicationCommandOption{
+				discord.ApplicationCommandOptionSubCommand{
+					Name:        "add",
+					Description: "adds HTTP sink to virtual channel linked to current channel",
+					Options: []discord.ApplicationCommandOption{
+						discord.ApplicationCommandOptionString{
+							Name:        "virtual_channel_key",
+							Description: "virtual channel key as shown by /list",
+							Required:    true,
+						},
+						discord.ApplicationCommandOptionString{
+							Name:        "url",
+							Description: "URL receiving events as signed JSON POST requests",
+							Required:    true,
+						},
+						discord.ApplicationCommandOptionString{
+							Name:        "events",
+							Description: "comma separated events to deliver: create, update, delete (default: all)",
+						},
+						discord.ApplicationCommandOptionString{
+							Name:        "pattern",
+							Description: "regular expression message content must match",
+						},
+					},
+				},
+				discord.ApplicationCommandOptionSubCommand{
+					Name:        "remove",
+					Description: "removes HTTP sink",
+					Options: []discord.ApplicationCommandOption{
+						discord.ApplicationCommandOptionInt{
+							Name:        "id",
+							Description: "sink ID as shown by /sink list",
+							Required:    true,
+						},
+					},
+				},
+				discord.ApplicationCommandOptionSubCommand{
+					Name:        "list",
+					Description: "lists HTTP sinks of virtual channels linked to current channel",
+				},
+			},
+			DefaultMemberPermissions: json.NewNullablePtr(discord.PermissionManageChannels),
+			Contexts:                 []discord.InteractionContextType{discord.InteractionContextTypeGuild},
+		},
+		discord.SlashCommandCreate{
+			Name:        "feed",
+			Description: "manages RSS and Atom feeds posting into virtual channels",
+			Options: []discord.ApplicationCommandOption{
+				discord.ApplicationCommandOptionSubCommand{
+					Name:        "add",
+					Description: "adds feed posting new entries to virtual channel linked to current channel",
+					Options: []discord.ApplicationCommandOption{
+						discord.ApplicationCommandOptionString{
+							Name:        "virtual_channel_key",
+							Description: "virtual channel key as shown by /list",
+							Required:    true,
+						},
+						discord.ApplicationCommandOptionString{
+							Name:        "url",
+							Description: "URL of RSS or Atom feed",
+							Required:    true,
+						},
+						discord.ApplicationCommandOptionString{
+							Name:        "name",
+							Description: "name entries are posted under (default: feed title)",
+						},
+						discord.ApplicationCommandOptionString{
+							Name:        "avatar_url",
+							Description: "URL of avatar entries are posted with",
+						},
+					},
+				},
+				discord.ApplicationCommandOptionSubCommand{
+					Name:        "remove",
+					Description: "removes feed",
+					Options: []discord.ApplicationCommandOption{
+						discord.ApplicationCommandOptionInt{
+							Name:        "id",
+							Description: "feed ID as shown by /feed list",
+							Required:    true,
+						},
+					},
+				},
+				discord.ApplicationCommandOptionSubCommand{
+					Name:        "list",
+					Description: "lists feeds of virtual channels linked to current channel",
+				},
+			},
+			DefaultMemberPermissions: json.NewNullablePtr(discord.PermissionManageChannels),
+			Contexts:                 []discord.InteractionContextType{discord.InteractionContextTypeGuild},
+		},
+		discord.SlashCommandCreate{
+			Name:        "token",
+			Description: "manages HTTP API tokens of virtual channels",
+			Options: []discord.ApplicationCommandOption{
+				discord.ApplicationCommandOptionSubCommand{
+					Name:        "create",
+					Description: "creates HTTP API token posting to virtual channel linked to current channel",
+					Options: []discord.ApplicationCommandOption{
+						discord.ApplicationCommandOptionString{
+							Name:        "virtual_channel_key",
+							Description: "virtual channel key as shown by /list",
+							Required:    true,
+						},
+					},
+				},
+				discord.ApplicationCommandOptionSubCommand{
+					Name:        "revoke",
+					Description: "revokes all HTTP API tokens of virtual channel linked to current channel",
+					Options: []discord.ApplicationCommandOption{
+						discord.ApplicationCommandOptionString{
+							Name:        "virtual_channel_key",
+							Description: "virtual channel key as shown by /list",
+							Required:    true,
+						},
+					},
+				},
+			},
+			DefaultMemberPermissions: json.NewNullablePtr(discord.PermissionManageChannels),
+			Contexts:                 []discord.InteractionContextType{discord.InteractionContextTypeGuild},
+		},
+		discord.MessageCommandCreate{
+			Name:     "Show edit history",
+			Contexts: []discord.InteractionContextType{discord.InteractionContextTypeGuild},
+		},
+		discord.MessageCommandCreate{
+			Name:     "Bridge info",
+			Contexts: []discord.InteractionContextType{discord.InteractionContextTypeGuild},
+		},
 	}
 
 	_, err := h.Rest.SetGlobalCommands(appID, commands)
@@ -345,11 +1577,11 @@ func (h *EventHandler) onCommandInteractionCreateList(e *events.ApplicationComma
 func (h *EventHandler) onCommandInteractionCreateLink(e *events.ApplicationCommandInteractionCreate, commandData discord.SlashCommandInteractionData) {
 	virtualChannelKey := commandData.String("virtual_channel_key")
 	note := commandData.String("note")
+	nameTemplate := commandData.String("name_template")
 
-	hash := sha256.Sum256([]byte(virtualChannelKey))
-	virtualChannelHash := hex.EncodeToString(hash[:])
+	virtualChannelHash := repository.HashVirtualChannelKey(virtualChannelKey)
 
-	query, args := dbqueries.BuildInsertLinkQuery(virtualChannelHash, e.Channel().ID(), note)
+	query, args := dbqueries.BuildInsertLinkQuery(virtualChannelHash, e.Channel().ID(), note, nameTemplate)
 	_, err := h.DB.Exec(query, args...)
 	if err != nil {
 		e.Client().Logger().Error("failed to link channel to virtual channel key", "error", err)
@@ -399,17 +1631,522 @@ func (h *EventHandler) onCommandInteractionCreateUnlinkAll(e *events.Application
 	sendSuccessMessage(e, "Success", fmt.Sprintf("Successfully unlinked %d virtual channel(s) from this channel.", rowsAffected))
 }
 
+func (h *EventHandler) onCommandInteractionCreateSinkAdd(e *events.ApplicationCommandInteractionCreate, commandData discord.SlashCommandInteractionData) {
+	virtualChannelKey := commandData.String("virtual_channel_key")
+	sinkURL := commandData.String("url")
+	pattern := commandData.String("pattern")
+
+	if !h.isLinked(e, virtualChannelKey) {
+		return
+	}
+
+	if !isHTTPURL(sinkURL) {
+		sendErrorMessage(e, "The URL must be an absolute HTTP or HTTPS URL.")
+		return
+	}
+
+	checkCtx, cancel := context.WithTimeout(h.Ctx, urlCheckTimeout)
+	defer cancel()
+	if err := sink.CheckURL(checkCtx, sinkURL); errors.Is(err, sink.ErrForbiddenAddress) {
+		sendErrorMessage(e, "The URL must not point to a loopback, private or link-local address.")
+		return
+	} else if err != nil {
+		sendErrorMessage(e, fmt.Sprintf("Could not resolve the URL: %s", err))
+		return
+	}
+
+	eventTypes := []string{}
+	for _, eventName := range strings.Split(commandData.String("events"), ",") {
+		eventName = strings.ToLower(strings.TrimSpace(eventName))
+		switch eventName {
+		case "":
+		case "create", "update", "delete":
+			eventTypes = append(eventTypes, "message."+eventName)
+		default:
+			sendErrorMessage(e, fmt.Sprintf("Unknown event `%s`, expected create, update or delete.", eventName))
+			return
+		}
+	}
+
+	if _, err := regexp.Compile(pattern); err != nil {
+		sendErrorMessage(e, fmt.Sprintf("Invalid pattern: %s", err))
+		return
+	}
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		e.Client().Logger().Error("failed to generate sink secret", "error", err)
+		sendErrorMessage(e, "Could not add the sink.")
+		return
+	}
+
+	id, err := repository.SaveSink(h.Ctx, h.DB, repository.Sink{
+		VirtualChannelKey: virtualChannelKey,
+		URL:               sinkURL,
+		Secret:            hex.EncodeToString(secret),
+		Events:            strings.Join(eventTypes, ","),
+		Pattern:           pattern,
+	})
+	if err != nil {
+		e.Client().Logger().Error("failed to save sink", "error", err)
+		sendErrorMessage(e, "Could not add the sink.")
+		return
+	}
+
+	sendSuccessMessage(e, "Success", fmt.Sprintf(
+		"Sink `%d` added to virtual channel `%s`.\nRequests are signed with secret `%s`, it is not shown again.",
+		id, virtualChannelKey, hex.EncodeToString(secret),
+	))
+}
+
+func (h *EventHandler) onCommandInteractionCreateSinkRemove(e *events.ApplicationCommandInteractionCreate, commandData discord.SlashCommandInteractionData) {
+	id := commandData.Int("id")
+
+	deleted, err := repository.DeleteSink(h.Ctx, h.DB, e.Channel().ID(), int64(id))
+	if err != nil {
+		e.Client().Logger().Error("failed to delete sink", "error", err)
+		sendErrorMessage(e, "Could not remove the sink.")
+		return
+	}
+
+	if !deleted {
+		sendErrorMessage(e, fmt.Sprintf("No sink `%d` found in virtual channels linked to this channel.", id))
+		return
+	}
+
+	sendSuccessMessage(e, "Success", fmt.Sprintf("Sink `%d` successfully removed.", id))
+}
+
+func (h *EventHandler) onCommandInteractionCreateSinkList(e *events.ApplicationCommandInteractionCreate, _ discord.SlashCommandInteractionData) {
+	sinks, err := repository.LoadSinks(h.Ctx, h.DB, e.Channel().ID())
+	if err != nil {
+		e.Client().Logger().Error("failed to load sinks", "error", err)
+		sendErrorMessage(e, "Could not retrieve the list of sinks.")
+		return
+	}
+
+	if len(sinks) == 0 {
+		sendSuccessMessage(e, "No Sinks", "No sinks are added to virtual channels linked to this channel.")
+		return
+	}
+
+	sb := strings.Builder{}
+	for _, s := range sinks {
+		sb.WriteString(fmt.Sprintf("- `%d` %s (virtual channel: `%s`", s.ID, s.URL, s.VirtualChannelKey))
+		if s.Events != "" {
+			sb.WriteString(", events: ")
+			sb.WriteString(s.Events)
+		}
+		if s.Pattern != "" {
+			sb.WriteString(", pattern: `")
+			sb.WriteString(s.Pattern)
+			sb.WriteByte('`')
+		}
+		sb.WriteString(")\n")
+	}
+
+	sendSuccessMessage(e, "Sinks", fmt.Sprintf("Sinks of virtual channels linked to this channel:\n%s", sb.String()))
+}
+
+func isHTTPURL(rawURL string) bool {
+	parsedURL, err := url.Parse(rawURL)
+	return err == nil && (parsedURL.Scheme == "http" || parsedURL.Scheme == "https") && parsedURL.Host != ""
+}
+
+func (h *EventHandler) onCommandInteractionCreateFeedAdd(e *events.ApplicationCommandInteractionCreate, commandData discord.SlashCommandInteractionData) {
+	virtualChannelKey := commandData.String("virtual_channel_key")
+	feedURL := commandData.String("url")
+	avatarURL := commandData.String("avatar_url")
+
+	if !h.isLinked(e, virtualChannelKey) {
+		return
+	}
+
+	if !isHTTPURL(feedURL) {
+		sendErrorMessage(e, "The URL must be an absolute HTTP or HTTPS URL.")
+		return
+	}
+	if avatarURL != "" && !isHTTPURL(avatarURL) {
+		sendErrorMessage(e, "The avatar URL must be an absolute HTTP or HTTPS URL.")
+		return
+	}
+
+	checkCtx, cancel := context.WithTimeout(h.Ctx, urlCheckTimeout)
+	defer cancel()
+	if err := sink.CheckURL(checkCtx, feedURL); errors.Is(err, sink.ErrForbiddenAddress) {
+		sendErrorMessage(e, "The URL must not point to a loopback, private or link-local address.")
+		return
+	} else if err != nil {
+		sendErrorMessage(e, fmt.Sprintf("Could not resolve the URL: %s", err))
+		return
+	}
+
+	id, err := repository.SaveFeed(h.Ctx, h.DB, repository.Feed{
+		VirtualChannelKey: virtualChannelKey,
+		URL:               feedURL,
+		Name:              commandData.String("name"),
+		AvatarURL:         avatarURL,
+	})
+	if err != nil {
+		e.Client().Logger().Error("failed to save feed", "error", err)
+		sendErrorMessage(e, "Could not add the feed.")
+		return
+	}
+
+	sendSuccessMessage(e, "Success", fmt.Sprintf(
+		"Feed `%d` added to virtual channel `%s`.\nEntries published from now on are posted within %s.",
+		id, virtualChannelKey, h.Cfg.FeedPollInterval,
+	))
+}
+
+func (h *EventHandler) onCommandInteractionCreateFeedRemove(e *events.ApplicationCommandInteractionCreate, commandData discord.SlashCommandInteractionData) {
+	id := commandData.Int("id")
+
+	deleted, err := repository.DeleteFeed(h.Ctx, h.DB, e.Channel().ID(), int64(id))
+	if err != nil {
+		e.Client().Logger().Error("failed to delete feed", "error", err)
+		sendErrorMessage(e, "Could not remove the feed.")
+		return
+	}
+
+	if !deleted {
+		sendErrorMessage(e, fmt.Sprintf("No feed `%d` found in virtual channels linked to this channel.", id))
+		return
+	}
+
+	if err := repository.UnlinkEndpoint(h.Ctx, h.DB, feed.Name, strconv.Itoa(id)); err != nil {
+		e.Client().Logger().Error("failed to unlink feed endpoint", "error", err)
+	}
+
+	sendSuccessMessage(e, "Success", fmt.Sprintf("Feed `%d` successfully removed.", id))
+}
+
+func (h *EventHandler) onCommandInteractionCreateFeedList(e *events.ApplicationCommandInteractionCreate, _ discord.SlashCommandInteractionData) {
+	feeds, err := repository.LoadFeeds(h.Ctx, h.DB, e.Channel().ID())
+	if err != nil {
+		e.Client().Logger().Error("failed to load feeds", "error", err)
+		sendErrorMessage(e, "Could not retrieve the list of feeds.")
+		return
+	}
+
+	if len(feeds) == 0 {
+		sendSuccessMessage(e, "No Feeds", "No feeds are added to virtual channels linked to this channel.")
+		return
+	}
+
+	sb := strings.Builder{}
+	for _, f := range feeds {
+		sb.WriteString(fmt.Sprintf("- `%d` %s (virtual channel: `%s`", f.ID, f.URL, f.VirtualChannelKey))
+		if f.Name != "" {
+			sb.WriteString(", name: ")
+			sb.WriteString(f.Name)
+		}
+		sb.WriteString(")\n")
+	}
+
+	sendSuccessMessage(e, "Feeds", fmt.Sprintf("Feeds of virtual channels linked to this channel:\n%s", sb.String()))
+}
+
+// isLinked reports whether the channel is linked to the virtual channel, responding with an error message if it is not.
+func (h *EventHandler) isLinked(e *events.ApplicationCommandInteractionCreate, virtualChannelKey string) bool {
+	virtualChannelKeys, err := repository.LoadVirtualChannelKeys(h.Ctx, h.DB, e.Channel().ID())
+	if err != nil {
+		e.Client().Logger().Error("failed to load virtual channel keys", "error", err)
+		sendErrorMessage(e, "Could not check links of the channel.")
+		return false
+	}
+	if !slices.Contains(virtualChannelKeys, virtualChannelKey) {
+		sendErrorMessage(e, fmt.Sprintf("This channel is not linked to virtual channel `%s`.", virtualChannelKey))
+		return false
+	}
+	return true
+}
+
+func (h *EventHandler) onCommandInteractionCreateTokenCreate(e *events.ApplicationCommandInteractionCreate, commandData discord.SlashCommandInteractionData) {
+	virtualChannelKey := commandData.String("virtual_channel_key")
+
+	if !h.isLinked(e, virtualChannelKey) {
+		return
+	}
+
+	token := make([]byte, 32)
+	if _, err := rand.Read(token); err != nil {
+		e.Client().Logger().Error("failed to generate API token", "error", err)
+		sendErrorMessage(e, "Could not create the token.")
+		return
+	}
+
+	if err := repository.SaveAPIToken(h.Ctx, h.DB, repository.HashAPIToken(hex.EncodeToString(token)), virtualChannelKey); err != nil {
+		e.Client().Logger().Error("failed to save API token", "error", err)
+		sendErrorMessage(e, "Could not create the token.")
+		return
+	}
+
+	sendSuccessMessage(e, "Success", fmt.Sprintf(
+		"Token for virtual channel `%s` created:\n`%s`\nIt is not shown again.",
+		virtualChannelKey, hex.EncodeToString(token),
+	))
+}
+
+func (h *EventHandler) onCommandInteractionCreateTokenRevoke(e *events.ApplicationCommandInteractionCreate, commandData discord.SlashCommandInteractionData) {
+	virtualChannelKey := commandData.String("virtual_channel_key")
+
+	if !h.isLinked(e, virtualChannelKey) {
+		return
+	}
+
+	rowsAffected, err := repository.DeleteAPITokens(h.Ctx, h.DB, virtualChannelKey)
+	if err != nil {
+		e.Client().Logger().Error("failed to delete API tokens", "error", err)
+		sendErrorMessage(e, "Could not revoke the tokens.")
+		return
+	}
+
+	if rowsAffected == 0 {
+		sendErrorMessage(e, fmt.Sprintf("No tokens found for virtual channel `%s`.", virtualChannelKey))
+		return
+	}
+
+	sendSuccessMessage(e, "Success", fmt.Sprintf("Revoked %d token(s) of virtual channel `%s`.", rowsAffected, virtualChannelKey))
+}
+
+func (h *EventHandler) onCommandInteractionCreateEditHistory(e *events.ApplicationCommandInteractionCreate, commandData discord.MessageCommandInteractionData) {
+	targetMessage := commandData.TargetMessage()
+
+	original, err := h.resolveOriginalMessage(targetMessage.ChannelID, targetMessage.ID)
+	if err != nil {
+		e.Client().Logger().Error("failed to resolve original message", "error", err)
+		sendErrorMessage(e, "Could not retrieve the edit history.")
+		return
+	}
+
+	revisions, err := repository.LoadContentRevisions(h.Ctx, h.DB, original.MessageID)
+	if err != nil {
+		e.Client().Logger().Error("failed to load content revisions", "error", err)
+		sendErrorMessage(e, "Could not retrieve the edit history.")
+		return
+	}
+
+	if len(revisions) == 0 {
+		sendErrorMessage(e, "No edit history is stored for this message.")
+		return
+	}
+
+	const title = "Edit History"
+
+	// the newest revisions are kept when the history does not fit in the embed
+	fields := make([]discord.EmbedField, 0, min(len(revisions), maxEmbedFields))
+	length := utf8.RuneCountInString(title)
+	for _, revision := range slices.Backward(revisions) {
+		if len(fields) == maxEmbedFields {
+			break
+		}
+
+		name := "Original"
+		if revision.Revision > 0 {
+			name = fmt.Sprintf("Revision %d", revision.Revision)
+		}
+
+		value := revision.Content
+		if value == "" {
+			value = "*no text content*"
+		} else if cut := texts.NthRune(value, maxEmbedFieldValueLength-1); cut < len(value) {
+			value = value[:cut] + "…"
+		}
+
+		field := discord.EmbedField{
+			Name:  fmt.Sprintf("%s · <t:%d:f>", name, revision.EditedAt.Unix()),
+			Value: value,
+		}
+		length += utf8.RuneCountInString(field.Name) + utf8.RuneCountInString(field.Value)
+		if length > maxEmbedLength {
+			break
+		}
+		fields = append(fields, field)
+	}
+	slices.Reverse(fields)
+
+	if err := e.CreateMessage(discord.NewMessageCreateBuilder().
+		SetEmbeds(discord.Embed{
+			Title:  title,
+			Fields: fields,
+			Color:  0x5865F2,
+		}).
+		SetAllowedMentions(&discord.AllowedMentions{}).
+		SetEphemeral(true).
+		Build(),
+	); err != nil {
+		e.Client().Logger().Error("failed to send message", "error", err)
+	}
+}
+
+// canView reports whether the user is a member of the channel's guild allowed to read the channel.
+// Members of other guilds are fetched once per guild and remembered in members.
+func (h *EventHandler) canView(e *events.ApplicationCommandInteractionCreate, channelID snowflake.ID, members map[snowflake.ID]*discord.Member) (discord.GuildMessageChannel, bool) {
+	channel, ok := e.Client().Caches().GuildMessageChannel(channelID)
+	if !ok {
+		return nil, false
+	}
+
+	member, ok := members[channel.GuildID()]
+	if !ok {
+		fetchedMember, err := h.Rest.GetMember(channel.GuildID(), e.User().ID)
+		if err == nil {
+			member = fetchedMember
+		}
+		members[channel.GuildID()] = member
+	}
+	if member == nil {
+		return nil, false
+	}
+
+	permissions := e.Client().Caches().MemberPermissionsInChannel(channel, *member)
+	return channel, permissions.Has(discord.PermissionViewChannel, discord.PermissionReadMessageHistory)
+}
+
+func messageURL(guildID, channelID, messageID snowflake.ID) string {
+	return fmt.Sprintf("https://discord.com/channels/%s/%s/%s", guildID, channelID, messageID)
+}
+
+func (h *EventHandler) onCommandInteractionCreateBridgeInfo(e *events.ApplicationCommandInteractionCreate, commandData discord.MessageCommandInteractionData) {
+	targetMessage := commandData.TargetMessage()
+
+	if err := e.DeferCreateMessage(true); err != nil {
+		e.Client().Logger().Error("failed to defer response", "error", err)
+		return
+	}
+
+	respond := func(embed discord.Embed) {
+		if _, err := h.Rest.UpdateInteractionResponse(e.ApplicationID(), e.Token(), discord.NewMessageUpdateBuilder().
+			SetEmbeds(embed).
+			SetAllowedMentions(&discord.AllowedMentions{}).
+			Build(),
+		); err != nil {
+			e.Client().Logger().Error("failed to send message", "error", err)
+		}
+	}
+
+	messageCopies, err := repository.LoadMessageCopies(h.Ctx, h.DB, targetMessage.ChannelID, targetMessage.ID)
+	if err != nil {
+		e.Client().Logger().Error("failed to load message copies", "error", err)
+		respond(discord.Embed{Title: "Error", Description: "Could not retrieve bridge info.", Color: 0xFF0000})
+		return
+	}
+
+	if len(messageCopies) < 2 {
+		respond(discord.Embed{Title: "Error", Description: "This message is not bridged.", Color: 0xFF0000})
+		return
+	}
+
+	original := messageCopies[0]
+	members := map[snowflake.ID]*discord.Member{}
+	if member := e.Member(); member != nil {
+		invoker := member.Member
+		invoker.GuildID = *e.GuildID()
+		members[invoker.GuildID] = &invoker
+	}
+
+	authorID, _, err := repository.LoadPreview(h.Ctx, h.DB, original.MessageID)
+	if err != nil {
+		if originalMessage, err := h.Rest.GetMessage(original.ChannelID, original.MessageID); err == nil {
+			authorID = originalMessage.Author.ID
+		}
+	}
+
+	sb := strings.Builder{}
+
+	sb.WriteString("**Origin:** ")
+	if channel, ok := h.canView(e, original.ChannelID, members); ok {
+		if guild, ok := e.Client().Caches().Guild(channel.GuildID()); ok {
+			sb.WriteString(guild.Name)
+			sb.WriteString(" · ")
+		}
+		sb.WriteString(messageURL(channel.GuildID(), original.ChannelID, original.MessageID))
+	} else {
+		sb.WriteString("a channel you cannot access")
+	}
+	sb.WriteByte('\n')
+
+	if authorID != 0 {
+		sb.WriteString("**Author:** <@")
+		sb.WriteString(authorID.String())
+		sb.WriteString("> (`")
+		sb.WriteString(authorID.String())
+		sb.WriteString("`)\n")
+	}
+
+	sb.WriteString("**Copies:**\n")
+	hiddenCopies := 0
+	for _, messageCopy := range messageCopies[1:] {
+		channel, ok := h.canView(e, messageCopy.ChannelID, members)
+		if !ok {
+			hiddenCopies++
+			continue
+		}
+
+		sb.WriteString("- ")
+		if guild, ok := e.Client().Caches().Guild(channel.GuildID()); ok {
+			sb.WriteString(guild.Name)
+			sb.WriteString(" · ")
+		}
+		sb.WriteString(messageURL(channel.GuildID(), messageCopy.ChannelID, messageCopy.MessageID))
+		sb.WriteByte('\n')
+	}
+	if hiddenCopies > 0 {
+		sb.WriteString(fmt.Sprintf("-# %d more in channels you cannot access\n", hiddenCopies))
+	}
+
+	respond(discord.Embed{
+		Title:       "Bridge Info",
+		Description: sb.String(),
+		Color:       0x5865F2,
+	})
+}
+
 func (h *EventHandler) OnCommandInteractionCreate(e *events.ApplicationCommandInteractionCreate) {
-	commandData := e.SlashCommandInteractionData()
-
-	switch commandData.CommandName() {
-	case "link":
-		h.onCommandInteractionCreateLink(e, commandData)
-	case "unlink":
-		h.onCommandInteractionCreateUnlink(e, commandData)
-	case "unlink_all":
-		h.onCommandInteractionCreateUnlinkAll(e, commandData)
-	case "list":
-		h.onCommandInteractionCreateList(e, commandData)
+	switch commandData := e.Data.(type) {
+	case discord.SlashCommandInteractionData:
+		switch commandData.CommandName() {
+		case "link":
+			h.onCommandInteractionCreateLink(e, commandData)
+		case "unlink":
+			h.onCommandInteractionCreateUnlink(e, commandData)
+		case "unlink_all":
+			h.onCommandInteractionCreateUnlinkAll(e, commandData)
+		case "list":
+			h.onCommandInteractionCreateList(e, commandData)
+		case "sink":
+			switch *commandData.SubCommandName {
+			case "add":
+				h.onCommandInteractionCreateSinkAdd(e, commandData)
+			case "remove":
+				h.onCommandInteractionCreateSinkRemove(e, commandData)
+			case "list":
+				h.onCommandInteractionCreateSinkList(e, commandData)
+			}
+		case "feed":
+			switch *commandData.SubCommandName {
+			case "add":
+				h.onCommandInteractionCreateFeedAdd(e, commandData)
+			case "remove":
+				h.onCommandInteractionCreateFeedRemove(e, commandData)
+			case "list":
+				h.onCommandInteractionCreateFeedList(e, commandData)
+			}
+		case "token":
+			switch *commandData.SubCommandName {
+			case "create":
+				h.onCommandInteractionCreateTokenCreate(e, commandData)
+			case "revoke":
+				h.onCommandInteractionCreateTokenRevoke(e, commandData)
+			}
+		}
+	case discord.MessageCommandInteractionData:
+		switch commandData.CommandName() {
+		case "Show edit history":
+			h.onCommandInteractionCreateEditHistory(e, commandData)
+		case "Bridge info":
+			h.onCommandInteractionCreateBridgeInfo(e, commandData)
+		}
 	}
 }
@@ -1,26 +1,67 @@
 package handler
 
 import (
+	"errors"
+	"fmt"
 	"io"
-	"net/http"
+	"log/slog"
+	"slices"
 	"strings"
+	"time"
 
-	"github.com/disgoorg/disgo/bot"
+	"github.com/disgoorg/disgo/cache"
 	"github.com/disgoorg/disgo/discord"
 	"github.com/disgoorg/disgo/events"
 	"github.com/disgoorg/snowflake/v2"
 	"github.com/mandriota/bridge-discord-bot/internal/config"
+	"github.com/mandriota/bridge-discord-bot/internal/sink"
+	"github.com/mandriota/bridge-discord-bot/internal/transport"
 )
 
-func processMessageAttachments(cfg *config.Config, e *events.GenericGuildMessage, onlyFooter bool) (footer string, attach []uint8, bodies [][]byte) {
+// messageAttachments returns attachments of the message followed by attachments of its forwarded snapshots.
+func messageAttachments(msg discord.Message) []discord.Attachment {
+	attachments := slices.Clone(msg.Attachments)
+	for _, snapshot := range msg.MessageSnapshots {
+		attachments = append(attachments, snapshot.Message.Attachments...)
+	}
+	return attachments
+}
+
+func discordFiles(attachments []discord.Attachment) []transport.File {
+	files := make([]transport.File, 0, len(attachments))
+	for _, attach := range attachments {
+		file := transport.File{
+			Name:         attach.Filename,
+			URL:          attach.URL,
+			Size:         attach.Size,
+			DurationSecs: attach.DurationSecs,
+			Waveform:     attach.Waveform,
+		}
+		if attach.Description != nil {
+			file.Description = *attach.Description
+		}
+		if attach.ContentType != nil {
+			file.ContentType = *attach.ContentType
+		}
+		files = append(files, file)
+	}
+	return files
+}
+
+const attachmentDownloadTimeout = 30 * time.Second
+
+// attachmentClient downloads attachments, whose URLs come from other transports and API clients too.
+var attachmentClient = sink.NewClient(attachmentDownloadTimeout)
+
+// processMessageAttachments links files over the size limit in the footer and downloads the others.
+func processMessageAttachments(cfg *config.Config, logger *slog.Logger, files []transport.File, onlyFooter bool) (footer string, downloaded []transport.File) {
 	contentCommonFooter := strings.Builder{}
-	contentCommonFileAttach := []uint8{}
-	contentCommonFileBodies := [][]byte{}
+	contentCommonFiles := []transport.File{}
 
-	for i, attach := range e.Message.Attachments {
-		if attach.Size > cfg.MaxAttachmentSize {
+	for _, file := range files {
+		if file.Size > cfg.MaxAttachmentSize {
 			contentCommonFooter.WriteByte('\n')
-			contentCommonFooter.WriteString(attach.URL)
+			contentCommonFooter.WriteString(file.URL)
 			continue
 		}
 
@@ -28,39 +69,85 @@ func processMessageAttachments(cfg *config.Config, e *events.GenericGuildMessage
 			continue
 		}
 
-		resp, err := http.Get(attach.URL)
-		if err != nil {
-			e.Client().Logger().Error("failed to download attachment", "error", err)
+		if file.Body != nil {
+			contentCommonFiles = append(contentCommonFiles, file)
 			continue
 		}
 
-		text, err := io.ReadAll(resp.Body)
+		body, err := downloadAttachment(file.URL, cfg.MaxAttachmentSize)
+		if errors.Is(err, errAttachmentTooLarge) {
+			// the declared size was wrong
+			contentCommonFooter.WriteByte('\n')
+			contentCommonFooter.WriteString(file.URL)
+			continue
+		}
 		if err != nil {
-			e.Client().Logger().Error("failed to download attachment", "error", err)
-		} else {
-			contentCommonFileBodies = append(contentCommonFileBodies, text)
-			contentCommonFileAttach = append(contentCommonFileAttach, uint8(i))
+			logger.Error("failed to download attachment", "error", err, "url", file.URL)
+			continue
 		}
-		resp.Body.Close()
+
+		file.Body = body
+		contentCommonFiles = append(contentCommonFiles, file)
 	}
-	return contentCommonFooter.String(), contentCommonFileAttach, contentCommonFileBodies
+	return contentCommonFooter.String(), contentCommonFiles
 }
 
-func loadOrCreateWebhook(cfg *config.Config, client bot.Client, channelID snowflake.ID) (*discord.IncomingWebhook, error) {
-	webhooks, err := client.Rest().GetWebhooks(channelID)
+var errAttachmentTooLarge = errors.New("attachment too large")
+
+func downloadAttachment(rawURL string, maxSize int) ([]byte, error) {
+	resp, err := attachmentClient.Get(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("failed to download attachment: %s", resp.Status)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, int64(maxSize)+1))
 	if err != nil {
 		return nil, err
 	}
+	if len(body) > maxSize {
+		return nil, errAttachmentTooLarge
+	}
+	return body, nil
+}
+
+type authorIdentity struct {
+	Username    string
+	DisplayName string
+	AvatarURL   string
+}
+
+// resolveAuthorIdentity prefers guild nickname over global name over username,
+// and guild avatar over user avatar over default avatar.
+func resolveAuthorIdentity(caches cache.Caches, guildID snowflake.ID, message discord.Message) authorIdentity {
+	member := message.Member
+	if member == nil {
+		if cachedMember, ok := caches.Member(guildID, message.Author.ID); ok {
+			member = &cachedMember
+		}
+	}
 
-	for _, webhook := range webhooks {
-		if webhook, ok := webhook.(discord.IncomingWebhook); ok && webhook.ApplicationID != nil && *webhook.ApplicationID == client.ApplicationID() {
-			return &webhook, nil
+	if member == nil {
+		return authorIdentity{
+			Username:    message.Author.Username,
+			DisplayName: message.Author.EffectiveName(),
+			AvatarURL:   message.Author.EffectiveAvatarURL(),
 		}
 	}
 
-	return client.Rest().CreateWebhook(channelID, discord.WebhookCreate{
-		Name: cfg.ForwarderHookName,
-	})
+	resolvedMember := *member
+	resolvedMember.User = message.Author
+	resolvedMember.GuildID = guildID
+
+	return authorIdentity{
+		Username:    message.Author.Username,
+		DisplayName: resolvedMember.EffectiveName(),
+		AvatarURL:   resolvedMember.EffectiveAvatarURL(),
+	}
 }
 
 func sendErrorMessage(e *events.ApplicationCommandInteractionCreate, description string) {
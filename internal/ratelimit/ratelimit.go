@@ -0,0 +1,97 @@
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+type bucket struct {
+	tokens   float64
+	last     time.Time
+	notified bool
+}
+
+type Limiter struct {
+	burst  float64
+	refill time.Duration
+
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	pruneSize int
+}
+
+func New(burst int, refill time.Duration) *Limiter {
+	if burst <= 0 || refill <= 0 {
+		return nil
+	}
+
+	return &Limiter{
+		burst:     float64(burst),
+		refill:    refill,
+		buckets:   map[string]*bucket{},
+		pruneSize: 64,
+	}
+}
+
+// Allow takes a token from the bucket identified by key.
+// notify is true only for the first denial after the bucket was last allowed,
+// so callers can tell the sender once per throttling episode.
+func (l *Limiter) Allow(key string) (allowed, notify bool) {
+	if l == nil {
+		return true, false
+	}
+
+	now := time.Now()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: l.burst, last: now}
+		l.buckets[key] = b
+		l.tryPrune(now)
+	}
+
+	b.tokens = min(l.burst, b.tokens+float64(now.Sub(b.last))/float64(l.refill))
+	b.last = now
+
+	if b.tokens >= 1 {
+		b.tokens--
+		b.notified = false
+		return true, false
+	}
+
+	notify = !b.notified
+	b.notified = true
+	return false, notify
+}
+
+// Refund returns a token taken by Allow, for callers that end up not acting on it.
+func (l *Limiter) Refund(key string) {
+	if l == nil {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if b, ok := l.buckets[key]; ok {
+		b.tokens = min(l.burst, b.tokens+1)
+	}
+}
+
+func (l *Limiter) tryPrune(now time.Time) {
+	if len(l.buckets) < l.pruneSize {
+		return
+	}
+
+	fullAfter := time.Duration(l.burst * float64(l.refill))
+	for key, b := range l.buckets {
+		if now.Sub(b.last) >= fullAfter {
+			delete(l.buckets, key)
+		}
+	}
+
+	l.pruneSize = max(64, len(l.buckets)*2)
+}
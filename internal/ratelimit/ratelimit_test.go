@@ -0,0 +1,53 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAllow(t *testing.T) {
+	l := New(2, time.Hour)
+
+	for i, want := range []struct{ allowed, notify bool }{
+		{true, false},
+		{true, false},
+		{false, true},
+		{false, false},
+	} {
+		if allowed, notify := l.Allow("a"); allowed != want.allowed || notify != want.notify {
+			t.Errorf("call %d: Allow = %v, %v, want %v, %v", i, allowed, notify, want.allowed, want.notify)
+		}
+	}
+
+	if allowed, _ := l.Allow("b"); !allowed {
+		t.Error("buckets are not independent")
+	}
+}
+
+func TestRefund(t *testing.T) {
+	l := New(1, time.Hour)
+
+	l.Allow("a")
+	l.Refund("a")
+	if allowed, _ := l.Allow("a"); !allowed {
+		t.Error("refunded token was not available")
+	}
+
+	// refunds never exceed the burst
+	l.Refund("a")
+	l.Refund("a")
+	l.Allow("a")
+	if allowed, _ := l.Allow("a"); allowed {
+		t.Error("refunds exceeded the burst")
+	}
+
+	l.Refund("unknown")
+}
+
+func TestNilLimiter(t *testing.T) {
+	l := New(0, time.Hour)
+	if allowed, notify := l.Allow("a"); !allowed || notify {
+		t.Error("disabled limiter denied")
+	}
+	l.Refund("a")
+}
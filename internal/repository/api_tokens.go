@@ -0,0 +1,61 @@
+package repository
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+
+	"github.com/huandu/go-sqlbuilder"
+)
+
+func HashAPIToken(token string) string {
+	hash := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(hash[:])
+}
+
+func CreateAPITokensTable(ctx context.Context, tx *sql.Tx) error {
+	createAPITokensTableQuery, _ := sqlbuilder.CreateTable("api_tokens").
+		IfNotExists().
+		Define("token_hash", "TEXT", "PRIMARY KEY").
+		Define("virtual_channel_key", "TEXT", "NOT NULL").
+		BuildWithFlavor(sqlbuilder.SQLite)
+
+	_, err := tx.ExecContext(ctx, createAPITokensTableQuery)
+	return err
+}
+
+func SaveAPIToken(ctx context.Context, db *sql.DB, tokenHash, virtualChannelKey string) error {
+	query, args := sqlbuilder.SQLite.NewInsertBuilder().
+		InsertInto("api_tokens").
+		Cols("token_hash", "virtual_channel_key").
+		Values(tokenHash, virtualChannelKey).
+		Build()
+
+	_, err := db.ExecContext(ctx, query, args...)
+	return err
+}
+
+func LoadAPITokenVirtualChannelKey(ctx context.Context, db *sql.DB, tokenHash string) (virtualChannelKey string, err error) {
+	selectB := sqlbuilder.NewSelectBuilder()
+	query, args := selectB.Select("virtual_channel_key").
+		From("api_tokens").
+		Where(selectB.Equal("token_hash", tokenHash)).
+		BuildWithFlavor(sqlbuilder.SQLite)
+
+	err = db.QueryRowContext(ctx, query, args...).Scan(&virtualChannelKey)
+	return virtualChannelKey, err
+}
+
+func DeleteAPITokens(ctx context.Context, db *sql.DB, virtualChannelKey string) (int64, error) {
+	deleteB := sqlbuilder.NewDeleteBuilder()
+	query, args := deleteB.DeleteFrom("api_tokens").
+		Where(deleteB.Equal("virtual_channel_key", virtualChannelKey)).
+		BuildWithFlavor(sqlbuilder.SQLite)
+
+	res, err := db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
@@ -30,7 +30,7 @@ func LoadAuthorID(ctx context.Context, db *sql.DB, username string) (id snowflak
 	return id, db.QueryRowContext(ctx, query, args...).Scan(&id)
 }
 
-func SaveAuthorMapping(ctx context.Context, tx *sql.Tx, username string, id snowflake.ID) error {
+func SaveAuthorMapping(ctx context.Context, tx Execer, username string, id snowflake.ID) error {
 	query, args := sqlbuilder.SQLite.NewInsertBuilder().
 		InsertIgnoreInto("authors").
 		Cols("username", "id").
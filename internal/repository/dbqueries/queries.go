@@ -5,12 +5,14 @@ import (
 	"github.com/huandu/go-sqlbuilder"
 )
 
-func BuildInsertLinkQuery(virtualChannelKey string, channelID snowflake.ID, note string) (string, []any) {
+func BuildInsertLinkQuery(virtualChannelKey string, channelID snowflake.ID, note, nameTemplate string) (string, []any) {
 	insertB := sqlbuilder.SQLite.NewInsertBuilder()
 
-	query, args := insertB.InsertIgnoreInto("links").
-		Cols("virtual_channel_key", "channel_id", "note").
-		Values(virtualChannelKey, channelID, note).
+	// updated in place, as the first linked channel of a virtual channel is found by rowid
+	query, args := insertB.InsertInto("links").
+		Cols("virtual_channel_key", "channel_id", "note", "name_template").
+		Values(virtualChannelKey, channelID, note, nameTemplate).
+		SQL("ON CONFLICT (virtual_channel_key, channel_id) DO UPDATE SET note = excluded.note, name_template = excluded.name_template").
 		BuildWithFlavor(sqlbuilder.SQLite)
 
 	return query, args
@@ -0,0 +1,201 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/disgoorg/snowflake/v2"
+	"github.com/huandu/go-sqlbuilder"
+)
+
+type Feed struct {
+	ID                int64
+	VirtualChannelKey string
+	URL               string
+	// Name and AvatarURL are the identity entries are posted under, Name defaults to the title of the feed.
+	Name      string
+	AvatarURL string
+	// Primed is set once entries present when the feed was added have been recorded without posting them.
+	Primed bool
+}
+
+func CreateFeedsTable(ctx context.Context, tx *sql.Tx) error {
+	createFeedsTableQuery, _ := sqlbuilder.CreateTable("feeds").
+		IfNotExists().
+		Define("id", "INTEGER", "PRIMARY KEY").
+		Define("virtual_channel_key", "TEXT", "NOT NULL").
+		Define("url", "TEXT", "NOT NULL").
+		Define("name", "TEXT", "NOT NULL", "DEFAULT ''").
+		Define("avatar_url", "TEXT", "NOT NULL", "DEFAULT ''").
+		Define("primed", "INT", "NOT NULL", "DEFAULT 0").
+		BuildWithFlavor(sqlbuilder.SQLite)
+
+	_, err := tx.ExecContext(ctx, createFeedsTableQuery)
+	return err
+}
+
+// CreateFeedEntriesTable creates the table of GUIDs of feed entries already posted.
+func CreateFeedEntriesTable(ctx context.Context, tx *sql.Tx) error {
+	createFeedEntriesTableQuery, _ := sqlbuilder.CreateTable("feed_entries").
+		IfNotExists().
+		Define("feed_id", "INT", "NOT NULL").
+		Define("guid", "TEXT", "NOT NULL").
+		Define("PRIMARY KEY", "(feed_id, guid)").
+		BuildWithFlavor(sqlbuilder.SQLite)
+
+	_, err := tx.ExecContext(ctx, createFeedEntriesTableQuery)
+	return err
+}
+
+func scanFeeds(rows *sql.Rows) ([]Feed, error) {
+	defer rows.Close()
+
+	feed := Feed{}
+	feeds := []Feed{}
+
+	for rows.Next() {
+		if err := rows.Scan(&feed.ID, &feed.VirtualChannelKey, &feed.URL, &feed.Name, &feed.AvatarURL, &feed.Primed); err != nil {
+			return nil, fmt.Errorf("failed to scan feed: %w", err)
+		}
+		feeds = append(feeds, feed)
+	}
+
+	return feeds, nil
+}
+
+func LoadAllFeeds(ctx context.Context, db *sql.DB) ([]Feed, error) {
+	query, args := sqlbuilder.NewSelectBuilder().
+		Select("id", "virtual_channel_key", "url", "name", "avatar_url", "primed").
+		From("feeds").
+		OrderBy("id").
+		BuildWithFlavor(sqlbuilder.SQLite)
+
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch feeds: %w", err)
+	}
+	return scanFeeds(rows)
+}
+
+// LoadFeeds returns feeds of every virtual channel the channel is linked to.
+func LoadFeeds(ctx context.Context, db *sql.DB, channelID snowflake.ID) ([]Feed, error) {
+	queryB := sqlbuilder.NewSelectBuilder()
+	subqueryB := sqlbuilder.NewSelectBuilder()
+
+	queryB.Select("id", "virtual_channel_key", "url", "name", "avatar_url", "primed").
+		From("feeds").
+		Where(queryB.In("virtual_channel_key", subqueryB)).
+		OrderBy("id")
+
+	subqueryB.Select("virtual_channel_key").
+		From("links").
+		Where(subqueryB.Equal("channel_id", channelID))
+
+	query, args := queryB.BuildWithFlavor(sqlbuilder.SQLite)
+
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch feeds: %w", err)
+	}
+	return scanFeeds(rows)
+}
+
+func SaveFeed(ctx context.Context, db *sql.DB, feed Feed) (id int64, err error) {
+	query, args := sqlbuilder.SQLite.NewInsertBuilder().
+		InsertInto("feeds").
+		Cols("virtual_channel_key", "url", "name", "avatar_url").
+		Values(feed.VirtualChannelKey, feed.URL, feed.Name, feed.AvatarURL).
+		Build()
+
+	res, err := db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return 0, err
+	}
+	return res.LastInsertId()
+}
+
+func SaveFeedPrimed(ctx context.Context, db *sql.DB, id int64) error {
+	updateB := sqlbuilder.NewUpdateBuilder()
+	query, args := updateB.Update("feeds").
+		Set(updateB.Assign("primed", 1)).
+		Where(updateB.Equal("id", id)).
+		BuildWithFlavor(sqlbuilder.SQLite)
+
+	_, err := db.ExecContext(ctx, query, args...)
+	return err
+}
+
+// DeleteFeed deletes a feed of a virtual channel the channel is linked to, along with its entries.
+func DeleteFeed(ctx context.Context, db *sql.DB, channelID snowflake.ID, id int64) (deleted bool, err error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	deleteB := sqlbuilder.NewDeleteBuilder()
+	subqueryB := sqlbuilder.NewSelectBuilder()
+
+	deleteB.DeleteFrom("feeds").
+		Where(
+			deleteB.Equal("id", id),
+			deleteB.In("virtual_channel_key", subqueryB),
+		)
+
+	subqueryB.Select("virtual_channel_key").
+		From("links").
+		Where(subqueryB.Equal("channel_id", channelID))
+
+	query, args := deleteB.BuildWithFlavor(sqlbuilder.SQLite)
+
+	res, err := tx.ExecContext(ctx, query, args...)
+	if err != nil {
+		return false, err
+	}
+
+	if rowsAffected, err := res.RowsAffected(); err != nil || rowsAffected == 0 {
+		return false, err
+	}
+
+	entriesDeleteB := sqlbuilder.NewDeleteBuilder()
+	query, args = entriesDeleteB.DeleteFrom("feed_entries").
+		Where(entriesDeleteB.Equal("feed_id", id)).
+		BuildWithFlavor(sqlbuilder.SQLite)
+
+	if _, err := tx.ExecContext(ctx, query, args...); err != nil {
+		return false, err
+	}
+
+	return true, tx.Commit()
+}
+
+// SaveFeedEntry records the entry of the feed as posted, reporting whether it was not recorded before.
+func SaveFeedEntry(ctx context.Context, db *sql.DB, feedID int64, guid string) (saved bool, err error) {
+	query, args := sqlbuilder.SQLite.NewInsertBuilder().
+		InsertIgnoreInto("feed_entries").
+		Cols("feed_id", "guid").
+		Values(feedID, guid).
+		Build()
+
+	res, err := db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return false, err
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	return rowsAffected > 0, err
+}
+
+func DeleteFeedEntry(ctx context.Context, db *sql.DB, feedID int64, guid string) error {
+	deleteB := sqlbuilder.NewDeleteBuilder()
+	query, args := deleteB.DeleteFrom("feed_entries").
+		Where(
+			deleteB.Equal("feed_id", feedID),
+			deleteB.Equal("guid", guid),
+		).
+		BuildWithFlavor(sqlbuilder.SQLite)
+
+	_, err := db.ExecContext(ctx, query, args...)
+	return err
+}
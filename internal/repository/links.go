@@ -2,24 +2,47 @@ package repository
 
 import (
 	"context"
+	"crypto/sha256"
 	"database/sql"
+	"encoding/hex"
+	"errors"
 	"fmt"
 
 	"github.com/disgoorg/snowflake/v2"
 	"github.com/huandu/go-sqlbuilder"
+	"github.com/mandriota/bridge-discord-bot/internal/transport"
 )
 
+func HashVirtualChannelKey(virtualChannelKey string) string {
+	hash := sha256.Sum256([]byte(virtualChannelKey))
+	return hex.EncodeToString(hash[:])
+}
+
 func CreateLinksTable(ctx context.Context, tx *sql.Tx) error {
 		createLinksTableQuery, _ := sqlbuilder.CreateTable("links").
 		IfNotExists().
 		Define("virtual_channel_key", "TEXT", "NOT NULL").
 		Define("channel_id", "INT", "NOT NULL").
 		Define("note", "TEXT", "NOT NULL").
+		Define("name_template", "TEXT", "NOT NULL", "DEFAULT ''").
+		Define("transport", "TEXT", "NOT NULL", "DEFAULT '"+transport.Discord+"'").
+		Define("address", "TEXT", "NOT NULL", "DEFAULT ''").
 		Define("PRIMARY KEY", "(virtual_channel_key, channel_id)").
 		BuildWithFlavor(sqlbuilder.SQLite)
 
-	_, err := tx.ExecContext(ctx, createLinksTableQuery)
-	return err
+	if _, err := tx.ExecContext(ctx, createLinksTableQuery); err != nil {
+		return err
+	}
+
+	if err := addColumnIfNotExists(ctx, tx, "links", "name_template", "TEXT", "NOT NULL", "DEFAULT ''"); err != nil {
+		return err
+	}
+
+	if err := addColumnIfNotExists(ctx, tx, "links", "transport", "TEXT", "NOT NULL", "DEFAULT '"+transport.Discord+"'"); err != nil {
+		return err
+	}
+
+	return addColumnIfNotExists(ctx, tx, "links", "address", "TEXT", "NOT NULL", "DEFAULT ''")
 }
 
 func LoadRelatedChannels(ctx context.Context, db *sql.DB, channelID snowflake.ID) ([]snowflake.ID, error) {
@@ -57,3 +80,183 @@ func LoadRelatedChannels(ctx context.Context, db *sql.DB, channelID snowflake.ID
 
 	return relatedChannelsID, nil
 }
+
+func LoadRelatedEndpoints(ctx context.Context, db *sql.DB, channelID snowflake.ID) ([]transport.Endpoint, error) {
+	queryB := sqlbuilder.NewSelectBuilder()
+	subqueryB := sqlbuilder.NewSelectBuilder()
+
+	queryB.Select("channel_id", "transport", "address").
+		Distinct().
+		From("links").
+		Where(
+			queryB.In("virtual_channel_key", subqueryB),
+			queryB.NotEqual("channel_id", channelID),
+		)
+
+	subqueryB.Select("virtual_channel_key").
+		From("links").
+		Where(subqueryB.Equal("channel_id", channelID))
+
+	query, args := queryB.BuildWithFlavor(sqlbuilder.SQLite)
+
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch related endpoints: %w", err)
+	}
+	defer rows.Close()
+
+	endpoint := transport.Endpoint{}
+	endpoints := []transport.Endpoint{}
+
+	for rows.Next() {
+		if err := rows.Scan(&endpoint.ChannelID, &endpoint.Transport, &endpoint.Address); err != nil {
+			return nil, fmt.Errorf("failed to scan related endpoint: %w", err)
+		}
+		endpoints = append(endpoints, endpoint)
+	}
+
+	return endpoints, nil
+}
+
+// LoadEndpoint returns the endpoint of a transport by its address, or sql.ErrNoRows if it is not linked.
+func LoadEndpoint(ctx context.Context, db *sql.DB, transportName, address string) (endpoint transport.Endpoint, err error) {
+	selectB := sqlbuilder.NewSelectBuilder()
+	query, args := selectB.Select("channel_id", "transport", "address").
+		From("links").
+		Where(
+			selectB.Equal("transport", transportName),
+			selectB.Equal("address", address),
+		).
+		Limit(1).
+		BuildWithFlavor(sqlbuilder.SQLite)
+
+	return endpoint, db.QueryRowContext(ctx, query, args...).Scan(&endpoint.ChannelID, &endpoint.Transport, &endpoint.Address)
+}
+
+// LinkEndpoint links an endpoint on another platform to a virtual channel,
+// reusing the channel ID the endpoint got when it was linked first.
+func LinkEndpoint(ctx context.Context, db *sql.DB, virtualChannelKey, transportName, address, note string) (transport.Endpoint, error) {
+	endpoint, err := LoadEndpoint(ctx, db, transportName, address)
+	if errors.Is(err, sql.ErrNoRows) {
+		endpoint = transport.Endpoint{
+			ChannelID: transport.NewID(),
+			Transport: transportName,
+			Address:   address,
+		}
+	} else if err != nil {
+		return endpoint, fmt.Errorf("failed to fetch endpoint: %w", err)
+	}
+
+	query, args := sqlbuilder.SQLite.NewInsertBuilder().
+		InsertIgnoreInto("links").
+		Cols("virtual_channel_key", "channel_id", "note", "transport", "address").
+		Values(virtualChannelKey, endpoint.ChannelID, note, endpoint.Transport, endpoint.Address).
+		Build()
+
+	_, err = db.ExecContext(ctx, query, args...)
+	return endpoint, err
+}
+
+// UnlinkEndpoint unlinks an endpoint on another platform from all virtual channels.
+func UnlinkEndpoint(ctx context.Context, db *sql.DB, transportName, address string) error {
+	deleteB := sqlbuilder.NewDeleteBuilder()
+	query, args := deleteB.DeleteFrom("links").
+		Where(
+			deleteB.Equal("transport", transportName),
+			deleteB.Equal("address", address),
+		).
+		BuildWithFlavor(sqlbuilder.SQLite)
+
+	_, err := db.ExecContext(ctx, query, args...)
+	return err
+}
+
+func LoadVirtualChannelKeys(ctx context.Context, db *sql.DB, channelID snowflake.ID) ([]string, error) {
+	selectB := sqlbuilder.NewSelectBuilder()
+	query, args := selectB.Select("virtual_channel_key").
+		From("links").
+		Where(selectB.Equal("channel_id", channelID)).
+		BuildWithFlavor(sqlbuilder.SQLite)
+
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch virtual channel keys: %w", err)
+	}
+	defer rows.Close()
+
+	virtualChannelKey := ""
+	virtualChannelKeys := []string{}
+
+	for rows.Next() {
+		if err := rows.Scan(&virtualChannelKey); err != nil {
+			return nil, fmt.Errorf("failed to scan virtual channel key: %w", err)
+		}
+		virtualChannelKeys = append(virtualChannelKeys, virtualChannelKey)
+	}
+
+	return virtualChannelKeys, nil
+}
+
+func LoadNameTemplate(ctx context.Context, db *sql.DB, sourceChannelID, targetChannelID snowflake.ID) (string, error) {
+	queryB := sqlbuilder.NewSelectBuilder()
+	subqueryB := sqlbuilder.NewSelectBuilder()
+
+	queryB.Select("name_template").
+		From("links").
+		Where(
+			queryB.In("virtual_channel_key", subqueryB),
+			queryB.Equal("channel_id", targetChannelID),
+			queryB.NotEqual("name_template", ""),
+		).
+		Limit(1)
+
+	subqueryB.Select("virtual_channel_key").
+		From("links").
+		Where(subqueryB.Equal("channel_id", sourceChannelID))
+
+	query, args := queryB.BuildWithFlavor(sqlbuilder.SQLite)
+
+	nameTemplate := ""
+	err := db.QueryRowContext(ctx, query, args...).Scan(&nameTemplate)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	}
+	return nameTemplate, err
+}
+
+// LoadOwnerChannels returns, for every virtual channel the channel is linked to,
+// the channel that was linked to it first.
+func LoadOwnerChannels(ctx context.Context, db *sql.DB, channelID snowflake.ID) ([]snowflake.ID, error) {
+	queryB := sqlbuilder.NewSelectBuilder()
+	subqueryB := sqlbuilder.NewSelectBuilder()
+
+	queryB.Select("channel_id", "MIN(rowid)").
+		From("links").
+		Where(queryB.In("virtual_channel_key", subqueryB)).
+		GroupBy("virtual_channel_key")
+
+	subqueryB.Select("virtual_channel_key").
+		From("links").
+		Where(subqueryB.Equal("channel_id", channelID))
+
+	query, args := queryB.BuildWithFlavor(sqlbuilder.SQLite)
+
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch owner channels: %w", err)
+	}
+	defer rows.Close()
+
+	ownerChannelID := snowflake.ID(0)
+	rowID := 0
+	ownerChannelIDs := []snowflake.ID{}
+
+	for rows.Next() {
+		if err := rows.Scan(&ownerChannelID, &rowID); err != nil {
+			return nil, fmt.Errorf("failed to scan owner channel: %w", err)
+		}
+		ownerChannelIDs = append(ownerChannelIDs, ownerChannelID)
+	}
+
+	return ownerChannelIDs, nil
+}
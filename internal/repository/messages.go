@@ -3,11 +3,18 @@ package repository
 import (
 	"context"
 	"database/sql"
+	"errors"
+	"fmt"
 
 	"github.com/disgoorg/snowflake/v2"
 	"github.com/huandu/go-sqlbuilder"
 )
 
+type MessageRef struct {
+	ChannelID snowflake.ID
+	MessageID snowflake.ID
+}
+
 func CreateMessagesTable(ctx context.Context, tx *sql.Tx) error {
 	createMessagesTableQuery, _ := sqlbuilder.CreateTable("messages").
 		IfNotExists().
@@ -15,11 +22,15 @@ func CreateMessagesTable(ctx context.Context, tx *sql.Tx) error {
 		Define("original_message_id", "INT", "NOT NULL").
 		Define("hook_channel_id", "INT", "NOT NULL").
 		Define("hook_message_id", "INT", "NOT NULL").
+		Define("revision", "INT", "NOT NULL", "DEFAULT 0").
 		Define("PRIMARY KEY", "(original_channel_id, original_message_id, hook_channel_id, hook_message_id)").
 		BuildWithFlavor(sqlbuilder.SQLite)
 
-	_, err := tx.ExecContext(ctx, createMessagesTableQuery)
-	return err
+	if _, err := tx.ExecContext(ctx, createMessagesTableQuery); err != nil {
+		return err
+	}
+
+	return addColumnIfNotExists(ctx, tx, "messages", "revision", "INT", "NOT NULL", "DEFAULT 0")
 }
 
 func LoadRelatedMessageID(ctx context.Context, db *sql.DB, targetChannelID, messageRef snowflake.ID) (related snowflake.ID, err error) {
@@ -37,32 +48,100 @@ func LoadRelatedMessageID(ctx context.Context, db *sql.DB, targetChannelID, mess
 	return related, db.QueryRowContext(ctx, query, args...).Scan(&related)
 }
 
-func LoadDirelatedMessageID(ctx context.Context, db *sql.DB, targetChannelID, messageRef snowflake.ID) (related snowflake.ID, err error) {
-	selectBL := sqlbuilder.NewSelectBuilder()
-	selectBL.Select(selectBL.As("original_message_id", "related_message_id")).
+func LoadOriginalMessage(ctx context.Context, db *sql.DB, hookMessageID snowflake.ID) (original MessageRef, err error) {
+	selectB := sqlbuilder.NewSelectBuilder()
+	selectB.Select("original_channel_id", "original_message_id").
 		From("messages").
-		Where(
-			selectBL.And(
-				selectBL.Equal("original_channel_id", targetChannelID),
-				selectBL.Equal("hook_message_id", messageRef),
-			),
-		)
+		Where(selectB.Equal("hook_message_id", hookMessageID)).
+		Limit(1)
+
+	query, args := selectB.BuildWithFlavor(sqlbuilder.SQLite)
+	return original, db.QueryRowContext(ctx, query, args...).Scan(&original.ChannelID, &original.MessageID)
+}
+
+// LoadMessageCopies returns the original message and all of its forwarded copies,
+// given either the original or any of the copies.
+func LoadMessageCopies(ctx context.Context, db *sql.DB, channelID, messageID snowflake.ID) ([]MessageRef, error) {
+	original, err := LoadOriginalMessage(ctx, db, messageID)
+	if errors.Is(err, sql.ErrNoRows) {
+		original = MessageRef{ChannelID: channelID, MessageID: messageID}
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to fetch original message: %w", err)
+	}
 
-	selectBR := sqlbuilder.NewSelectBuilder()
-	selectBR.Select(selectBR.As("hook_message_id", "related_message_id")).
+	selectB := sqlbuilder.NewSelectBuilder()
+	query, args := selectB.Select("hook_channel_id", "hook_message_id").
 		From("messages").
-		Where(
-			selectBR.And(
-				selectBR.Equal("hook_channel_id", targetChannelID),
-				selectBR.Equal("original_message_id", messageRef),
-			),
-		)
+		Where(selectB.Equal("original_message_id", original.MessageID)).
+		BuildWithFlavor(sqlbuilder.SQLite)
 
-	query, args := sqlbuilder.Union(selectBL, selectBR).BuildWithFlavor(sqlbuilder.SQLite)
-	return related, db.QueryRowContext(ctx, query, args...).Scan(&related)
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch message copies: %w", err)
+	}
+	defer rows.Close()
+
+	messageCopy := MessageRef{}
+	messageCopies := []MessageRef{original}
+
+	for rows.Next() {
+		if err := rows.Scan(&messageCopy.ChannelID, &messageCopy.MessageID); err != nil {
+			return nil, fmt.Errorf("failed to scan message copy: %w", err)
+		}
+		messageCopies = append(messageCopies, messageCopy)
+	}
+
+	return messageCopies, nil
+}
+
+// MessageMapping is a forwarded copy of a message.
+type MessageMapping struct {
+	Original MessageRef
+	Copy     MessageRef
 }
 
-func SaveMessageMapping(ctx context.Context, tx *sql.Tx, originalChannelID, originalID, hookChannelID, hookID snowflake.ID) error {
+// LoadMessageMappings returns the copies of the messages, given either originals or copies.
+// Given copies, all copies of their originals are returned, including the given ones.
+func LoadMessageMappings(ctx context.Context, db *sql.DB, messageIDs []snowflake.ID) ([]MessageMapping, error) {
+	if len(messageIDs) == 0 {
+		return nil, nil
+	}
+
+	selectB := sqlbuilder.NewSelectBuilder()
+	subqueryB := sqlbuilder.NewSelectBuilder()
+
+	subqueryB.Select("original_message_id").
+		From("messages").
+		Where(subqueryB.In("hook_message_id", sqlbuilder.Flatten(messageIDs)...))
+
+	query, args := selectB.Select("original_channel_id", "original_message_id", "hook_channel_id", "hook_message_id").
+		From("messages").
+		Where(selectB.Or(
+			selectB.In("original_message_id", sqlbuilder.Flatten(messageIDs)...),
+			selectB.In("original_message_id", subqueryB),
+		)).
+		BuildWithFlavor(sqlbuilder.SQLite)
+
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch message mappings: %w", err)
+	}
+	defer rows.Close()
+
+	mapping := MessageMapping{}
+	mappings := []MessageMapping{}
+
+	for rows.Next() {
+		if err := rows.Scan(&mapping.Original.ChannelID, &mapping.Original.MessageID, &mapping.Copy.ChannelID, &mapping.Copy.MessageID); err != nil {
+			return nil, fmt.Errorf("failed to scan message mapping: %w", err)
+		}
+		mappings = append(mappings, mapping)
+	}
+
+	return mappings, nil
+}
+
+func SaveMessageMapping(ctx context.Context, tx Execer, originalChannelID, originalID, hookChannelID, hookID snowflake.ID) error {
 	query, args := sqlbuilder.SQLite.NewInsertBuilder().
 		InsertIgnoreInto("messages").
 		Cols("original_channel_id", "original_message_id", "hook_channel_id", "hook_message_id").
@@ -72,3 +151,31 @@ func SaveMessageMapping(ctx context.Context, tx *sql.Tx, originalChannelID, orig
 	_, err := tx.ExecContext(ctx, query, args...)
 	return err
 }
+
+func LoadRevision(ctx context.Context, db *sql.DB, hookChannelID, originalMessageID snowflake.ID) (revision int, err error) {
+	selectB := sqlbuilder.NewSelectBuilder()
+	selectB.Select("revision").
+		From("messages").
+		Where(
+			selectB.Equal("hook_channel_id", hookChannelID),
+			selectB.Equal("original_message_id", originalMessageID),
+		)
+
+	query, args := selectB.BuildWithFlavor(sqlbuilder.SQLite)
+	return revision, db.QueryRowContext(ctx, query, args...).Scan(&revision)
+}
+
+func SaveRevision(ctx context.Context, tx Execer, hookChannelID, originalMessageID snowflake.ID, revision int) error {
+	updateB := sqlbuilder.NewUpdateBuilder()
+	query, args := updateB.Update("messages").
+		Set(updateB.Assign("revision", revision)).
+		Where(
+			updateB.Equal("hook_channel_id", hookChannelID),
+			updateB.Equal("original_message_id", originalMessageID),
+			updateB.LessThan("revision", revision),
+		).
+		BuildWithFlavor(sqlbuilder.SQLite)
+
+	_, err := tx.ExecContext(ctx, query, args...)
+	return err
+}
@@ -0,0 +1,100 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/disgoorg/snowflake/v2"
+	"github.com/huandu/go-sqlbuilder"
+)
+
+func CreatePinsTable(ctx context.Context, tx *sql.Tx) error {
+	createPinsTableQuery, _ := sqlbuilder.CreateTable("pins").
+		IfNotExists().
+		Define("channel_id", "INT", "NOT NULL").
+		Define("message_id", "INT", "NOT NULL").
+		Define("PRIMARY KEY", "(channel_id, message_id)").
+		BuildWithFlavor(sqlbuilder.SQLite)
+
+	_, err := tx.ExecContext(ctx, createPinsTableQuery)
+	return err
+}
+
+// CreatePinChannelsTable creates the table of channels whose pins are tracked in the pins table.
+func CreatePinChannelsTable(ctx context.Context, tx *sql.Tx) error {
+	createPinChannelsTableQuery, _ := sqlbuilder.CreateTable("pin_channels").
+		IfNotExists().
+		Define("channel_id", "INT", "PRIMARY KEY").
+		BuildWithFlavor(sqlbuilder.SQLite)
+
+	_, err := tx.ExecContext(ctx, createPinChannelsTableQuery)
+	return err
+}
+
+func LoadPins(ctx context.Context, db *sql.DB, channelID snowflake.ID) (map[snowflake.ID]struct{}, error) {
+	selectB := sqlbuilder.NewSelectBuilder()
+	query, args := selectB.Select("message_id").
+		From("pins").
+		Where(selectB.Equal("channel_id", channelID)).
+		BuildWithFlavor(sqlbuilder.SQLite)
+
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch pins: %w", err)
+	}
+	defer rows.Close()
+
+	messageID := snowflake.ID(0)
+	pins := map[snowflake.ID]struct{}{}
+
+	for rows.Next() {
+		if err := rows.Scan(&messageID); err != nil {
+			return nil, fmt.Errorf("failed to scan pin: %w", err)
+		}
+		pins[messageID] = struct{}{}
+	}
+
+	return pins, nil
+}
+
+func SavePin(ctx context.Context, tx Execer, channelID, messageID snowflake.ID) error {
+	query, args := sqlbuilder.SQLite.NewInsertBuilder().
+		InsertIgnoreInto("pins").
+		Cols("channel_id", "message_id").
+		Values(channelID, messageID).
+		Build()
+
+	_, err := tx.ExecContext(ctx, query, args...)
+	return err
+}
+
+func DeletePin(ctx context.Context, tx Execer, channelID, messageID snowflake.ID) error {
+	deleteB := sqlbuilder.NewDeleteBuilder()
+	query, args := deleteB.DeleteFrom("pins").
+		Where(
+			deleteB.Equal("channel_id", channelID),
+			deleteB.Equal("message_id", messageID),
+		).
+		BuildWithFlavor(sqlbuilder.SQLite)
+
+	_, err := tx.ExecContext(ctx, query, args...)
+	return err
+}
+
+// SavePinChannel records the pins of the channel as tracked, reporting whether they were not tracked before.
+func SavePinChannel(ctx context.Context, db *sql.DB, channelID snowflake.ID) (saved bool, err error) {
+	query, args := sqlbuilder.SQLite.NewInsertBuilder().
+		InsertIgnoreInto("pin_channels").
+		Cols("channel_id").
+		Values(channelID).
+		Build()
+
+	res, err := db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return false, err
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	return rowsAffected > 0, err
+}
@@ -0,0 +1,69 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/disgoorg/snowflake/v2"
+	"github.com/huandu/go-sqlbuilder"
+)
+
+func CreatePreviewsTable(ctx context.Context, tx *sql.Tx) error {
+	createPreviewsTableQuery, _ := sqlbuilder.CreateTable("previews").
+		IfNotExists().
+		Define("original_channel_id", "INT", "NOT NULL").
+		Define("original_message_id", "INT", "NOT NULL").
+		Define("author_id", "INT", "NOT NULL").
+		Define("content", "TEXT", "NOT NULL").
+		Define("PRIMARY KEY", "(original_message_id)").
+		BuildWithFlavor(sqlbuilder.SQLite)
+
+	_, err := tx.ExecContext(ctx, createPreviewsTableQuery)
+	return err
+}
+
+func LoadPreview(ctx context.Context, db *sql.DB, originalMessageID snowflake.ID) (authorID snowflake.ID, content string, err error) {
+	selectB := sqlbuilder.NewSelectBuilder()
+	selectB.Select("author_id", "content").
+		From("previews").
+		Where(selectB.Equal("original_message_id", originalMessageID))
+
+	query, args := selectB.BuildWithFlavor(sqlbuilder.SQLite)
+	return authorID, content, db.QueryRowContext(ctx, query, args...).Scan(&authorID, &content)
+}
+
+func SavePreview(ctx context.Context, tx Execer, originalChannelID, originalMessageID, authorID snowflake.ID, content string) error {
+	query, args := sqlbuilder.SQLite.NewInsertBuilder().
+		ReplaceInto("previews").
+		Cols("original_channel_id", "original_message_id", "author_id", "content").
+		Values(originalChannelID, originalMessageID, authorID, content).
+		Build()
+
+	_, err := tx.ExecContext(ctx, query, args...)
+	return err
+}
+
+func DeletePreviews(ctx context.Context, tx Execer, originalMessageIDs []snowflake.ID) error {
+	if len(originalMessageIDs) == 0 {
+		return nil
+	}
+
+	deleteB := sqlbuilder.NewDeleteBuilder()
+	query, args := deleteB.DeleteFrom("previews").
+		Where(deleteB.In("original_message_id", sqlbuilder.Flatten(originalMessageIDs)...)).
+		BuildWithFlavor(sqlbuilder.SQLite)
+
+	_, err := tx.ExecContext(ctx, query, args...)
+	return err
+}
+
+// DeletePreviewsBefore deletes the previews of messages older than the message ID, as IDs are ordered by creation time.
+func DeletePreviewsBefore(ctx context.Context, tx Execer, messageID snowflake.ID) error {
+	deleteB := sqlbuilder.NewDeleteBuilder()
+	query, args := deleteB.DeleteFrom("previews").
+		Where(deleteB.LessThan("original_message_id", messageID)).
+		BuildWithFlavor(sqlbuilder.SQLite)
+
+	_, err := tx.ExecContext(ctx, query, args...)
+	return err
+}
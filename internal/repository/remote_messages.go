@@ -0,0 +1,102 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/disgoorg/snowflake/v2"
+	"github.com/huandu/go-sqlbuilder"
+)
+
+// CreateRemoteMessagesTable creates the table mapping message IDs used in the bridge
+// to IDs of messages on endpoints of other platforms.
+func CreateRemoteMessagesTable(ctx context.Context, tx *sql.Tx) error {
+	createRemoteMessagesTableQuery, _ := sqlbuilder.CreateTable("remote_messages").
+		IfNotExists().
+		Define("channel_id", "INT", "NOT NULL").
+		Define("message_id", "INT", "NOT NULL").
+		Define("remote_id", "TEXT", "NOT NULL").
+		Define("PRIMARY KEY", "(channel_id, message_id)").
+		Define("UNIQUE", "(channel_id, remote_id)").
+		BuildWithFlavor(sqlbuilder.SQLite)
+
+	_, err := tx.ExecContext(ctx, createRemoteMessagesTableQuery)
+	return err
+}
+
+// CreateRemoteMessagePartsTable creates the table mapping the IDs of each of the messages a bridged message
+// was sent as to the ID used in the bridge, for platforms splitting messages.
+func CreateRemoteMessagePartsTable(ctx context.Context, tx *sql.Tx) error {
+	createRemoteMessagePartsTableQuery, _ := sqlbuilder.CreateTable("remote_message_parts").
+		IfNotExists().
+		Define("channel_id", "INT", "NOT NULL").
+		Define("remote_id", "TEXT", "NOT NULL").
+		Define("message_id", "INT", "NOT NULL").
+		Define("PRIMARY KEY", "(channel_id, remote_id)").
+		BuildWithFlavor(sqlbuilder.SQLite)
+
+	_, err := tx.ExecContext(ctx, createRemoteMessagePartsTableQuery)
+	return err
+}
+
+func LoadRemoteMessageID(ctx context.Context, db *sql.DB, channelID, messageID snowflake.ID) (remoteID string, err error) {
+	selectB := sqlbuilder.NewSelectBuilder()
+	query, args := selectB.Select("remote_id").
+		From("remote_messages").
+		Where(
+			selectB.Equal("channel_id", channelID),
+			selectB.Equal("message_id", messageID),
+		).
+		BuildWithFlavor(sqlbuilder.SQLite)
+
+	return remoteID, db.QueryRowContext(ctx, query, args...).Scan(&remoteID)
+}
+
+// LoadLocalMessageID returns the ID used in the bridge of the message with the remote ID, or of which it is a part.
+func LoadLocalMessageID(ctx context.Context, db *sql.DB, channelID snowflake.ID, remoteID string) (messageID snowflake.ID, err error) {
+	messageB := sqlbuilder.NewSelectBuilder()
+	messageB.Select("message_id").
+		From("remote_messages").
+		Where(
+			messageB.Equal("channel_id", channelID),
+			messageB.Equal("remote_id", remoteID),
+		)
+
+	partB := sqlbuilder.NewSelectBuilder()
+	partB.Select("message_id").
+		From("remote_message_parts").
+		Where(
+			partB.Equal("channel_id", channelID),
+			partB.Equal("remote_id", remoteID),
+		)
+
+	query, args := sqlbuilder.UnionAll(messageB, partB).
+		Limit(1).
+		BuildWithFlavor(sqlbuilder.SQLite)
+
+	return messageID, db.QueryRowContext(ctx, query, args...).Scan(&messageID)
+}
+
+func SaveRemoteMessageID(ctx context.Context, tx Execer, channelID, messageID snowflake.ID, remoteID string) error {
+	query, args := sqlbuilder.SQLite.NewInsertBuilder().
+		InsertIgnoreInto("remote_messages").
+		Cols("channel_id", "message_id", "remote_id").
+		Values(channelID, messageID, remoteID).
+		Build()
+
+	_, err := tx.ExecContext(ctx, query, args...)
+	return err
+}
+
+func SaveRemoteMessageParts(ctx context.Context, tx Execer, channelID, messageID snowflake.ID, remoteIDs []string) error {
+	insertB := sqlbuilder.SQLite.NewInsertBuilder().
+		InsertIgnoreInto("remote_message_parts").
+		Cols("channel_id", "remote_id", "message_id")
+	for _, remoteID := range remoteIDs {
+		insertB.Values(channelID, remoteID, messageID)
+	}
+
+	query, args := insertB.Build()
+	_, err := tx.ExecContext(ctx, query, args...)
+	return err
+}
@@ -0,0 +1,60 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/disgoorg/snowflake/v2"
+	"github.com/huandu/go-sqlbuilder"
+)
+
+func CreateRepliesTable(ctx context.Context, tx *sql.Tx) error {
+	createRepliesTableQuery, _ := sqlbuilder.CreateTable("replies").
+		IfNotExists().
+		Define("channel_id", "INT", "NOT NULL").
+		Define("message_id", "INT", "NOT NULL").
+		Define("referenced_message_id", "INT", "NOT NULL").
+		Define("PRIMARY KEY", "(channel_id, message_id)").
+		BuildWithFlavor(sqlbuilder.SQLite)
+
+	_, err := tx.ExecContext(ctx, createRepliesTableQuery)
+	return err
+}
+
+func LoadReplies(ctx context.Context, db *sql.DB, referencedMessageID snowflake.ID) ([]MessageRef, error) {
+	selectB := sqlbuilder.NewSelectBuilder()
+	query, args := selectB.Select("channel_id", "message_id").
+		From("replies").
+		Where(selectB.Equal("referenced_message_id", referencedMessageID)).
+		BuildWithFlavor(sqlbuilder.SQLite)
+
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch replies: %w", err)
+	}
+	defer rows.Close()
+
+	reply := MessageRef{}
+	replies := []MessageRef{}
+
+	for rows.Next() {
+		if err := rows.Scan(&reply.ChannelID, &reply.MessageID); err != nil {
+			return nil, fmt.Errorf("failed to scan reply: %w", err)
+		}
+		replies = append(replies, reply)
+	}
+
+	return replies, nil
+}
+
+func SaveReply(ctx context.Context, tx Execer, channelID, messageID, referencedMessageID snowflake.ID) error {
+	query, args := sqlbuilder.SQLite.NewInsertBuilder().
+		InsertIgnoreInto("replies").
+		Cols("channel_id", "message_id", "referenced_message_id").
+		Values(channelID, messageID, referencedMessageID).
+		Build()
+
+	_, err := tx.ExecContext(ctx, query, args...)
+	return err
+}
@@ -4,10 +4,16 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
+	"strings"
 )
 
+type Execer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
+
 func InitDB(ctx context.Context, db **sql.DB, filePath string) (err error) {
-	*db, err = sql.Open("sqlite3", filePath)
+	// forwarding writes from several goroutines, so wait for locks instead of failing with SQLITE_BUSY
+	*db, err = sql.Open("sqlite3", filePath+"?_busy_timeout=5000")
 	if err != nil {
 		return fmt.Errorf("failed to open database: %w", err)
 	}
@@ -29,5 +35,77 @@ func InitDB(ctx context.Context, db **sql.DB, filePath string) (err error) {
 	if err := CreateLinksTable(ctx, tx); err != nil {
 		return fmt.Errorf("failed to create table: %w", err)
 	}
+
+	if err := CreatePreviewsTable(ctx, tx); err != nil {
+		return fmt.Errorf("failed to create table: %w", err)
+	}
+
+	if err := CreateRepliesTable(ctx, tx); err != nil {
+		return fmt.Errorf("failed to create table: %w", err)
+	}
+
+	if err := CreatePinsTable(ctx, tx); err != nil {
+		return fmt.Errorf("failed to create table: %w", err)
+	}
+
+	if err := CreatePinChannelsTable(ctx, tx); err != nil {
+		return fmt.Errorf("failed to create table: %w", err)
+	}
+
+	if err := CreateRevisionsTable(ctx, tx); err != nil {
+		return fmt.Errorf("failed to create table: %w", err)
+	}
+
+	if err := CreateRevisionCountersTable(ctx, tx); err != nil {
+		return fmt.Errorf("failed to create table: %w", err)
+	}
+
+	if err := CreateRemoteMessagesTable(ctx, tx); err != nil {
+		return fmt.Errorf("failed to create table: %w", err)
+	}
+
+	if err := CreateRemoteMessagePartsTable(ctx, tx); err != nil {
+		return fmt.Errorf("failed to create table: %w", err)
+	}
+
+	if err := CreateSinksTable(ctx, tx); err != nil {
+		return fmt.Errorf("failed to create table: %w", err)
+	}
+
+	if err := CreateAPITokensTable(ctx, tx); err != nil {
+		return fmt.Errorf("failed to create table: %w", err)
+	}
+
+	if err := CreateFeedsTable(ctx, tx); err != nil {
+		return fmt.Errorf("failed to create table: %w", err)
+	}
+
+	if err := CreateFeedEntriesTable(ctx, tx); err != nil {
+		return fmt.Errorf("failed to create table: %w", err)
+	}
 	return tx.Commit()
 }
+
+func addColumnIfNotExists(ctx context.Context, tx *sql.Tx, table, column string, definition ...string) error {
+	rows, err := tx.QueryContext(ctx, "SELECT name FROM pragma_table_info(?)", table)
+	if err != nil {
+		return fmt.Errorf("failed to fetch table info: %w", err)
+	}
+	defer rows.Close()
+
+	name := ""
+	for rows.Next() {
+		if err := rows.Scan(&name); err != nil {
+			return fmt.Errorf("failed to scan column name: %w", err)
+		}
+		if name == column {
+			return nil
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, strings.Join(definition, " ")))
+	return err
+}
@@ -0,0 +1,175 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/disgoorg/snowflake/v2"
+	"github.com/huandu/go-sqlbuilder"
+)
+
+type ContentRevision struct {
+	Revision int
+	Content  string
+	EditedAt time.Time
+}
+
+func CreateRevisionsTable(ctx context.Context, tx *sql.Tx) error {
+	createRevisionsTableQuery, _ := sqlbuilder.CreateTable("revisions").
+		IfNotExists().
+		Define("original_channel_id", "INT", "NOT NULL").
+		Define("original_message_id", "INT", "NOT NULL").
+		Define("revision", "INT", "NOT NULL").
+		Define("content", "TEXT", "NOT NULL").
+		Define("edited_at", "INT", "NOT NULL").
+		Define("PRIMARY KEY", "(original_message_id, revision)").
+		BuildWithFlavor(sqlbuilder.SQLite)
+
+	_, err := tx.ExecContext(ctx, createRevisionsTableQuery)
+	return err
+}
+
+// CreateRevisionCountersTable creates the table of the latest revision number allocated to each edited message.
+func CreateRevisionCountersTable(ctx context.Context, tx *sql.Tx) error {
+	createRevisionCountersTableQuery, _ := sqlbuilder.CreateTable("revision_counters").
+		IfNotExists().
+		Define("original_message_id", "INT", "PRIMARY KEY").
+		Define("revision", "INT", "NOT NULL").
+		BuildWithFlavor(sqlbuilder.SQLite)
+
+	_, err := tx.ExecContext(ctx, createRevisionCountersTableQuery)
+	return err
+}
+
+// SaveNextRevision atomically allocates the next revision number of the message. The first allocation
+// continues from revisions recorded before the counter existed.
+func SaveNextRevision(ctx context.Context, db *sql.DB, originalMessageID snowflake.ID) (revision int, err error) {
+	seed := sqlbuilder.Buildf("(SELECT MAX(%v, %v) + 1)",
+		sqlbuilder.Buildf("(SELECT COALESCE(MAX(revision), 0) FROM messages WHERE original_message_id = %v)", originalMessageID),
+		sqlbuilder.Buildf("(SELECT COALESCE(MAX(revision), 0) FROM revisions WHERE original_message_id = %v)", originalMessageID),
+	)
+
+	query, args := sqlbuilder.SQLite.NewInsertBuilder().
+		InsertInto("revision_counters").
+		Cols("original_message_id", "revision").
+		Values(originalMessageID, seed).
+		SQL("ON CONFLICT (original_message_id) DO UPDATE SET revision = revision + 1 RETURNING revision").
+		Build()
+
+	return revision, db.QueryRowContext(ctx, query, args...).Scan(&revision)
+}
+
+func LoadContentRevisions(ctx context.Context, db *sql.DB, originalMessageID snowflake.ID) ([]ContentRevision, error) {
+	selectB := sqlbuilder.NewSelectBuilder()
+	query, args := selectB.Select("revision", "content", "edited_at").
+		From("revisions").
+		Where(selectB.Equal("original_message_id", originalMessageID)).
+		OrderBy("revision").
+		BuildWithFlavor(sqlbuilder.SQLite)
+
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch revisions: %w", err)
+	}
+	defer rows.Close()
+
+	revision := ContentRevision{}
+	editedAt := int64(0)
+	revisions := []ContentRevision{}
+
+	for rows.Next() {
+		if err := rows.Scan(&revision.Revision, &revision.Content, &editedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan revision: %w", err)
+		}
+		revision.EditedAt = time.Unix(editedAt, 0)
+		revisions = append(revisions, revision)
+	}
+
+	return revisions, nil
+}
+
+// SaveContentRevision stores content as a new revision unless it equals the latest stored one,
+// then prunes all but the newest keep revisions.
+func SaveContentRevision(ctx context.Context, db *sql.DB, originalChannelID, originalMessageID snowflake.ID, revision int, content string, editedAt time.Time, keep int) error {
+	selectB := sqlbuilder.NewSelectBuilder()
+	query, args := selectB.Select("content").
+		From("revisions").
+		Where(selectB.Equal("original_message_id", originalMessageID)).
+		OrderBy("revision").Desc().
+		Limit(1).
+		BuildWithFlavor(sqlbuilder.SQLite)
+
+	latestContent := ""
+	err := db.QueryRowContext(ctx, query, args...).Scan(&latestContent)
+	if err == nil && latestContent == content {
+		return nil
+	} else if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+
+	query, args = sqlbuilder.SQLite.NewInsertBuilder().
+		InsertIgnoreInto("revisions").
+		Cols("original_channel_id", "original_message_id", "revision", "content", "edited_at").
+		Values(originalChannelID, originalMessageID, revision, content, editedAt.Unix()).
+		Build()
+
+	if _, err := db.ExecContext(ctx, query, args...); err != nil {
+		return err
+	}
+
+	keptB := sqlbuilder.NewSelectBuilder()
+	keptB.Select("revision").
+		From("revisions").
+		Where(keptB.Equal("original_message_id", originalMessageID)).
+		OrderBy("revision").Desc().
+		Limit(keep)
+
+	deleteB := sqlbuilder.NewDeleteBuilder()
+	query, args = deleteB.DeleteFrom("revisions").
+		Where(
+			deleteB.Equal("original_message_id", originalMessageID),
+			deleteB.NotIn("revision", keptB),
+		).
+		BuildWithFlavor(sqlbuilder.SQLite)
+
+	_, err = db.ExecContext(ctx, query, args...)
+	return err
+}
+
+// DeleteContentRevisions deletes the edit history of the messages.
+func DeleteContentRevisions(ctx context.Context, tx Execer, originalMessageIDs []snowflake.ID) error {
+	if len(originalMessageIDs) == 0 {
+		return nil
+	}
+
+	for _, table := range []string{"revisions", "revision_counters"} {
+		deleteB := sqlbuilder.NewDeleteBuilder()
+		query, args := deleteB.DeleteFrom(table).
+			Where(deleteB.In("original_message_id", sqlbuilder.Flatten(originalMessageIDs)...)).
+			BuildWithFlavor(sqlbuilder.SQLite)
+
+		if _, err := tx.ExecContext(ctx, query, args...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DeleteContentRevisionsBefore deletes the edit history of messages older than the message ID, as IDs are ordered by creation time.
+// Revision counters start again from the revisions of copies, so they are dropped too.
+func DeleteContentRevisionsBefore(ctx context.Context, tx Execer, messageID snowflake.ID) error {
+	for _, table := range []string{"revisions", "revision_counters"} {
+		deleteB := sqlbuilder.NewDeleteBuilder()
+		query, args := deleteB.DeleteFrom(table).
+			Where(deleteB.LessThan("original_message_id", messageID)).
+			BuildWithFlavor(sqlbuilder.SQLite)
+
+		if _, err := tx.ExecContext(ctx, query, args...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,110 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/disgoorg/snowflake/v2"
+	"github.com/huandu/go-sqlbuilder"
+)
+
+type Sink struct {
+	ID                int64
+	VirtualChannelKey string
+	URL               string
+	Secret            string
+	// Events is a comma separated list of delivered event types, or empty for all of them.
+	Events  string
+	Pattern string
+}
+
+func CreateSinksTable(ctx context.Context, tx *sql.Tx) error {
+	createSinksTableQuery, _ := sqlbuilder.CreateTable("sinks").
+		IfNotExists().
+		Define("id", "INTEGER", "PRIMARY KEY").
+		Define("virtual_channel_key", "TEXT", "NOT NULL").
+		Define("url", "TEXT", "NOT NULL").
+		Define("secret", "TEXT", "NOT NULL").
+		Define("events", "TEXT", "NOT NULL", "DEFAULT ''").
+		Define("pattern", "TEXT", "NOT NULL", "DEFAULT ''").
+		BuildWithFlavor(sqlbuilder.SQLite)
+
+	_, err := tx.ExecContext(ctx, createSinksTableQuery)
+	return err
+}
+
+// LoadSinks returns sinks of every virtual channel the channel is linked to.
+func LoadSinks(ctx context.Context, db *sql.DB, channelID snowflake.ID) ([]Sink, error) {
+	queryB := sqlbuilder.NewSelectBuilder()
+	subqueryB := sqlbuilder.NewSelectBuilder()
+
+	queryB.Select("id", "virtual_channel_key", "url", "secret", "events", "pattern").
+		From("sinks").
+		Where(queryB.In("virtual_channel_key", subqueryB)).
+		OrderBy("id")
+
+	subqueryB.Select("virtual_channel_key").
+		From("links").
+		Where(subqueryB.Equal("channel_id", channelID))
+
+	query, args := queryB.BuildWithFlavor(sqlbuilder.SQLite)
+
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch sinks: %w", err)
+	}
+	defer rows.Close()
+
+	sink := Sink{}
+	sinks := []Sink{}
+
+	for rows.Next() {
+		if err := rows.Scan(&sink.ID, &sink.VirtualChannelKey, &sink.URL, &sink.Secret, &sink.Events, &sink.Pattern); err != nil {
+			return nil, fmt.Errorf("failed to scan sink: %w", err)
+		}
+		sinks = append(sinks, sink)
+	}
+
+	return sinks, nil
+}
+
+func SaveSink(ctx context.Context, db *sql.DB, sink Sink) (id int64, err error) {
+	query, args := sqlbuilder.SQLite.NewInsertBuilder().
+		InsertInto("sinks").
+		Cols("virtual_channel_key", "url", "secret", "events", "pattern").
+		Values(sink.VirtualChannelKey, sink.URL, sink.Secret, sink.Events, sink.Pattern).
+		Build()
+
+	res, err := db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return 0, err
+	}
+	return res.LastInsertId()
+}
+
+// DeleteSink deletes a sink of a virtual channel the channel is linked to.
+func DeleteSink(ctx context.Context, db *sql.DB, channelID snowflake.ID, id int64) (deleted bool, err error) {
+	deleteB := sqlbuilder.NewDeleteBuilder()
+	subqueryB := sqlbuilder.NewSelectBuilder()
+
+	deleteB.DeleteFrom("sinks").
+		Where(
+			deleteB.Equal("id", id),
+			deleteB.In("virtual_channel_key", subqueryB),
+		)
+
+	subqueryB.Select("virtual_channel_key").
+		From("links").
+		Where(subqueryB.Equal("channel_id", channelID))
+
+	query, args := deleteB.BuildWithFlavor(sqlbuilder.SQLite)
+
+	res, err := db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return false, err
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	return rowsAffected > 0, err
+}
@@ -0,0 +1,87 @@
+package sequencer
+
+import (
+	"sync"
+	"time"
+)
+
+// Debouncer delays tasks by a fixed window, replacing a pending task with the latest one submitted
+// under the same key. Tasks that fire under the same key never run concurrently.
+type Debouncer[K comparable] struct {
+	delay     time.Duration
+	sequencer *Sequencer[K]
+
+	mu      sync.Mutex
+	timers  map[K]*time.Timer
+	pending map[K]func()
+}
+
+func NewDebouncer[K comparable](delay time.Duration, workers int) *Debouncer[K] {
+	return &Debouncer[K]{
+		delay:     delay,
+		sequencer: New[K](workers),
+		timers:    map[K]*time.Timer{},
+		pending:   map[K]func(){},
+	}
+}
+
+func (d *Debouncer[K]) Do(key K, task func()) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.schedule(key, task)
+}
+
+// DoUnlessPending submits task like Do, unless a task is already pending under key, which is kept instead.
+func (d *Debouncer[K]) DoUnlessPending(key K, task func()) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if _, ok := d.pending[key]; !ok {
+		d.schedule(key, task)
+	}
+}
+
+func (d *Debouncer[K]) schedule(key K, task func()) {
+	d.pending[key] = task
+
+	if timer, ok := d.timers[key]; ok {
+		timer.Reset(d.delay)
+		return
+	}
+	timer := (*time.Timer)(nil)
+	timer = time.AfterFunc(d.delay, func() {
+		d.mu.Lock()
+		defer d.mu.Unlock()
+
+		d.fire(key, timer)
+	})
+	d.timers[key] = timer
+}
+
+// fire submits the task pending under key when its timer fires. It is called with the lock held,
+// so that once Flush holds the lock, every task taken from pending has been submitted.
+func (d *Debouncer[K]) fire(key K, timer *time.Timer) {
+	// a Reset racing with the timer firing can fire it twice, and a timer Flush failed to stop
+	// may fire after a new one replaced it; neither firing is current
+	if d.timers[key] != timer {
+		return
+	}
+	d.sequencer.Go(key, d.pending[key])
+	delete(d.pending, key)
+	delete(d.timers, key)
+}
+
+// Flush runs every pending task immediately and waits for all tasks to finish.
+func (d *Debouncer[K]) Flush() {
+	d.mu.Lock()
+	for key, task := range d.pending {
+		d.timers[key].Stop()
+		d.sequencer.Go(key, task)
+	}
+	clear(d.pending)
+	clear(d.timers)
+	d.mu.Unlock()
+
+	d.sequencer.Wait()
+}
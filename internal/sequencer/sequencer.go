@@ -0,0 +1,72 @@
+package sequencer
+
+import "sync"
+
+// Sequencer runs tasks concurrently on a fixed pool of workers,
+// while tasks submitted under the same key run one after another in submission order.
+type Sequencer[K comparable] struct {
+	mu    sync.Mutex
+	ready *sync.Cond
+	// queues holds the tasks of every busy key, starting with the running one, if any
+	queues map[K][]func()
+	// keys are the busy keys with no running task, in the order they became so
+	keys []K
+	wg   sync.WaitGroup
+}
+
+func New[K comparable](workers int) *Sequencer[K] {
+	s := &Sequencer[K]{queues: map[K][]func(){}}
+	s.ready = sync.NewCond(&s.mu)
+
+	for range max(1, workers) {
+		go s.work()
+	}
+	return s
+}
+
+// Go queues task under key without blocking.
+func (s *Sequencer[K]) Go(key K, task func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.wg.Add(1)
+	queue, busy := s.queues[key]
+	s.queues[key] = append(queue, task)
+	if !busy {
+		s.keys = append(s.keys, key)
+		s.ready.Signal()
+	}
+}
+
+func (s *Sequencer[K]) work() {
+	s.mu.Lock()
+	for {
+		for len(s.keys) == 0 {
+			s.ready.Wait()
+		}
+		key := s.keys[0]
+		s.keys = s.keys[1:]
+		task := s.queues[key][0]
+
+		s.mu.Unlock()
+		task()
+		s.wg.Done()
+		s.mu.Lock()
+
+		queue := s.queues[key]
+		queue[0] = nil
+		if len(queue) == 1 {
+			delete(s.queues, key)
+			continue
+		}
+		// the key goes behind the others, so a busy key cannot starve them
+		s.queues[key] = queue[1:]
+		s.keys = append(s.keys, key)
+		s.ready.Signal()
+	}
+}
+
+// Wait blocks until every submitted task has finished.
+func (s *Sequencer[K]) Wait() {
+	s.wg.Wait()
+}
@@ -0,0 +1,98 @@
+package sequencer
+
+import (
+	"slices"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestSequencerOrder(t *testing.T) {
+	s := New[int](4)
+
+	mu := sync.Mutex{}
+	done := map[int][]int{}
+	for i := range 100 {
+		key := i % 3
+		s.Go(key, func() {
+			mu.Lock()
+			done[key] = append(done[key], i)
+			mu.Unlock()
+		})
+	}
+	s.Wait()
+
+	for key, tasks := range done {
+		if !slices.IsSorted(tasks) {
+			t.Errorf("tasks of key %d ran in order %v", key, tasks)
+		}
+	}
+	if n := len(done[0]) + len(done[1]) + len(done[2]); n != 100 {
+		t.Errorf("%d tasks ran, want 100", n)
+	}
+}
+
+func TestSequencerWorkers(t *testing.T) {
+	const workers = 3
+	s := New[int](workers)
+
+	running, peak := atomic.Int32{}, atomic.Int32{}
+	release := make(chan struct{})
+	for key := range 10 {
+		// submitting does not block while every worker is busy
+		s.Go(key, func() {
+			n := running.Add(1)
+			for p := peak.Load(); n > p && !peak.CompareAndSwap(p, n); p = peak.Load() {
+			}
+			<-release
+			running.Add(-1)
+		})
+	}
+
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	s.Wait()
+
+	if p := peak.Load(); p != workers {
+		t.Errorf("%d tasks ran at once, want %d", p, workers)
+	}
+}
+
+func TestDebouncer(t *testing.T) {
+	d := NewDebouncer[string](20*time.Millisecond, 2)
+
+	ran := make(chan string, 10)
+	d.Do("a", func() { ran <- "first" })
+	d.Do("a", func() { ran <- "latest" })
+	d.DoUnlessPending("a", func() { ran <- "unless pending" })
+
+	if task := <-ran; task != "latest" {
+		t.Errorf("ran %q task, want the latest", task)
+	}
+
+	d.DoUnlessPending("a", func() { ran <- "unless pending" })
+	if task := <-ran; task != "unless pending" {
+		t.Errorf("ran %q task, want the one submitted with nothing pending", task)
+	}
+}
+
+func TestDebouncerFlush(t *testing.T) {
+	for _, delay := range []time.Duration{time.Hour, 0, time.Microsecond} {
+		d := NewDebouncer[int](delay, 2)
+
+		ran := atomic.Int32{}
+		for key := range 50 {
+			d.Do(key, func() {
+				time.Sleep(time.Millisecond)
+				ran.Add(1)
+			})
+		}
+		// timers firing while Flush runs are waited for as well
+		d.Flush()
+
+		if n := ran.Load(); n != 50 {
+			t.Errorf("with delay %s, %d tasks ran before Flush returned, want 50", delay, n)
+		}
+	}
+}
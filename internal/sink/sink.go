@@ -0,0 +1,207 @@
+package sink
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/mandriota/bridge-discord-bot/internal/sequencer"
+)
+
+const (
+	EventCreate = "message.create"
+	EventUpdate = "message.update"
+	EventDelete = "message.delete"
+
+	SignatureHeader = "X-Bridge-Signature"
+	TimestampHeader = "X-Bridge-Timestamp"
+)
+
+type Author struct {
+	ID          string `json:"id"`
+	Username    string `json:"username"`
+	DisplayName string `json:"display_name"`
+	AvatarURL   string `json:"avatar_url,omitempty"`
+}
+
+type Attachment struct {
+	Filename    string `json:"filename"`
+	URL         string `json:"url"`
+	Size        int    `json:"size"`
+	ContentType string `json:"content_type,omitempty"`
+}
+
+type Message struct {
+	ID          string       `json:"id"`
+	ChannelID   string       `json:"channel_id"`
+	Transport   string       `json:"transport"`
+	Origin      string       `json:"origin,omitempty"`
+	Author      *Author      `json:"author,omitempty"`
+	Content     string       `json:"content"`
+	ReplyTo     string       `json:"reply_to,omitempty"`
+	Attachments []Attachment `json:"attachments"`
+}
+
+type Event struct {
+	Type           string    `json:"type"`
+	VirtualChannel string    `json:"virtual_channel"`
+	Timestamp      time.Time `json:"timestamp"`
+	Message        Message   `json:"message"`
+}
+
+type Target struct {
+	URL    string
+	Secret string
+}
+
+// ErrForbiddenAddress is returned for URLs on loopback, private, link-local or unspecified addresses,
+// which would let anyone adding a sink or feed reach services on the bot's own network.
+var ErrForbiddenAddress = errors.New("sink: address is not public")
+
+func isForbidden(ip net.IP) bool {
+	return ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsUnspecified()
+}
+
+// CheckURL resolves the host of the URL, returning ErrForbiddenAddress if any of its addresses is forbidden.
+func CheckURL(ctx context.Context, rawURL string) error {
+	parsedURL, err := url.Parse(rawURL)
+	if err != nil {
+		return err
+	}
+
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, parsedURL.Hostname())
+	if err != nil {
+		return err
+	}
+	for _, addr := range addrs {
+		if isForbidden(addr.IP) {
+			return ErrForbiddenAddress
+		}
+	}
+	return nil
+}
+
+// Sign returns the hex HMAC-SHA256 of the timestamp and body joined by a dot.
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte{'.'})
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Dispatcher delivers events to HTTP endpoints, retrying failed deliveries with exponential backoff.
+// Events for the same URL are delivered in publishing order.
+type Dispatcher struct {
+	ctx         context.Context
+	client      *http.Client
+	deliveries  *sequencer.Sequencer[string]
+	maxAttempts int
+	retryDelay  time.Duration
+	logger      *slog.Logger
+}
+
+func New(ctx context.Context, workers, maxAttempts int, retryDelay time.Duration, logger *slog.Logger) *Dispatcher {
+	return &Dispatcher{
+		ctx:         ctx,
+		client:      NewClient(15 * time.Second),
+		deliveries:  sequencer.New[string](workers),
+		maxAttempts: max(1, maxAttempts),
+		retryDelay:  retryDelay,
+		logger:      logger,
+	}
+}
+
+// NewClient returns an HTTP client for user-supplied URLs, which refuses to connect to forbidden addresses.
+// Addresses are checked when connecting, as hosts may resolve differently than when their URLs were checked.
+func NewClient(timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{
+		Timeout: timeout,
+		Control: dialControl,
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = dialer.DialContext
+
+	return &http.Client{Timeout: timeout, Transport: transport}
+}
+
+func dialControl(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	if ip := net.ParseIP(host); ip == nil || isForbidden(ip) {
+		return ErrForbiddenAddress
+	}
+	return nil
+}
+
+func (d *Dispatcher) Publish(target Target, event Event) {
+	body, err := json.Marshal(event)
+	if err != nil {
+		d.logger.Error("failed to encode sink event", "error", err)
+		return
+	}
+
+	d.deliveries.Go(target.URL, func() {
+		delay := d.retryDelay
+		for attempt := 1; ; attempt++ {
+			retry, err := d.deliver(target, body)
+			if err == nil {
+				return
+			}
+			if !retry || attempt == d.maxAttempts {
+				d.logger.Error("failed to deliver sink event", "error", err, "url", target.URL, "type", event.Type, "attempts", attempt)
+				return
+			}
+
+			select {
+			case <-d.ctx.Done():
+				return
+			case <-time.After(delay):
+			}
+			delay *= 2
+		}
+	})
+}
+
+func (d *Dispatcher) deliver(target Target, body []byte) (retry bool, err error) {
+	req, err := http.NewRequestWithContext(d.ctx, http.MethodPost, target.URL, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+
+	timestamp := time.Now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(TimestampHeader, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(SignatureHeader, "sha256="+Sign(target.Secret, timestamp, body))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return !errors.Is(err, ErrForbiddenAddress), err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode < 300 {
+		return false, nil
+	}
+	// client errors other than rate limits will not go away by retrying
+	return resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests, fmt.Errorf("sink responded with %s", resp.Status)
+}
+
+// Wait blocks until pending deliveries have finished or given up.
+func (d *Dispatcher) Wait() {
+	d.deliveries.Wait()
+}
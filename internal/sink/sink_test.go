@@ -0,0 +1,77 @@
+package sink
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestSign(t *testing.T) {
+	// printf '1700000000.{"a":1}' | openssl dgst -sha256 -hmac secret
+	const signature = "49f24e537407743fa4a0242bb63b94b9a47ee99cbbe071ccd8a22550ae411686"
+	if s := Sign("secret", 1700000000, []byte(`{"a":1}`)); s != signature {
+		t.Errorf("Sign = %s, want %s", s, signature)
+	}
+	if s := Sign("other", 1700000000, []byte(`{"a":1}`)); s == signature {
+		t.Error("signature does not depend on the secret")
+	}
+}
+
+func TestCheckURL(t *testing.T) {
+	for _, rawURL := range []string{
+		"http://127.0.0.1/",
+		"http://localhost:8080/hook",
+		"http://10.0.0.1/",
+		"http://[::1]/",
+		"http://169.254.169.254/latest/meta-data/",
+	} {
+		if err := CheckURL(context.Background(), rawURL); !errors.Is(err, ErrForbiddenAddress) {
+			t.Errorf("CheckURL(%q) = %v, want ErrForbiddenAddress", rawURL, err)
+		}
+	}
+
+	if err := CheckURL(context.Background(), "https://93.184.215.14/"); err != nil {
+		t.Errorf("CheckURL of a public address = %v", err)
+	}
+}
+
+func TestDialControl(t *testing.T) {
+	for _, test := range []struct {
+		address   string
+		forbidden bool
+	}{
+		{"127.0.0.1:80", true},
+		{"[::1]:80", true},
+		{"10.1.2.3:80", true},
+		{"172.16.0.1:443", true},
+		{"192.168.1.1:80", true},
+		{"169.254.169.254:80", true},
+		{"[fe80::1]:80", true},
+		{"[fd00::1]:80", true},
+		{"0.0.0.0:80", true},
+		{"[::ffff:127.0.0.1]:80", true},
+		{"[::ffff:10.0.0.1]:80", true},
+		{"93.184.215.14:443", false},
+		{"[2606:4700::1111]:443", false},
+	} {
+		err := dialControl("tcp", test.address, nil)
+		if forbidden := errors.Is(err, ErrForbiddenAddress); forbidden != test.forbidden || !forbidden && err != nil {
+			t.Errorf("dialControl(%q) = %v", test.address, err)
+		}
+	}
+}
+
+func TestNewClient(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("client reached a loopback server")
+	}))
+	defer server.Close()
+
+	_, err := NewClient(5 * time.Second).Get(server.URL)
+	if !errors.Is(err, ErrForbiddenAddress) {
+		t.Errorf("Get = %v, want ErrForbiddenAddress", err)
+	}
+}
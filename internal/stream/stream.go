@@ -0,0 +1,124 @@
+package stream
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	EventForwarded = "forwarded"
+	EventEdited    = "edited"
+	EventDeleted   = "deleted"
+	EventDropped   = "dropped"
+	EventFailed    = "failed"
+)
+
+type Endpoint struct {
+	ChannelID string `json:"channel_id"`
+	Transport string `json:"transport"`
+}
+
+type Event struct {
+	Type           string    `json:"type"`
+	VirtualChannel string    `json:"virtual_channel"`
+	Timestamp      time.Time `json:"timestamp"`
+	Source         *Endpoint `json:"source,omitempty"`
+	Target         *Endpoint `json:"target,omitempty"`
+	// MessageID is the ID of the message in the bridge, TargetMessageID the ID of its copy on the target's platform.
+	MessageID       string `json:"message_id,omitempty"`
+	TargetMessageID string `json:"target_message_id,omitempty"`
+	// Reason tells why a message was dropped, or which operation failed.
+	Reason string `json:"reason,omitempty"`
+}
+
+// Subscription receives the events of a virtual channel. Events is closed when the subscription
+// is closed, or when the subscriber falls so far behind that its buffer fills up.
+type Subscription struct {
+	hub               *Hub
+	virtualChannelKey string
+	events            chan Event
+}
+
+func (s *Subscription) Events() <-chan Event {
+	return s.events
+}
+
+func (s *Subscription) Close() {
+	s.hub.remove(s)
+}
+
+// Hub fans events out to subscribers of their virtual channels.
+type Hub struct {
+	bufferSize int
+	count      atomic.Int64
+
+	mu          sync.Mutex
+	subscribers map[string]map[*Subscription]struct{}
+}
+
+func New(bufferSize int) *Hub {
+	return &Hub{
+		bufferSize:  bufferSize,
+		subscribers: map[string]map[*Subscription]struct{}{},
+	}
+}
+
+func (h *Hub) Subscribe(virtualChannelKey string) *Subscription {
+	s := &Subscription{
+		hub:               h,
+		virtualChannelKey: virtualChannelKey,
+		events:            make(chan Event, h.bufferSize),
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.subscribers[virtualChannelKey] == nil {
+		h.subscribers[virtualChannelKey] = map[*Subscription]struct{}{}
+	}
+	h.subscribers[virtualChannelKey][s] = struct{}{}
+	h.count.Add(1)
+
+	return s
+}
+
+func (h *Hub) remove(s *Subscription) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.removeLocked(s)
+}
+
+func (h *Hub) removeLocked(s *Subscription) {
+	subscribers := h.subscribers[s.virtualChannelKey]
+	if _, ok := subscribers[s]; !ok {
+		return
+	}
+
+	delete(subscribers, s)
+	if len(subscribers) == 0 {
+		delete(h.subscribers, s.virtualChannelKey)
+	}
+	h.count.Add(-1)
+	close(s.events)
+}
+
+// Active reports whether anyone is subscribed, so publishers can skip preparing events nobody receives.
+func (h *Hub) Active() bool {
+	return h.count.Load() > 0
+}
+
+// Publish delivers the event to subscribers of its virtual channel without blocking.
+func (h *Hub) Publish(event Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for s := range h.subscribers[event.VirtualChannel] {
+		select {
+		case s.events <- event:
+		default:
+			h.removeLocked(s)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package stream
+
+import "testing"
+
+func TestPublishFiltersByVirtualChannel(t *testing.T) {
+	hub := New(4)
+	if hub.Active() {
+		t.Error("hub without subscribers is active")
+	}
+
+	alpha := hub.Subscribe("alpha")
+	alphaToo := hub.Subscribe("alpha")
+	beta := hub.Subscribe("beta")
+	if !hub.Active() {
+		t.Error("hub with subscribers is inactive")
+	}
+
+	hub.Publish(Event{Type: EventForwarded, VirtualChannel: "alpha", MessageID: "1"})
+	hub.Publish(Event{Type: EventEdited, VirtualChannel: "beta", MessageID: "2"})
+	hub.Publish(Event{Type: EventDeleted, VirtualChannel: "gamma", MessageID: "3"})
+
+	for name, test := range map[string]struct {
+		subscription *Subscription
+		messageIDs   []string
+	}{
+		"alpha":     {alpha, []string{"1"}},
+		"alpha too": {alphaToo, []string{"1"}},
+		"beta":      {beta, []string{"2"}},
+	} {
+		for _, messageID := range test.messageIDs {
+			if event := <-test.subscription.Events(); event.MessageID != messageID {
+				t.Errorf("%s received %+v, want message %s", name, event, messageID)
+			}
+		}
+		select {
+		case event := <-test.subscription.Events():
+			t.Errorf("%s received %+v of another virtual channel", name, event)
+		default:
+		}
+	}
+}
+
+func TestClose(t *testing.T) {
+	hub := New(4)
+	s := hub.Subscribe("alpha")
+	s.Close()
+	// closing twice is harmless
+	s.Close()
+
+	if _, ok := <-s.Events(); ok {
+		t.Error("events of a closed subscription are open")
+	}
+	if hub.Active() {
+		t.Error("hub is active after its only subscriber left")
+	}
+
+	hub.Publish(Event{VirtualChannel: "alpha"})
+}
+
+func TestSlowSubscriber(t *testing.T) {
+	hub := New(2)
+	slow := hub.Subscribe("alpha")
+	other := hub.Subscribe("alpha")
+
+	for range 3 {
+		hub.Publish(Event{VirtualChannel: "alpha"})
+		<-other.Events()
+	}
+
+	// the buffered events are still delivered before the channel closes
+	received := 0
+	for range slow.Events() {
+		received++
+	}
+	if received != 2 {
+		t.Errorf("slow subscriber received %d events, want 2", received)
+	}
+	if !hub.Active() {
+		t.Error("dropping the slow subscriber dropped the other one")
+	}
+}
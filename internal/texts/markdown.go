@@ -0,0 +1,416 @@
+package texts
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+type TokenKind uint8
+
+const (
+	TokenText TokenKind = iota
+	TokenSpace
+	TokenNewline
+	TokenEscape
+	TokenDelimiter
+	TokenCode
+	TokenCodeBlock
+	TokenLink
+	TokenURL
+	TokenEmoji
+	TokenMention
+	TokenBlockMarker
+)
+
+type Token struct {
+	Kind TokenKind
+	Text string
+}
+
+var (
+	emojiPattern      = regexp.MustCompile(`^<a?:\w+:\d+>`)
+	mentionPattern    = regexp.MustCompile(`^(<(@!?|@&|#)\d+>|<t:-?\d+(:[tTdDfFR])?>|</[^<>\n]+:\d+>)`)
+	angleLinkPattern  = regexp.MustCompile(`^<https?://[^\s<>]+>`)
+	maskedLinkPattern = regexp.MustCompile(`^\[[^\[\]\n]*\]\(<?https?://[^\s()<>]+>?\)`)
+	urlPattern        = regexp.MustCompile(`^https?://[^\s<>]+`)
+	blockPattern      = regexp.MustCompile(`^(#{1,3} |-# |>>> |> |[-*] +|\d+\. +)`)
+)
+
+var delimiters = []string{"||", "~~", "**", "__", "*", "_"}
+
+// Tokenize splits Discord markdown into tokens that must not be split when truncating.
+func Tokenize(s string) []Token {
+	tokens := []Token{}
+	lineStart := true
+
+	emit := func(kind TokenKind, text string) {
+		if kind == TokenText && len(tokens) > 0 && tokens[len(tokens)-1].Kind == TokenText {
+			tokens[len(tokens)-1].Text += text
+			return
+		}
+		tokens = append(tokens, Token{Kind: kind, Text: text})
+	}
+
+	for i := 0; i < len(s); {
+		rest := s[i:]
+
+		if lineStart {
+			lineStart = false
+			if m := blockPattern.FindString(rest); m != "" {
+				emit(TokenBlockMarker, m)
+				i += len(m)
+				continue
+			}
+		}
+
+		if kind, n := matchToken(s, i); n > 0 {
+			emit(kind, rest[:n])
+			i += n
+			lineStart = kind == TokenNewline
+			continue
+		}
+
+		_, size := utf8.DecodeRuneInString(rest)
+		emit(TokenText, rest[:size])
+		i += size
+	}
+
+	return tokens
+}
+
+func matchToken(s string, i int) (TokenKind, int) {
+	rest := s[i:]
+
+	switch rest[0] {
+	case '\n':
+		return TokenNewline, 1
+	case ' ', '\t':
+		return TokenSpace, len(rest) - len(strings.TrimLeft(rest, " \t"))
+	case '\\':
+		if len(rest) > 1 {
+			_, size := utf8.DecodeRuneInString(rest[1:])
+			return TokenEscape, 1 + size
+		}
+	case '`':
+		if strings.HasPrefix(rest, "```") {
+			if end := strings.Index(rest[3:], "```"); end >= 0 {
+				return TokenCodeBlock, end + 6
+			}
+		}
+		fence := "`"
+		if strings.HasPrefix(rest, "``") {
+			fence = "``"
+		}
+		if end := strings.Index(rest[len(fence):], fence); end > 0 {
+			return TokenCode, end + 2*len(fence)
+		}
+	case '<':
+		if m := emojiPattern.FindString(rest); m != "" {
+			return TokenEmoji, len(m)
+		}
+		if m := mentionPattern.FindString(rest); m != "" {
+			return TokenMention, len(m)
+		}
+		if m := angleLinkPattern.FindString(rest); m != "" {
+			return TokenLink, len(m)
+		}
+	case '[':
+		if m := maskedLinkPattern.FindString(rest); m != "" {
+			return TokenLink, len(m)
+		}
+	case 'h':
+		if m := urlPattern.FindString(rest); m != "" && (i == 0 || !isWordRune(lastRune(s[:i]))) {
+			return TokenURL, len(m)
+		}
+	}
+
+	for _, delimiter := range delimiters {
+		if !strings.HasPrefix(rest, delimiter) {
+			continue
+		}
+		// underscores inside words, as in snake_case, are not formatting
+		if delimiter[0] == '_' && i > 0 && isWordRune(lastRune(s[:i])) && len(rest) > len(delimiter) && isWordRune(firstRune(rest[len(delimiter):])) {
+			return TokenText, len(delimiter)
+		}
+		return TokenDelimiter, len(delimiter)
+	}
+
+	return TokenText, 0
+}
+
+// Preview renders s as a single line of roughly n visible runes,
+// cutting only on token boundaries and closing formatting left open by the cut.
+func Preview(s string, n int) (preview string, cut bool) {
+	tokens := flattenTokens(Tokenize(s))
+	partners := pairDelimiters(tokens)
+
+	out := []int{}
+	open := []int{}
+	length := 0
+
+	for i, token := range tokens {
+		tokenLength := visibleLength(token)
+
+		if length+tokenLength > n {
+			cut = true
+			if len(out) == 0 {
+				if shortened := shortenToken(token, n); shortened != "" {
+					tokens[i].Text = shortened
+					out = append(out, i)
+				}
+			}
+			break
+		}
+
+		if partners[i] > i {
+			open = append(open, i)
+		} else if partners[i] >= 0 {
+			open = open[:len(open)-1]
+		}
+
+		out = append(out, i)
+		length += tokenLength
+	}
+
+	for len(out) > 0 {
+		last := out[len(out)-1]
+		if tokens[last].Kind == TokenSpace {
+			out = out[:len(out)-1]
+		} else if len(open) > 0 && open[len(open)-1] == last {
+			out = out[:len(out)-1]
+			open = open[:len(open)-1]
+		} else {
+			break
+		}
+	}
+
+	sb := strings.Builder{}
+	for _, i := range out {
+		sb.WriteString(tokens[i].Text)
+	}
+	for i := len(open) - 1; i >= 0; i-- {
+		sb.WriteString(tokens[open[i]].Text)
+	}
+
+	return sb.String(), cut
+}
+
+func visibleLength(token Token) int {
+	switch token.Kind {
+	case TokenEmoji:
+		return 1
+	case TokenLink:
+		if strings.HasPrefix(token.Text, "[") {
+			return utf8.RuneCountInString(token.Text[1:strings.Index(token.Text, "](")])
+		}
+	}
+	return utf8.RuneCountInString(token.Text)
+}
+
+// shortenToken cuts a single token that alone exceeds n runes, or returns "" if it cannot be cut.
+func shortenToken(token Token, n int) string {
+	switch token.Kind {
+	case TokenText:
+		// underscores inside a word become formatting once the cut ends the word after them, and
+		// a cut between a backslash and the backtick it escapes would escape what follows instead
+		return strings.TrimSuffix(strings.TrimRight(token.Text[:NthRune(token.Text, n)], "_"), "\\")
+	case TokenCode:
+		fence := codeFence(token.Text)
+		body := token.Text[len(fence) : len(token.Text)-len(fence)]
+		if body = strings.TrimSpace(body[:NthRune(body, max(1, n-2*len(fence)))]); body == "" {
+			return ""
+		}
+		return inlineCode(fence, body)
+	}
+	return ""
+}
+
+// codeFence returns the backticks opening inline code, whose body may itself start with a backtick.
+func codeFence(code string) string {
+	if strings.HasPrefix(code, "``") {
+		return "``"
+	}
+	return "`"
+}
+
+// inlineCode wraps body in the fence, padding it with spaces where a backtick would merge with the fence.
+func inlineCode(fence, body string) string {
+	if strings.HasPrefix(body, "`") || strings.HasSuffix(body, "`") {
+		body = " " + body + " "
+	}
+	return fence + body + fence
+}
+
+func flattenTokens(tokens []Token) []Token {
+	flat := []Token{}
+
+	for _, token := range tokens {
+		switch token.Kind {
+		case TokenBlockMarker:
+			continue
+		case TokenNewline:
+			token = Token{Kind: TokenSpace, Text: " "}
+		case TokenSpace:
+			token.Text = " "
+		case TokenText:
+			// unmatched backticks could pair up across the lines being joined
+			token.Text = strings.ReplaceAll(token.Text, "`", "\\`")
+		case TokenEscape:
+			// a backslash ending a line escapes nothing
+			if token.Text == "\\\n" {
+				flat = append(flat, Token{Kind: TokenText, Text: "\\"})
+				token = Token{Kind: TokenSpace, Text: " "}
+			}
+		case TokenCode:
+			// inline code may span lines
+			fence := codeFence(token.Text)
+			body := strings.Join(strings.Fields(token.Text[len(fence):len(token.Text)-len(fence)]), " ")
+			if body == "" {
+				continue
+			}
+			token.Text = inlineCode(fence, body)
+		case TokenCodeBlock:
+			body := token.Text[3 : len(token.Text)-3]
+			if lineEnd := strings.IndexByte(body, '\n'); lineEnd >= 0 && !strings.ContainsFunc(body[:lineEnd], unicode.IsSpace) {
+				body = body[lineEnd+1:]
+			}
+			body = strings.Join(strings.Fields(body), " ")
+			if body == "" {
+				continue
+			}
+			if strings.Contains(body, "`") {
+				token = Token{Kind: TokenText, Text: "[code]"}
+			} else {
+				token = Token{Kind: TokenCode, Text: "`" + body + "`"}
+			}
+		}
+
+		if token.Kind == TokenSpace && (len(flat) == 0 || flat[len(flat)-1].Kind == TokenSpace) {
+			continue
+		}
+		flat = append(flat, token)
+	}
+
+	if len(flat) > 0 && flat[len(flat)-1].Kind == TokenSpace {
+		flat = flat[:len(flat)-1]
+	}
+
+	return flat
+}
+
+// pairDelimiters returns, for every token, the index of the matching delimiter or -1.
+func pairDelimiters(tokens []Token) []int {
+	partners := make([]int, len(tokens))
+	stack := []int{}
+
+	for i, token := range tokens {
+		partners[i] = -1
+		if token.Kind != TokenDelimiter {
+			continue
+		}
+
+		opener := -1
+		for j := len(stack) - 1; j >= 0; j-- {
+			if tokens[stack[j]].Text == token.Text {
+				opener = j
+				break
+			}
+		}
+
+		if opener < 0 {
+			stack = append(stack, i)
+			continue
+		}
+
+		partners[stack[opener]] = i
+		partners[i] = stack[opener]
+		stack = stack[:opener]
+	}
+
+	return partners
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+func firstRune(s string) rune {
+	r, _ := utf8.DecodeRuneInString(s)
+	return r
+}
+
+func lastRune(s string) rune {
+	r, _ := utf8.DecodeLastRuneInString(s)
+	return r
+}
+
+// PlainText renders Discord markdown for platforms without formatting,
+// keeping quotes and list markers and spelling out links.
+func PlainText(s string) string {
+	sb := strings.Builder{}
+
+	for _, token := range Tokenize(s) {
+		switch token.Kind {
+		case TokenDelimiter:
+			continue
+		case TokenEscape:
+			sb.WriteString(token.Text[1:])
+		case TokenBlockMarker:
+			switch {
+			case strings.HasPrefix(token.Text, ">"):
+				sb.WriteString("> ")
+			case strings.HasPrefix(token.Text, "-# "), strings.HasPrefix(token.Text, "#"):
+			default:
+				sb.WriteString(token.Text)
+			}
+		case TokenCode:
+			sb.WriteString(strings.Trim(token.Text, "`"))
+		case TokenCodeBlock:
+			body := token.Text[3 : len(token.Text)-3]
+			if lineEnd := strings.IndexByte(body, '\n'); lineEnd >= 0 && !strings.ContainsFunc(body[:lineEnd], unicode.IsSpace) {
+				body = body[lineEnd+1:]
+			}
+			sb.WriteString(strings.Trim(body, "\n"))
+		case TokenLink:
+			if strings.HasPrefix(token.Text, "[") {
+				textEnd := strings.Index(token.Text, "](")
+				sb.WriteString(token.Text[1:textEnd])
+				sb.WriteString(" (")
+				sb.WriteString(strings.Trim(token.Text[textEnd+2:len(token.Text)-1], "<>"))
+				sb.WriteByte(')')
+			} else {
+				sb.WriteString(strings.Trim(token.Text, "<>"))
+			}
+		case TokenEmoji:
+			name := strings.Split(token.Text, ":")[1]
+			sb.WriteByte(':')
+			sb.WriteString(name)
+			sb.WriteByte(':')
+		case TokenMention:
+			sb.WriteString(strings.Trim(token.Text, "<>"))
+		default:
+			sb.WriteString(token.Text)
+		}
+	}
+
+	return sb.String()
+}
+
+var markdownEscaper = strings.NewReplacer(
+	`\`, `\\`, "*", `\*`, "_", `\_`, "~", `\~`, "`", "\\`", "|", `\|`,
+	"[", `\[`, "]", `\]`, "<", `\<`, ">", `\>`, "#", `\#`,
+)
+
+// EscapeMarkdown escapes s so Discord renders it as written.
+func EscapeMarkdown(s string) string {
+	lines := strings.Split(markdownEscaper.Replace(s), "\n")
+	for i, line := range lines {
+		// list markers only format at the start of lines
+		if strings.HasPrefix(line, "- ") {
+			lines[i] = `\` + line
+		}
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,181 @@
+package texts
+
+import (
+	"math/rand"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/quick"
+	"unicode/utf8"
+)
+
+var fragments = []string{
+	"a", "word", "é", "😀", " ", "  ", "\t", "\n", "\n\n", "\\", "`", "``", "```", "```go\n",
+	"*", "**", "_", "__", "~~", "||", "<:e:1>", "<@1>", "<#2>", "<https://a.b/c>",
+	"[text](https://a.b)", "https://a.b/c", "> ", ">>> ", "# ", "-# ", "- ", "1. ",
+}
+
+// markdown is arbitrary Discord markdown, assembled from fragments likely to interact.
+type markdown string
+
+func (markdown) Generate(r *rand.Rand, size int) reflect.Value {
+	sb := strings.Builder{}
+	for range r.Intn(size + 1) {
+		sb.WriteString(fragments[r.Intn(len(fragments))])
+	}
+	return reflect.ValueOf(markdown(sb.String()))
+}
+
+// balancedMarkdown is Discord markdown whose formatting delimiters are all closed.
+type balancedMarkdown string
+
+func (balancedMarkdown) Generate(r *rand.Rand, size int) reflect.Value {
+	return reflect.ValueOf(balancedMarkdown(generateBalanced(r, size, 3)))
+}
+
+func generateBalanced(r *rand.Rand, size, depth int) string {
+	sb := strings.Builder{}
+	for range r.Intn(size + 1) {
+		switch r.Intn(4) {
+		case 0:
+			if depth > 0 {
+				delimiter := delimiters[r.Intn(len(delimiters)-2)]
+				sb.WriteString(delimiter)
+				sb.WriteString("x")
+				sb.WriteString(generateBalanced(r, size/2, depth-1))
+				sb.WriteString("x")
+				sb.WriteString(delimiter)
+				break
+			}
+			fallthrough
+		case 1:
+			sb.WriteString(" ")
+		default:
+			sb.WriteString([]string{"a", "word", "é", "😀", "\n", "<:e:1>", "[text](https://a.b)", "`code`"}[r.Intn(8)])
+		}
+	}
+	return sb.String()
+}
+
+// visibleRunes counts the runes Discord displays of a single line of markdown.
+func visibleRunes(s string) int {
+	n := 0
+	for _, token := range Tokenize(s) {
+		switch token.Kind {
+		case TokenDelimiter, TokenBlockMarker:
+		case TokenEscape:
+			n++
+		case TokenCode:
+			n += utf8.RuneCountInString(strings.Trim(token.Text, "`"))
+		default:
+			n += visibleLength(token)
+		}
+	}
+	return n
+}
+
+func balanced(s string) bool {
+	tokens := flattenTokens(Tokenize(s))
+	for i, partner := range pairDelimiters(tokens) {
+		if tokens[i].Kind == TokenDelimiter && partner < 0 {
+			return false
+		}
+	}
+	return true
+}
+
+var quickConfig = &quick.Config{MaxCount: 5000}
+
+func TestPreviewSingleLine(t *testing.T) {
+	f := func(s markdown, n uint8) bool {
+		preview, _ := Preview(string(s), int(n))
+		return !strings.Contains(preview, "\n")
+	}
+	if err := quick.Check(f, quickConfig); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestPreviewValidUTF8(t *testing.T) {
+	f := func(s markdown, n uint8) bool {
+		preview, _ := Preview(string(s), int(n))
+		return utf8.ValidString(preview)
+	}
+	if err := quick.Check(f, quickConfig); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestPreviewLength(t *testing.T) {
+	f := func(s markdown, n uint8) bool {
+		preview, _ := Preview(string(s), int(n)+1)
+		return visibleRunes(preview) <= int(n)+1
+	}
+	if err := quick.Check(f, quickConfig); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestPreviewBalanced(t *testing.T) {
+	f := func(s balancedMarkdown, n uint8) bool {
+		// underscores inside words do not format, so the generated delimiters are not always balanced
+		if !balanced(string(s)) {
+			return true
+		}
+		preview, _ := Preview(string(s), int(n))
+		return balanced(preview)
+	}
+	if err := quick.Check(f, quickConfig); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestPreview(t *testing.T) {
+	for _, test := range []struct {
+		s       string
+		n       int
+		preview string
+		cut     bool
+	}{
+		{"hello world", 20, "hello world", false},
+		{"hello world", 8, "hello", true},
+		{"# Title\nfirst line\n\nsecond", 40, "Title first line second", false},
+		{"**bold text** rest", 7, "**bold**", true},
+		{"`a\nb` c", 10, "`a b` c", false},
+		{"```go\nfunc main() {\n}\n```", 40, "`func main() { }`", false},
+		{"see [the docs](https://a.b) now", 12, "see [the docs](https://a.b)", true},
+		{"a\\\nb", 10, "a\\ b", false},
+		{"snake__case_word", 7, "snake", true},
+	} {
+		preview, cut := Preview(test.s, test.n)
+		if preview != test.preview || cut != test.cut {
+			t.Errorf("Preview(%q, %d) = %q, %v, want %q, %v", test.s, test.n, preview, cut, test.preview, test.cut)
+		}
+	}
+}
+
+func TestPlainText(t *testing.T) {
+	for _, test := range []struct {
+		s, plain string
+	}{
+		{"**bold** and _it_", "bold and it"},
+		{"> quote\n-# small", "> quote\nsmall"},
+		{"[text](<https://a.b>) <https://c.d>", "text (https://a.b) https://c.d"},
+		{"<:smile:123> <@456>", ":smile: @456"},
+		{"```go\ncode\n```", "code"},
+		{`snake_case \*not bold\*`, "snake_case *not bold*"},
+	} {
+		if plain := PlainText(test.s); plain != test.plain {
+			t.Errorf("PlainText(%q) = %q, want %q", test.s, plain, test.plain)
+		}
+	}
+}
+
+func TestEscapeMarkdown(t *testing.T) {
+	f := func(s string) bool {
+		return PlainText(EscapeMarkdown(s)) == s
+	}
+	if err := quick.Check(f, quickConfig); err != nil {
+		t.Error(err)
+	}
+}
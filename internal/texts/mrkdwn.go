@@ -0,0 +1,138 @@
+package texts
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+var (
+	mrkdwnEscaper   = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+	mrkdwnUnescaper = strings.NewReplacer("&amp;", "&", "&lt;", "<", "&gt;", ">")
+
+	mrkdwnCodePattern   = regexp.MustCompile("(?s)```.*?```|`[^`\n]+`")
+	mrkdwnEntityPattern = regexp.MustCompile(`<([^<>\n]+)>`)
+	mrkdwnBoldPattern   = regexp.MustCompile(`(^|[^\w*])\*([^\s*]|[^\s*][^*\n]*[^\s*])\*($|[^\w*])`)
+	mrkdwnStrikePattern = regexp.MustCompile(`(^|[^\w~])~([^\s~]|[^\s~][^~\n]*[^\s~])~($|[^\w~])`)
+)
+
+// MarkdownToMrkdwn renders Discord markdown as Slack mrkdwn. Formatting Slack lacks, as underline,
+// spoilers and headings, is dropped.
+func MarkdownToMrkdwn(s string) string {
+	tokens := Tokenize(s)
+	partners := pairDelimiters(tokens)
+	sb := strings.Builder{}
+
+	for i, token := range tokens {
+		switch token.Kind {
+		case TokenDelimiter:
+			if partners[i] < 0 {
+				sb.WriteString(token.Text)
+				continue
+			}
+			switch token.Text {
+			case "**":
+				sb.WriteByte('*')
+			case "*", "_":
+				sb.WriteByte('_')
+			case "~~":
+				sb.WriteByte('~')
+			}
+		case TokenEscape:
+			sb.WriteString(mrkdwnEscaper.Replace(token.Text[1:]))
+		case TokenBlockMarker:
+			switch {
+			case strings.HasPrefix(token.Text, ">"):
+				sb.WriteString("&gt; ")
+			case strings.HasPrefix(token.Text, "-# "), strings.HasPrefix(token.Text, "#"):
+			default:
+				sb.WriteString(token.Text)
+			}
+		case TokenCodeBlock:
+			body := token.Text[3 : len(token.Text)-3]
+			if lineEnd := strings.IndexByte(body, '\n'); lineEnd >= 0 && !strings.ContainsFunc(body[:lineEnd], unicode.IsSpace) {
+				body = body[lineEnd+1:]
+			}
+			sb.WriteString("```")
+			sb.WriteString(mrkdwnEscaper.Replace(strings.Trim(body, "\n")))
+			sb.WriteString("```")
+		case TokenLink:
+			if strings.HasPrefix(token.Text, "[") {
+				textEnd := strings.Index(token.Text, "](")
+				sb.WriteByte('<')
+				sb.WriteString(strings.Trim(token.Text[textEnd+2:len(token.Text)-1], "<>"))
+				sb.WriteByte('|')
+				sb.WriteString(mrkdwnEscaper.Replace(token.Text[1:textEnd]))
+				sb.WriteByte('>')
+			} else {
+				sb.WriteString(token.Text)
+			}
+		case TokenEmoji:
+			sb.WriteByte(':')
+			sb.WriteString(strings.Split(token.Text, ":")[1])
+			sb.WriteByte(':')
+		case TokenMention:
+			sb.WriteString(strings.Trim(token.Text, "<>"))
+		default:
+			sb.WriteString(mrkdwnEscaper.Replace(token.Text))
+		}
+	}
+
+	return sb.String()
+}
+
+// MrkdwnToMarkdown renders Slack mrkdwn as Discord markdown. userName resolves user IDs of mentions to names.
+func MrkdwnToMarkdown(s string, userName func(userID string) string) string {
+	sb := strings.Builder{}
+
+	for len(s) > 0 {
+		loc := mrkdwnCodePattern.FindStringIndex(s)
+		if loc == nil {
+			sb.WriteString(convertMrkdwnText(s, userName))
+			break
+		}
+
+		sb.WriteString(convertMrkdwnText(s[:loc[0]], userName))
+		sb.WriteString(mrkdwnUnescaper.Replace(s[loc[0]:loc[1]]))
+		s = s[loc[1]:]
+	}
+
+	return sb.String()
+}
+
+func convertMrkdwnText(s string, userName func(userID string) string) string {
+	s = mrkdwnEntityPattern.ReplaceAllStringFunc(s, func(entity string) string {
+		target, label, hasLabel := strings.Cut(entity[1:len(entity)-1], "|")
+
+		switch {
+		case strings.HasPrefix(target, "@"):
+			if hasLabel {
+				return "@" + label
+			}
+			return "@" + userName(target[1:])
+		case strings.HasPrefix(target, "#"):
+			if hasLabel {
+				return "#" + label
+			}
+			return target
+		case strings.HasPrefix(target, "!"):
+			if hasLabel {
+				return label
+			}
+			// special mentions as <!here>, and subteams and dates without label
+			name, _, _ := strings.Cut(target[1:], "^")
+			return "@" + name
+		case hasLabel:
+			return "[" + label + "](" + target + ")"
+		}
+		return target
+	})
+
+	// a match consumes the character after it, which may start the next match
+	for range 2 {
+		s = mrkdwnBoldPattern.ReplaceAllString(s, "$1**$2**$3")
+		s = mrkdwnStrikePattern.ReplaceAllString(s, "$1~~$2~~$3")
+	}
+
+	return mrkdwnUnescaper.Replace(s)
+}
@@ -0,0 +1,61 @@
+package texts
+
+import "testing"
+
+func TestMarkdownToMrkdwn(t *testing.T) {
+	for _, test := range []struct {
+		s, mrkdwn string
+	}{
+		{"plain text", "plain text"},
+		{"**bold** *italic* _italic_ ~~strike~~", "*bold* _italic_ _italic_ ~strike~"},
+		{"__underline__ ||spoiler||", "underline spoiler"},
+		{"**unpaired", "**unpaired"},
+		{"a < b && c > d", "a &lt; b &amp;&amp; c &gt; d"},
+		{`\*not bold\* \<`, "*not bold* &lt;"},
+		{"> quote", "&gt; quote"},
+		{"# Heading\n-# small", "Heading\nsmall"},
+		{"`**code**`", "`**code**`"},
+		{"```go\nif a < b {}\n```", "```if a &lt; b {}```"},
+		{"```two words\n```", "```two words```"},
+		{"[the docs](https://a.b) and [more](<https://c.d>)", "<https://a.b|the docs> and <https://c.d|more>"},
+		{"[a<b](https://a.b)", "<https://a.b|a&lt;b>"},
+		{"https://a.b", "https://a.b"},
+		{"<:smile:123> <a:wave:456>", ":smile: :wave:"},
+		{"<@123> <#456>", "@123 #456"},
+	} {
+		if mrkdwn := MarkdownToMrkdwn(test.s); mrkdwn != test.mrkdwn {
+			t.Errorf("MarkdownToMrkdwn(%q) = %q, want %q", test.s, mrkdwn, test.mrkdwn)
+		}
+	}
+}
+
+func TestMrkdwnToMarkdown(t *testing.T) {
+	userName := func(userID string) string {
+		return "name-of-" + userID
+	}
+
+	for _, test := range []struct {
+		s, markdown string
+	}{
+		{"plain text", "plain text"},
+		{"*bold* _italic_ ~strike~", "**bold** _italic_ ~~strike~~"},
+		{"*one* *two*", "**one** **two**"},
+		{"*a* ~b~ *c*", "**a** ~~b~~ **c**"},
+		{"2*3*4 snake_case_name", "2*3*4 snake_case_name"},
+		{"* not bold *", "* not bold *"},
+		{"a &lt; b &amp;&amp; c &gt; d", "a < b && c > d"},
+		{"&amp;lt;", "&lt;"},
+		{"`*code* &lt;`", "`*code* <`"},
+		{"```*block*\n~x~```", "```*block*\n~x~```"},
+		{"*before* `code` *after*", "**before** `code` **after**"},
+		{"<https://a.b>", "https://a.b"},
+		{"<https://a.b|the docs>", "[the docs](https://a.b)"},
+		{"<@U1> <@U2|label>", "@name-of-U1 @label"},
+		{"<#C1> <#C2|general>", "#C1 #general"},
+		{"<!here> <!subteam^S1|@team> <!subteam^S2>", "@here @team @subteam"},
+	} {
+		if markdown := MrkdwnToMarkdown(test.s, userName); markdown != test.markdown {
+			t.Errorf("MrkdwnToMarkdown(%q) = %q, want %q", test.s, markdown, test.markdown)
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package texts
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+const MaxWebhookNameLength = 80
+
+var forbiddenWebhookNameWords = []string{"discord", "clyde"}
+
+func ExpandTemplate(template string, vars map[string]string) string {
+	sb := strings.Builder{}
+
+	for len(template) > 0 {
+		start := strings.IndexByte(template, '{')
+		if start < 0 {
+			break
+		}
+		end := strings.IndexByte(template[start:], '}')
+		if end < 0 {
+			break
+		}
+		end += start
+
+		sb.WriteString(template[:start])
+		if value, ok := vars[template[start+1:end]]; ok {
+			sb.WriteString(value)
+		} else {
+			sb.WriteString(template[start : end+1])
+		}
+		template = template[end+1:]
+	}
+	sb.WriteString(template)
+
+	return sb.String()
+}
+
+func Abbreviate(s string, n int) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+
+	words := strings.FieldsFunc(s, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	if len(words) > 1 {
+		sb := strings.Builder{}
+		for _, word := range words {
+			r, _ := utf8.DecodeRuneInString(word)
+			sb.WriteRune(unicode.ToUpper(r))
+		}
+		if initials := sb.String(); utf8.RuneCountInString(initials) <= n {
+			return initials
+		}
+	}
+
+	return strings.TrimRightFunc(s[:NthRune(s, n)], unicode.IsSpace)
+}
+
+// SanitizeWebhookName makes name acceptable as a webhook username:
+// forbidden words are broken up with a zero-width space and the result is cut to MaxWebhookNameLength runes.
+func SanitizeWebhookName(name, fallback string) string {
+	name = strings.TrimSpace(name)
+
+	for _, word := range forbiddenWebhookNameWords {
+		sb := strings.Builder{}
+		last := 0
+
+		for i := 0; i+len(word) <= len(name); i++ {
+			if strings.EqualFold(name[i:i+len(word)], word) {
+				sb.WriteString(name[last : i+1])
+				sb.WriteString("\u200b")
+				last = i + 1
+			}
+		}
+		sb.WriteString(name[last:])
+		name = sb.String()
+	}
+
+	name = strings.TrimRightFunc(name[:NthRune(name, MaxWebhookNameLength)], unicode.IsSpace)
+	if name == "" {
+		return fallback
+	}
+
+	return name
+}
@@ -0,0 +1,81 @@
+package texts
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestExpandTemplate(t *testing.T) {
+	vars := map[string]string{"name": "Ann", "channel": "general", "empty": ""}
+
+	for _, test := range []struct {
+		template, s string
+	}{
+		{"plain", "plain"},
+		{"{name}", "Ann"},
+		{"{name} in #{channel}", "Ann in #general"},
+		{"[{empty}]", "[]"},
+		{"{unknown} {name}", "{unknown} Ann"},
+		{"{name", "{name"},
+		{"name}", "name}"},
+		{"{{name}}", "{{name}}"},
+		{"", ""},
+	} {
+		if s := ExpandTemplate(test.template, vars); s != test.s {
+			t.Errorf("ExpandTemplate(%q) = %q, want %q", test.template, s, test.s)
+		}
+	}
+}
+
+func TestAbbreviate(t *testing.T) {
+	for _, test := range []struct {
+		s           string
+		n           int
+		abbreviated string
+	}{
+		{"short", 10, "short"},
+		{"exactly", 7, "exactly"},
+		{"Bridge Discord Bot", 10, "BDB"},
+		{"the quick-brown fox", 5, "TQBF"},
+		{"ünïcode wörds", 5, "ÜW"},
+		{"oneverylongword", 4, "onev"},
+		{"a b c d e f", 3, "a b"},
+		{"héllo wörld", 3, "HW"},
+		{"abc   ", 4, "abc"},
+	} {
+		if abbreviated := Abbreviate(test.s, test.n); abbreviated != test.abbreviated {
+			t.Errorf("Abbreviate(%q, %d) = %q, want %q", test.s, test.n, abbreviated, test.abbreviated)
+		}
+	}
+}
+
+func TestSanitizeWebhookName(t *testing.T) {
+	for _, test := range []struct {
+		name, sanitized string
+	}{
+		{"Ann", "Ann"},
+		{"  Ann  ", "Ann"},
+		{"discord", "d​iscord"},
+		{"My Discord Fan", "My D​iscord Fan"},
+		{"CLYDE and clyde", "C​LYDE and c​lyde"},
+		{"discordclyde", "d​iscordc​lyde"},
+		{"", "fallback"},
+		{" \t ", "fallback"},
+		{strings.Repeat("é", 100), strings.Repeat("é", MaxWebhookNameLength)},
+		{strings.Repeat("a", 79) + " b", strings.Repeat("a", 79)},
+	} {
+		if sanitized := SanitizeWebhookName(test.name, "fallback"); sanitized != test.sanitized {
+			t.Errorf("SanitizeWebhookName(%q) = %q, want %q", test.name, sanitized, test.sanitized)
+		}
+	}
+
+	// breaking up forbidden words lengthens names, which are still cut to the limit
+	sanitized := SanitizeWebhookName(strings.Repeat("discord", 20), "fallback")
+	if n := utf8.RuneCountInString(sanitized); n != MaxWebhookNameLength {
+		t.Errorf("sanitized name has %d runes, want %d", n, MaxWebhookNameLength)
+	}
+	if strings.Contains(strings.ToLower(sanitized), "discord") {
+		t.Errorf("sanitized name %q contains a forbidden word", sanitized)
+	}
+}
@@ -0,0 +1,33 @@
+package api
+
+import (
+	"context"
+
+	"github.com/mandriota/bridge-discord-bot/internal/transport"
+)
+
+const Name = "api"
+
+// Transport is the endpoint of messages posted to a virtual channel through the HTTP API.
+// Endpoint addresses are virtual channel keys. Messages of the virtual channel are not delivered back to API clients.
+type Transport struct{}
+
+func (Transport) Name() string {
+	return Name
+}
+
+func (Transport) Send(ctx context.Context, endpoint transport.Endpoint, msg transport.Message) (string, error) {
+	return "", transport.ErrUnsupported
+}
+
+func (Transport) Edit(ctx context.Context, endpoint transport.Endpoint, messageID string, msg transport.Message) error {
+	return transport.ErrUnsupported
+}
+
+func (Transport) Delete(ctx context.Context, endpoint transport.Endpoint, messageID string) error {
+	return transport.ErrUnsupported
+}
+
+func (Transport) React(ctx context.Context, endpoint transport.Endpoint, messageID, emoji string) error {
+	return transport.ErrUnsupported
+}
@@ -0,0 +1,386 @@
+package federation
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mandriota/bridge-discord-bot/internal/cache"
+	"github.com/mandriota/bridge-discord-bot/internal/sink"
+	"github.com/mandriota/bridge-discord-bot/internal/transport"
+)
+
+const (
+	Name = "federation"
+
+	// InstanceHeader names the instance sending an event, whose secret signs it.
+	InstanceHeader = "X-Bridge-Instance"
+	EventsPath     = "/federation/v1/events"
+
+	maxClockSkew    = 5 * time.Minute
+	maxSendAttempts = 3
+	sendRetryDelay  = time.Second
+	replayCacheSize = 10000
+)
+
+var (
+	errInvalidSignature = errors.New("invalid signature")
+	errReplayed         = errors.New("event was already received")
+)
+
+type Peer struct {
+	// URL is the base URL the peer serves federation events on.
+	URL string
+	// Secret is shared with the peer and signs events in both directions.
+	Secret string
+}
+
+type Config struct {
+	// InstanceName identifies this instance to its peers.
+	InstanceName string
+	ListenAddr   string
+	Peers        map[string]Peer
+	MaxBodySize  int64
+}
+
+type Attachment struct {
+	Filename     string   `json:"filename"`
+	Description  string   `json:"description,omitempty"`
+	ContentType  string   `json:"content_type,omitempty"`
+	URL          string   `json:"url,omitempty"`
+	Size         int      `json:"size"`
+	Data         []byte   `json:"data,omitempty"`
+	DurationSecs *float64 `json:"duration_secs,omitempty"`
+	Waveform     *string  `json:"waveform,omitempty"`
+}
+
+// Message is a message as exchanged between instances. ID and ReplyTo are IDs generated
+// by the instance that sent the message first, which both instances map to their own messages.
+type Message struct {
+	ID          string       `json:"id"`
+	AuthorID    string       `json:"author_id,omitempty"`
+	Username    string       `json:"username,omitempty"`
+	AvatarURL   string       `json:"avatar_url,omitempty"`
+	Content     string       `json:"content,omitempty"`
+	ReplyTo     string       `json:"reply_to,omitempty"`
+	Attachments []Attachment `json:"attachments,omitempty"`
+	Voice       bool         `json:"voice,omitempty"`
+}
+
+// Event is the body of requests peers send to each other. VirtualChannel is the hash of the shared virtual channel key.
+type Event struct {
+	Type           string  `json:"type"`
+	VirtualChannel string  `json:"virtual_channel"`
+	Message        Message `json:"message"`
+}
+
+// Transport bridges virtual channels with other instances of the bridge. Endpoint addresses
+// are peer names and hashes of virtual channel keys shared with them, joined by a slash.
+//
+// Federated channels must not form cycles, as a message would circle through them indefinitely.
+type Transport struct {
+	cfg       Config
+	endpoints map[string]transport.Endpoint
+	client    *http.Client
+	logger    *slog.Logger
+
+	// signatures of accepted events, kept until their timestamps are out of the accepted window
+	signatures *cache.TTL[string]
+}
+
+func New(cfg Config, endpoints []transport.Endpoint, logger *slog.Logger) *Transport {
+	t := &Transport{
+		cfg:        cfg,
+		endpoints:  map[string]transport.Endpoint{},
+		client:     &http.Client{Timeout: time.Minute},
+		logger:     logger,
+		signatures: cache.NewTTL[string](replayCacheSize, 2*maxClockSkew),
+	}
+	for _, endpoint := range endpoints {
+		t.endpoints[endpoint.Address] = endpoint
+	}
+	return t
+}
+
+// Address returns the endpoint address of a virtual channel shared with a peer.
+func Address(peerName, virtualChannelKeyHash string) string {
+	return peerName + "/" + virtualChannelKeyHash
+}
+
+func (t *Transport) Name() string {
+	return Name
+}
+
+func toMessage(id string, msg transport.Message) Message {
+	m := Message{
+		ID:        id,
+		AuthorID:  msg.AuthorID,
+		Username:  msg.Username,
+		AvatarURL: msg.AvatarURL,
+		Content:   msg.Content,
+		ReplyTo:   msg.ReplyTo,
+		Voice:     msg.Voice,
+	}
+	for _, file := range msg.Files {
+		m.Attachments = append(m.Attachments, Attachment{
+			Filename:     file.Name,
+			Description:  file.Description,
+			ContentType:  file.ContentType,
+			URL:          file.URL,
+			Size:         file.Size,
+			Data:         file.Body,
+			DurationSecs: file.DurationSecs,
+			Waveform:     file.Waveform,
+		})
+	}
+	return m
+}
+
+// post delivers an event to the peer of the endpoint, retrying on network errors and server errors.
+func (t *Transport) post(ctx context.Context, endpoint transport.Endpoint, eventType string, msg Message) error {
+	peerName, virtualChannel, _ := strings.Cut(endpoint.Address, "/")
+	peer, ok := t.cfg.Peers[peerName]
+	if !ok {
+		return fmt.Errorf("federation: unknown peer %q", peerName)
+	}
+
+	body, err := json.Marshal(Event{Type: eventType, VirtualChannel: virtualChannel, Message: msg})
+	if err != nil {
+		return err
+	}
+
+	for attempt := 1; ; attempt++ {
+		err := t.postOnce(ctx, peer, body)
+
+		retryable := (*retryableError)(nil)
+		if !errors.As(err, &retryable) || attempt == maxSendAttempts {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(sendRetryDelay << (attempt - 1)):
+		}
+	}
+}
+
+type retryableError struct {
+	err error
+}
+
+func (e *retryableError) Error() string {
+	return e.err.Error()
+}
+
+func (t *Transport) postOnce(ctx context.Context, peer Peer, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimSuffix(peer.URL, "/")+EventsPath, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	timestamp := time.Now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(InstanceHeader, t.cfg.InstanceName)
+	req.Header.Set(sink.TimestampHeader, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(sink.SignatureHeader, sink.Sign(peer.Secret, timestamp, body))
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return &retryableError{err}
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		result := struct {
+			Error string `json:"error"`
+		}{}
+		json.NewDecoder(io.LimitReader(resp.Body, 1<<10)).Decode(&result)
+
+		err := fmt.Errorf("federation: peer responded %s: %s", resp.Status, result.Error)
+		if resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests {
+			return &retryableError{err}
+		}
+		return err
+	}
+	return nil
+}
+
+func (t *Transport) Send(ctx context.Context, endpoint transport.Endpoint, msg transport.Message) (string, error) {
+	// prefixed by the instance name, so IDs generated by different instances never collide
+	id := t.cfg.InstanceName + ":" + transport.NewID().String()
+	if err := t.post(ctx, endpoint, sink.EventCreate, toMessage(id, msg)); err != nil {
+		return "", err
+	}
+	return id, nil
+}
+
+func (t *Transport) Edit(ctx context.Context, endpoint transport.Endpoint, messageID string, msg transport.Message) error {
+	msg.Files = nil
+	return t.post(ctx, endpoint, sink.EventUpdate, toMessage(messageID, msg))
+}
+
+func (t *Transport) Delete(ctx context.Context, endpoint transport.Endpoint, messageID string) error {
+	return t.post(ctx, endpoint, sink.EventDelete, Message{ID: messageID})
+}
+
+func (t *Transport) React(ctx context.Context, endpoint transport.Endpoint, messageID, emoji string) error {
+	return transport.ErrUnsupported
+}
+
+//=:federation:server
+
+// Listen serves the events peers send until ctx is done.
+func (t *Transport) Listen(ctx context.Context, receiver transport.Receiver) error {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST "+EventsPath, func(w http.ResponseWriter, r *http.Request) {
+		t.handleEvent(w, r, receiver)
+	})
+
+	server := &http.Server{
+		Addr:    t.cfg.ListenAddr,
+		Handler: mux,
+	}
+
+	stop := context.AfterFunc(ctx, func() {
+		server.Shutdown(context.Background())
+	})
+	defer stop()
+
+	if err := server.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": message})
+}
+
+// verify checks the signature of the request by the peer it claims to come from and rejects replays.
+// It returns cache.ErrFull when too many events arrived within the accepted window to tell replays apart.
+func (t *Transport) verify(r *http.Request, peerName string, body []byte) error {
+	peer, ok := t.cfg.Peers[peerName]
+	if !ok {
+		return errInvalidSignature
+	}
+
+	timestamp, err := strconv.ParseInt(r.Header.Get(sink.TimestampHeader), 10, 64)
+	if err != nil {
+		return errInvalidSignature
+	}
+	if skew := time.Since(time.Unix(timestamp, 0)); skew > maxClockSkew || skew < -maxClockSkew {
+		return errInvalidSignature
+	}
+
+	signature := r.Header.Get(sink.SignatureHeader)
+	if !hmac.Equal([]byte(signature), []byte(sink.Sign(peer.Secret, timestamp, body))) {
+		return errInvalidSignature
+	}
+
+	// a signature is only accepted once within the window its timestamp is valid for
+	if added, err := t.signatures.TryAdd(signature); err != nil {
+		return err
+	} else if !added {
+		return errReplayed
+	}
+	return nil
+}
+
+func (t *Transport) handleEvent(w http.ResponseWriter, r *http.Request, receiver transport.Receiver) {
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, t.cfg.MaxBodySize))
+	if maxBytesErr := (*http.MaxBytesError)(nil); errors.As(err, &maxBytesErr) {
+		writeError(w, http.StatusRequestEntityTooLarge, "request body too large")
+		return
+	} else if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	peerName := r.Header.Get(InstanceHeader)
+	if err := t.verify(r, peerName, body); errors.Is(err, cache.ErrFull) {
+		// the peer retries later, once older signatures have expired
+		t.logger.Warn("federation replay cache is full", "peer", peerName)
+		writeError(w, http.StatusServiceUnavailable, "too many events")
+		return
+	} else if err != nil {
+		t.logger.Warn("rejected federation event", "error", err, "peer", peerName, "remote_addr", r.RemoteAddr)
+		writeError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	event := Event{}
+	if err := json.Unmarshal(body, &event); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if event.Message.ID == "" {
+		writeError(w, http.StatusBadRequest, "message has no ID")
+		return
+	}
+
+	endpoint, ok := t.endpoints[Address(peerName, event.VirtualChannel)]
+	if !ok {
+		writeError(w, http.StatusNotFound, "virtual channel is not federated with "+t.cfg.InstanceName)
+		return
+	}
+
+	switch event.Type {
+	case sink.EventCreate:
+		receiver.ReceiveCreate(endpoint, t.incoming(peerName, event.Message))
+	case sink.EventUpdate:
+		receiver.ReceiveUpdate(endpoint, t.incoming(peerName, event.Message))
+	case sink.EventDelete:
+		receiver.ReceiveDelete(endpoint, event.Message.ID)
+	default:
+		writeError(w, http.StatusBadRequest, "unknown event type")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (t *Transport) incoming(peerName string, m Message) transport.Incoming {
+	incoming := transport.Incoming{
+		Message: transport.Message{
+			AuthorID:  m.AuthorID,
+			Username:  m.Username,
+			AvatarURL: m.AvatarURL,
+			Content:   m.Content,
+			ReplyTo:   m.ReplyTo,
+			Voice:     m.Voice,
+		},
+		ID:     m.ID,
+		Origin: peerName,
+	}
+	if incoming.Username == "" {
+		incoming.Username = peerName
+	}
+	for _, attachment := range m.Attachments {
+		if attachment.Data != nil {
+			attachment.Size = len(attachment.Data)
+		}
+		incoming.Files = append(incoming.Files, transport.File{
+			Name:         attachment.Filename,
+			Description:  attachment.Description,
+			ContentType:  attachment.ContentType,
+			URL:          attachment.URL,
+			Size:         attachment.Size,
+			Body:         attachment.Data,
+			DurationSecs: attachment.DurationSecs,
+			Waveform:     attachment.Waveform,
+		})
+	}
+	return incoming
+}
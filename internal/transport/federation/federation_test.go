@@ -0,0 +1,284 @@
+package federation
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mandriota/bridge-discord-bot/internal/cache"
+	"github.com/mandriota/bridge-discord-bot/internal/sink"
+	"github.com/mandriota/bridge-discord-bot/internal/transport"
+)
+
+const (
+	secret        = "shared-secret"
+	channelHash   = "c0ffee"
+	maxBodySize   = 1 << 20
+	createMessage = `{"type":"message.create","virtual_channel":"c0ffee","message":{"id":"beta:1","username":"Bob","content":"hi"}}`
+)
+
+type received struct {
+	kind string
+	msg  transport.Incoming
+}
+
+type receiver struct {
+	endpoint transport.Endpoint
+
+	mu       sync.Mutex
+	received []received
+}
+
+func (r *receiver) ReceiveCreate(endpoint transport.Endpoint, msg transport.Incoming) {
+	r.receive(endpoint, received{"create", msg})
+}
+
+func (r *receiver) ReceiveUpdate(endpoint transport.Endpoint, msg transport.Incoming) {
+	r.receive(endpoint, received{"update", msg})
+}
+
+func (r *receiver) ReceiveDelete(endpoint transport.Endpoint, messageID string) {
+	r.receive(endpoint, received{"delete", transport.Incoming{ID: messageID}})
+}
+
+func (r *receiver) receive(endpoint transport.Endpoint, got received) {
+	if endpoint != r.endpoint {
+		panic(fmt.Sprintf("received for endpoint %+v", endpoint))
+	}
+	r.mu.Lock()
+	r.received = append(r.received, got)
+	r.mu.Unlock()
+}
+
+func newTransport(instanceName, peerName, peerURL string) (*Transport, *receiver) {
+	endpoint := transport.Endpoint{ChannelID: transport.NewID(), Transport: Name, Address: Address(peerName, channelHash)}
+	tr := New(Config{
+		InstanceName: instanceName,
+		Peers:        map[string]Peer{peerName: {URL: peerURL, Secret: secret}},
+		MaxBodySize:  maxBodySize,
+	}, []transport.Endpoint{endpoint}, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	return tr, &receiver{endpoint: endpoint}
+}
+
+// post signs the body as the peer would at the given time and passes it to handleEvent.
+func post(tr *Transport, r transport.Receiver, peerName, peerSecret string, at time.Time, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, EventsPath, strings.NewReader(body))
+	req.Header.Set(InstanceHeader, peerName)
+	req.Header.Set(sink.TimestampHeader, strconv.FormatInt(at.Unix(), 10))
+	req.Header.Set(sink.SignatureHeader, sink.Sign(peerSecret, at.Unix(), []byte(body)))
+
+	w := httptest.NewRecorder()
+	tr.handleEvent(w, req, r)
+	return w
+}
+
+func TestVerify(t *testing.T) {
+	now := time.Now()
+
+	for _, test := range []struct {
+		name       string
+		peerName   string
+		peerSecret string
+		at         time.Time
+		status     int
+	}{
+		{"valid", "beta", secret, now, http.StatusNoContent},
+		{"slightly skewed", "beta", secret, now.Add(-maxClockSkew + time.Minute), http.StatusNoContent},
+		{"ahead of time", "beta", secret, now.Add(maxClockSkew - time.Minute), http.StatusNoContent},
+		{"unknown peer", "gamma", secret, now, http.StatusUnauthorized},
+		{"wrong secret", "beta", "other-secret", now, http.StatusUnauthorized},
+		{"too old", "beta", secret, now.Add(-maxClockSkew - time.Minute), http.StatusUnauthorized},
+		{"too far ahead", "beta", secret, now.Add(maxClockSkew + time.Minute), http.StatusUnauthorized},
+	} {
+		tr, r := newTransport("alpha", "beta", "")
+		if w := post(tr, r, test.peerName, test.peerSecret, test.at, createMessage); w.Code != test.status {
+			t.Errorf("%s: responded %d %s, want %d", test.name, w.Code, w.Body, test.status)
+		}
+		if relayed := len(r.received) > 0; relayed != (test.status == http.StatusNoContent) {
+			t.Errorf("%s: relayed %+v", test.name, r.received)
+		}
+	}
+}
+
+func TestVerifyHeaders(t *testing.T) {
+	tr, r := newTransport("alpha", "beta", "")
+	now := time.Now().Unix()
+
+	for name, modify := range map[string]func(req *http.Request){
+		"missing timestamp": func(req *http.Request) { req.Header.Del(sink.TimestampHeader) },
+		"changed timestamp": func(req *http.Request) { req.Header.Set(sink.TimestampHeader, strconv.FormatInt(now-1, 10)) },
+		"missing signature": func(req *http.Request) { req.Header.Del(sink.SignatureHeader) },
+		"missing instance":  func(req *http.Request) { req.Header.Del(InstanceHeader) },
+	} {
+		req := httptest.NewRequest(http.MethodPost, EventsPath, strings.NewReader(createMessage))
+		req.Header.Set(InstanceHeader, "beta")
+		req.Header.Set(sink.TimestampHeader, strconv.FormatInt(now, 10))
+		req.Header.Set(sink.SignatureHeader, sink.Sign(secret, now, []byte(createMessage)))
+		modify(req)
+
+		w := httptest.NewRecorder()
+		tr.handleEvent(w, req, r)
+		if w.Code != http.StatusUnauthorized {
+			t.Errorf("%s: responded %d", name, w.Code)
+		}
+	}
+
+	// the signature covers the body
+	req := httptest.NewRequest(http.MethodPost, EventsPath, strings.NewReader(strings.Replace(createMessage, "hi", "bye", 1)))
+	req.Header.Set(InstanceHeader, "beta")
+	req.Header.Set(sink.TimestampHeader, strconv.FormatInt(now, 10))
+	req.Header.Set(sink.SignatureHeader, sink.Sign(secret, now, []byte(createMessage)))
+	w := httptest.NewRecorder()
+	tr.handleEvent(w, req, r)
+	if w.Code != http.StatusUnauthorized || len(r.received) != 0 {
+		t.Errorf("tampered body: responded %d, relayed %+v", w.Code, r.received)
+	}
+}
+
+func TestReplay(t *testing.T) {
+	tr, r := newTransport("alpha", "beta", "")
+	now := time.Now()
+
+	if w := post(tr, r, "beta", secret, now, createMessage); w.Code != http.StatusNoContent {
+		t.Fatalf("responded %d %s", w.Code, w.Body)
+	}
+	if w := post(tr, r, "beta", secret, now, createMessage); w.Code != http.StatusUnauthorized {
+		t.Errorf("replay responded %d", w.Code)
+	}
+	// the same event signed at another time is a retry of the peer, not a replay
+	if w := post(tr, r, "beta", secret, now.Add(time.Second), createMessage); w.Code != http.StatusNoContent {
+		t.Errorf("resent event responded %d", w.Code)
+	}
+	if len(r.received) != 2 {
+		t.Errorf("relayed %d events, want 2", len(r.received))
+	}
+}
+
+func TestReplayCacheFull(t *testing.T) {
+	tr, r := newTransport("alpha", "beta", "")
+	tr.signatures = cache.NewTTL[string](1, 2*maxClockSkew)
+	now := time.Now()
+
+	if w := post(tr, r, "beta", secret, now, createMessage); w.Code != http.StatusNoContent {
+		t.Fatalf("responded %d %s", w.Code, w.Body)
+	}
+	// a full cache rejects new events rather than forgetting signatures that are still valid
+	if w := post(tr, r, "beta", secret, now.Add(time.Second), createMessage); w.Code != http.StatusServiceUnavailable {
+		t.Errorf("event beyond capacity responded %d", w.Code)
+	}
+	if w := post(tr, r, "beta", secret, now, createMessage); w.Code != http.StatusUnauthorized {
+		t.Errorf("replay responded %d", w.Code)
+	}
+	if len(r.received) != 1 {
+		t.Errorf("relayed %d events, want 1", len(r.received))
+	}
+}
+
+func TestHandleEvent(t *testing.T) {
+	tr, r := newTransport("alpha", "beta", "")
+	now := time.Now()
+
+	for i, test := range []struct {
+		body   string
+		status int
+	}{
+		{createMessage, http.StatusNoContent},
+		{`{"type":"message.create","virtual_channel":"c0ffee","message":{"id":"beta:2","attachments":[{"filename":"a.txt","data":"aGVsbG8=","size":100},{"filename":"b.png","url":"https://cdn.example/b.png","size":7}]}}`, http.StatusNoContent},
+		{`{"type":"message.update","virtual_channel":"c0ffee","message":{"id":"beta:1","username":"Bob","content":"edited"}}`, http.StatusNoContent},
+		{`{"type":"message.delete","virtual_channel":"c0ffee","message":{"id":"beta:1"}}`, http.StatusNoContent},
+		{`{"type":"message.create","virtual_channel":"deadbeef","message":{"id":"beta:3"}}`, http.StatusNotFound},
+		{`{"type":"message.pin","virtual_channel":"c0ffee","message":{"id":"beta:3"}}`, http.StatusBadRequest},
+		{`{"type":"message.create","virtual_channel":"c0ffee","message":{}}`, http.StatusBadRequest},
+		{`not json`, http.StatusBadRequest},
+	} {
+		// every event is signed at another second, so none of them is a replay
+		if w := post(tr, r, "beta", secret, now.Add(time.Duration(i)*time.Second), test.body); w.Code != test.status {
+			t.Errorf("%s: responded %d %s, want %d", test.body, w.Code, w.Body, test.status)
+		}
+	}
+
+	want := []received{
+		{"create", transport.Incoming{Message: transport.Message{Username: "Bob", Content: "hi"}, ID: "beta:1", Origin: "beta"}},
+		{"create", transport.Incoming{Message: transport.Message{Username: "beta", Files: []transport.File{
+			{Name: "a.txt", Size: 5, Body: []byte("hello")},
+			{Name: "b.png", URL: "https://cdn.example/b.png", Size: 7},
+		}}, ID: "beta:2", Origin: "beta"}},
+		{"update", transport.Incoming{Message: transport.Message{Username: "Bob", Content: "edited"}, ID: "beta:1", Origin: "beta"}},
+		{"delete", transport.Incoming{ID: "beta:1"}},
+	}
+	if len(r.received) != len(want) {
+		t.Fatalf("received %+v, want %+v", r.received, want)
+	}
+	for i := range want {
+		if r.received[i].kind != want[i].kind || fmt.Sprint(r.received[i].msg) != fmt.Sprint(want[i].msg) {
+			t.Errorf("received %s %+v, want %s %+v", r.received[i].kind, r.received[i].msg, want[i].kind, want[i].msg)
+		}
+	}
+}
+
+func TestHandleEventTooLarge(t *testing.T) {
+	tr, r := newTransport("alpha", "beta", "")
+	body := `{"type":"message.create","virtual_channel":"c0ffee","message":{"id":"beta:1","content":"` + strings.Repeat("x", maxBodySize) + `"}}`
+
+	if w := post(tr, r, "beta", secret, time.Now(), body); w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("responded %d", w.Code)
+	}
+}
+
+func TestSendRoundTrip(t *testing.T) {
+	var beta *Transport
+	var betaReceiver *receiver
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path != EventsPath {
+			http.NotFound(w, req)
+			return
+		}
+		beta.handleEvent(w, req, betaReceiver)
+	}))
+	defer server.Close()
+
+	alpha, _ := newTransport("alpha", "beta", server.URL+"/")
+	beta, betaReceiver = newTransport("beta", "alpha", "")
+	endpoint := alpha.endpoints[Address("beta", channelHash)]
+
+	id, err := alpha.Send(context.Background(), endpoint, transport.Message{Username: "Ann", Content: "hello", ReplyTo: "beta:7"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(id, "alpha:") {
+		t.Errorf("sent message has ID %q", id)
+	}
+	if err := alpha.Edit(context.Background(), endpoint, id, transport.Message{Username: "Ann", Content: "edited"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := alpha.Delete(context.Background(), endpoint, id); err != nil {
+		t.Fatal(err)
+	}
+
+	got := []string{}
+	for _, rec := range betaReceiver.received {
+		encoded, _ := json.Marshal(rec.msg)
+		got = append(got, rec.kind+" "+string(encoded))
+	}
+	if len(got) != 3 ||
+		betaReceiver.received[0].msg.ID != id || betaReceiver.received[0].msg.ReplyTo != "beta:7" || betaReceiver.received[0].msg.Origin != "alpha" ||
+		betaReceiver.received[1].kind != "update" || betaReceiver.received[1].msg.Content != "edited" ||
+		betaReceiver.received[2].kind != "delete" || betaReceiver.received[2].msg.ID != id {
+		t.Errorf("peer received %v", got)
+	}
+
+	// client errors of the peer are not retried
+	unknown := transport.Endpoint{ChannelID: transport.NewID(), Transport: Name, Address: Address("beta", "deadbeef")}
+	if _, err := alpha.Send(context.Background(), unknown, transport.Message{Content: "lost"}); err == nil || !strings.Contains(err.Error(), "404") {
+		t.Errorf("sending to an unshared channel returned %v", err)
+	}
+}
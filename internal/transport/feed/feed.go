@@ -0,0 +1,335 @@
+package feed
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"net/http"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/mandriota/bridge-discord-bot/internal/transport"
+)
+
+const Name = "feed"
+
+// Transport is the endpoint of entries posted to a virtual channel from RSS and Atom feeds.
+// Endpoint addresses are feed IDs. Messages of the virtual channel are not delivered back to feeds.
+type Transport struct{}
+
+func (Transport) Name() string {
+	return Name
+}
+
+func (Transport) Send(ctx context.Context, endpoint transport.Endpoint, msg transport.Message) (string, error) {
+	return "", transport.ErrUnsupported
+}
+
+func (Transport) Edit(ctx context.Context, endpoint transport.Endpoint, messageID string, msg transport.Message) error {
+	return transport.ErrUnsupported
+}
+
+func (Transport) Delete(ctx context.Context, endpoint transport.Endpoint, messageID string) error {
+	return transport.ErrUnsupported
+}
+
+func (Transport) React(ctx context.Context, endpoint transport.Endpoint, messageID, emoji string) error {
+	return transport.ErrUnsupported
+}
+
+//=:feed:parsing
+
+type Entry struct {
+	// GUID identifies the entry within its feed, falling back to its link or title when the feed gives no ID.
+	GUID      string
+	Title     string
+	Link      string
+	Summary   string
+	Published time.Time
+}
+
+type Feed struct {
+	Title string
+	Link  string
+	// Entries are ordered from oldest to newest.
+	Entries []Entry
+}
+
+type rssItem struct {
+	Title       string `xml:"title"`
+	Link        string `xml:"link"`
+	GUID        string `xml:"guid"`
+	Description string `xml:"description"`
+	PubDate     string `xml:"pubDate"`
+	Date        string `xml:"http://purl.org/dc/elements/1.1/ date"`
+}
+
+type rssChannel struct {
+	Title string    `xml:"title"`
+	Link  string    `xml:"link"`
+	Items []rssItem `xml:"item"`
+}
+
+type rss struct {
+	Channel rssChannel `xml:"channel"`
+	// RSS 1.0 puts items next to the channel
+	Items []rssItem `xml:"item"`
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr"`
+}
+
+// atomText is a text construct, whose XHTML is markup rather than escaped text.
+type atomText struct {
+	Type     string `xml:"type,attr"`
+	Text     string `xml:",chardata"`
+	InnerXML string `xml:",innerxml"`
+}
+
+func (t atomText) String() string {
+	if t.Type == "xhtml" {
+		return t.InnerXML
+	}
+	return t.Text
+}
+
+type atomEntry struct {
+	ID        string     `xml:"id"`
+	Title     atomText   `xml:"title"`
+	Links     []atomLink `xml:"link"`
+	Summary   atomText   `xml:"summary"`
+	Content   atomText   `xml:"content"`
+	Published string     `xml:"published"`
+	Updated   string     `xml:"updated"`
+}
+
+type atom struct {
+	Title   atomText    `xml:"title"`
+	Links   []atomLink  `xml:"link"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+var timeLayouts = []string{
+	time.RFC3339,
+	time.RFC1123Z,
+	time.RFC1123,
+	"Mon, 2 Jan 2006 15:04:05 -0700",
+	"Mon, 2 Jan 2006 15:04:05 MST",
+	"2 Jan 2006 15:04:05 -0700",
+	time.RFC822Z,
+	time.RFC822,
+}
+
+func parseTime(s string) time.Time {
+	s = strings.TrimSpace(s)
+	for _, layout := range timeLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+func alternateLink(links []atomLink) string {
+	for _, link := range links {
+		if link.Rel == "" || link.Rel == "alternate" {
+			return link.Href
+		}
+	}
+	return ""
+}
+
+// windows1252 maps bytes 0x80 to 0x9F of Windows-1252, which differ from Latin-1, to runes.
+// Bytes undefined in Windows-1252 keep their Latin-1 control characters.
+var windows1252 = [32]rune{
+	'€', 0x81, '‚', 'ƒ', '„', '…', '†', '‡', 'ˆ', '‰', 'Š', '‹', 'Œ', 0x8D, 'Ž', 0x8F,
+	0x90, '‘', '’', '“', '”', '•', '–', '—', '˜', '™', 'š', '›', 'œ', 0x9D, 'ž', 'Ÿ',
+}
+
+// charsetReader decodes Latin-1 and Windows-1252, the only encodings besides UTF-8 common among feeds.
+func charsetReader(charset string, input io.Reader) (io.Reader, error) {
+	charset = strings.ToLower(charset)
+	switch charset {
+	case "iso-8859-1", "latin1", "latin-1", "windows-1252", "cp1252":
+		data, err := io.ReadAll(input)
+		if err != nil {
+			return nil, err
+		}
+
+		decoded := make([]byte, 0, len(data))
+		for _, b := range data {
+			r := rune(b)
+			if 0x80 <= b && b < 0xA0 && (charset == "windows-1252" || charset == "cp1252") {
+				r = windows1252[b-0x80]
+			}
+			decoded = utf8.AppendRune(decoded, r)
+		}
+		return bytes.NewReader(decoded), nil
+	}
+	return nil, fmt.Errorf("unsupported charset %q", charset)
+}
+
+func newDecoder(data []byte) *xml.Decoder {
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	decoder.CharsetReader = charsetReader
+	// feeds in the wild often contain HTML entities and unescaped ampersands
+	decoder.Strict = false
+	decoder.Entity = xml.HTMLEntity
+	return decoder
+}
+
+// Parse parses an RSS 0.9x, 1.0 or 2.0, or Atom feed.
+func Parse(data []byte) (Feed, error) {
+	root := ""
+	for decoder := newDecoder(data); root == ""; {
+		token, err := decoder.Token()
+		if err != nil {
+			return Feed{}, fmt.Errorf("failed to parse feed: %w", err)
+		}
+		if start, ok := token.(xml.StartElement); ok {
+			root = start.Name.Local
+		}
+	}
+
+	f := Feed{}
+
+	switch root {
+	case "rss", "RDF":
+		doc := rss{}
+		if err := newDecoder(data).Decode(&doc); err != nil {
+			return Feed{}, fmt.Errorf("failed to parse RSS feed: %w", err)
+		}
+
+		f.Title = doc.Channel.Title
+		f.Link = doc.Channel.Link
+		for _, item := range append(doc.Channel.Items, doc.Items...) {
+			published := item.PubDate
+			if published == "" {
+				published = item.Date
+			}
+			f.Entries = append(f.Entries, Entry{
+				GUID:      item.GUID,
+				Title:     item.Title,
+				Link:      item.Link,
+				Summary:   item.Description,
+				Published: parseTime(published),
+			})
+		}
+	case "feed":
+		doc := atom{}
+		if err := newDecoder(data).Decode(&doc); err != nil {
+			return Feed{}, fmt.Errorf("failed to parse Atom feed: %w", err)
+		}
+
+		f.Title = doc.Title.String()
+		f.Link = alternateLink(doc.Links)
+		for _, entry := range doc.Entries {
+			summary := entry.Summary.String()
+			if summary == "" {
+				summary = entry.Content.String()
+			}
+			published := entry.Published
+			if published == "" {
+				published = entry.Updated
+			}
+			f.Entries = append(f.Entries, Entry{
+				GUID:      entry.ID,
+				Title:     entry.Title.String(),
+				Link:      alternateLink(entry.Links),
+				Summary:   summary,
+				Published: parseTime(published),
+			})
+		}
+	default:
+		return Feed{}, fmt.Errorf("unknown feed format <%s>", root)
+	}
+
+	for i := range f.Entries {
+		entry := &f.Entries[i]
+		entry.Title = strings.TrimSpace(htmlToText(entry.Title))
+		entry.Link = strings.TrimSpace(entry.Link)
+		entry.GUID = strings.TrimSpace(entry.GUID)
+
+		if entry.GUID == "" {
+			entry.GUID = entry.Link
+		}
+		if entry.GUID == "" {
+			entry.GUID = entry.Title + "\n" + entry.Published.String()
+		}
+	}
+	f.Title = strings.TrimSpace(htmlToText(f.Title))
+
+	// feeds usually list the newest entries first, but only dates tell for sure
+	slices.Reverse(f.Entries)
+	if !slices.ContainsFunc(f.Entries, func(entry Entry) bool { return entry.Published.IsZero() }) {
+		slices.SortStableFunc(f.Entries, func(a, b Entry) int {
+			return a.Published.Compare(b.Published)
+		})
+	}
+
+	return f, nil
+}
+
+var (
+	htmlBreakPattern  = regexp.MustCompile(`(?i)<br\s*/?>|</(p|div|li|h[1-6]|blockquote|pre)>`)
+	htmlTagPattern    = regexp.MustCompile(`(?s)<!--.*?-->|<[^>]*>`)
+	blankLinesPattern = regexp.MustCompile(`\n{3,}`)
+	spaceRunsPattern  = regexp.MustCompile(`[ \t\r\f\v\x{00a0}]+`)
+)
+
+// htmlToText reduces HTML of titles and summaries to plain text, keeping line breaks of block elements.
+func htmlToText(s string) string {
+	s = htmlBreakPattern.ReplaceAllString(s, "\n")
+	s = htmlTagPattern.ReplaceAllString(s, "")
+	s = html.UnescapeString(s)
+	s = spaceRunsPattern.ReplaceAllString(s, " ")
+
+	lines := strings.Split(s, "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimSpace(line)
+	}
+	return strings.TrimSpace(blankLinesPattern.ReplaceAllString(strings.Join(lines, "\n"), "\n\n"))
+}
+
+// SummaryText returns the summary of the entry as plain text.
+func (e Entry) SummaryText() string {
+	return htmlToText(e.Summary)
+}
+
+// Fetch downloads and parses the feed, refusing feeds larger than maxSize bytes.
+func Fetch(ctx context.Context, client *http.Client, feedURL string, maxSize int64) (Feed, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, feedURL, nil)
+	if err != nil {
+		return Feed{}, err
+	}
+	req.Header.Set("Accept", "application/rss+xml, application/atom+xml, application/xml;q=0.9, */*;q=0.8")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return Feed{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return Feed{}, fmt.Errorf("failed to fetch feed: %s", resp.Status)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxSize+1))
+	if err != nil {
+		return Feed{}, err
+	}
+	if int64(len(data)) > maxSize {
+		return Feed{}, errors.New("feed too large")
+	}
+
+	return Parse(data)
+}
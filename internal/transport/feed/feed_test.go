@@ -0,0 +1,193 @@
+package feed
+
+import (
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseRSS(t *testing.T) {
+	f, err := Parse([]byte(`<?xml version="1.0"?>
+<rss version="2.0" xmlns:dc="http://purl.org/dc/elements/1.1/">
+<channel>
+	<title>News &amp;amp; &lt;b&gt;Notes&lt;/b&gt;</title>
+	<link>https://example.com/</link>
+	<item>
+		<title>Second</title>
+		<link>https://example.com/2</link>
+		<guid>urn:2</guid>
+		<description>&lt;p&gt;Two&lt;/p&gt;</description>
+		<pubDate>Tue, 02 Jan 2024 10:00:00 +0000</pubDate>
+	</item>
+	<item>
+		<title>First &nbsp;entry</title>
+		<link> https://example.com/1 </link>
+		<dc:date>2024-01-01T10:00:00Z</dc:date>
+	</item>
+</channel>
+</rss>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if f.Title != "News & Notes" || f.Link != "https://example.com/" {
+		t.Errorf("feed = %q, %q", f.Title, f.Link)
+	}
+	if len(f.Entries) != 2 {
+		t.Fatalf("got %d entries, want 2", len(f.Entries))
+	}
+
+	first, second := f.Entries[0], f.Entries[1]
+	if first.Title != "First entry" || first.Link != "https://example.com/1" || first.GUID != "https://example.com/1" {
+		t.Errorf("first entry = %+v", first)
+	}
+	if !first.Published.Equal(time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)) {
+		t.Errorf("first entry published at %s", first.Published)
+	}
+	if second.GUID != "urn:2" || second.SummaryText() != "Two" {
+		t.Errorf("second entry = %+v", second)
+	}
+}
+
+func TestParseRSS1(t *testing.T) {
+	f, err := Parse([]byte(`<rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#" xmlns="http://purl.org/rss/1.0/">
+	<channel><title>RDF</title></channel>
+	<item><title>Only</title><link>https://example.com/only</link></item>
+</rdf:RDF>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.Title != "RDF" || len(f.Entries) != 1 || f.Entries[0].GUID != "https://example.com/only" {
+		t.Errorf("feed = %+v", f)
+	}
+}
+
+func TestParseAtom(t *testing.T) {
+	f, err := Parse([]byte(`<feed xmlns="http://www.w3.org/2005/Atom">
+	<title type="html">Blog &amp;lt;3</title>
+	<link rel="self" href="https://example.com/feed.xml"/>
+	<link href="https://example.com/"/>
+	<entry>
+		<id>tag:example.com,2024:2</id>
+		<title>Later</title>
+		<link rel="alternate" href="https://example.com/later"/>
+		<updated>2024-03-01T00:00:00Z</updated>
+		<content type="xhtml"><div xmlns="http://www.w3.org/1999/xhtml"><p>Hello</p><p>world</p></div></content>
+	</entry>
+	<entry>
+		<id>tag:example.com,2024:1</id>
+		<title>Earlier</title>
+		<published>2024-02-01T00:00:00Z</published>
+		<summary>Plain summary</summary>
+	</entry>
+</feed>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if f.Title != "Blog <3" || f.Link != "https://example.com/" {
+		t.Errorf("feed = %q, %q", f.Title, f.Link)
+	}
+	if len(f.Entries) != 2 {
+		t.Fatalf("got %d entries, want 2", len(f.Entries))
+	}
+	if f.Entries[0].Title != "Earlier" || f.Entries[0].SummaryText() != "Plain summary" {
+		t.Errorf("first entry = %+v", f.Entries[0])
+	}
+	if f.Entries[1].Link != "https://example.com/later" || f.Entries[1].SummaryText() != "Hello\nworld" {
+		t.Errorf("second entry = %+v", f.Entries[1])
+	}
+}
+
+func TestParseOrder(t *testing.T) {
+	// without dates on every entry, the newest-first document order is trusted
+	f, err := Parse([]byte(`<rss><channel>
+	<item><guid>c</guid></item>
+	<item><guid>b</guid><pubDate>Mon, 01 Jan 2024 00:00:00 +0000</pubDate></item>
+	<item><guid>a</guid></item>
+</channel></rss>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	guids := []string{}
+	for _, entry := range f.Entries {
+		guids = append(guids, entry.GUID)
+	}
+	if strings.Join(guids, ",") != "a,b,c" {
+		t.Errorf("entries ordered %v, want a,b,c", guids)
+	}
+}
+
+func TestParseCharset(t *testing.T) {
+	f, err := Parse([]byte("<?xml version=\"1.0\" encoding=\"windows-1252\"?><rss><channel><title>\x93Hi\x94 \x96 caf\xe9</title></channel></rss>"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.Title != "“Hi” – café" {
+		t.Errorf("title = %q", f.Title)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, data := range []string{
+		"",
+		"not xml",
+		"<html><body>not a feed</body></html>",
+		`<?xml version="1.0" encoding="koi8-r"?><rss></rss>`,
+	} {
+		if _, err := Parse([]byte(data)); err == nil {
+			t.Errorf("Parse(%q) succeeded", data)
+		}
+	}
+}
+
+func TestCharsetReader(t *testing.T) {
+	for _, test := range []struct {
+		charset string
+		input   string
+		output  string
+	}{
+		{"ISO-8859-1", "caf\xe9", "café"},
+		{"latin1", "\x80\xa0\xff", "\u0080 ÿ"},
+		{"windows-1252", "\x80 \x85 \x99", "€ … ™"},
+		{"CP1252", "\x91a\x92", "‘a’"},
+		// bytes undefined in Windows-1252 keep their Latin-1 meaning
+		{"windows-1252", "\x81\x8d", "\u0081\u008d"},
+	} {
+		reader, err := charsetReader(test.charset, strings.NewReader(test.input))
+		if err != nil {
+			t.Errorf("charsetReader(%q) failed: %v", test.charset, err)
+			continue
+		}
+		output, _ := io.ReadAll(reader)
+		if string(output) != test.output {
+			t.Errorf("charsetReader(%q) decoded %q to %q, want %q", test.charset, test.input, output, test.output)
+		}
+	}
+
+	if _, err := charsetReader("shift_jis", strings.NewReader("")); err == nil {
+		t.Error("charsetReader accepted an unsupported charset")
+	}
+}
+
+func TestHTMLToText(t *testing.T) {
+	for _, test := range []struct {
+		s, text string
+	}{
+		{"plain", "plain"},
+		{"<b>bold</b> &amp; <i>italic</i>", "bold & italic"},
+		{"line<br>break<br/>again<BR />end", "line\nbreak\nagain\nend"},
+		{"<p>one</p><p>two</p>", "one\ntwo"},
+		{"<p>one</p>\n\n\n\n<p>two</p>", "one\n\ntwo"},
+		{"a <!-- hidden <b> --> b", "a b"},
+		{"  spaced \t out&nbsp;&nbsp;text  ", "spaced out text"},
+		{"<ul><li>x</li><li>y</li></ul>", "x\ny"},
+		{"&lt;script&gt;", "<script>"},
+	} {
+		if text := htmlToText(test.s); text != test.text {
+			t.Errorf("htmlToText(%q) = %q, want %q", test.s, text, test.text)
+		}
+	}
+}
@@ -0,0 +1,176 @@
+package hook
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/disgoorg/disgo/discord"
+	"github.com/disgoorg/disgo/rest"
+	"github.com/disgoorg/snowflake/v2"
+	"github.com/mandriota/bridge-discord-bot/internal/transport"
+)
+
+// Transport delivers messages to Discord channels through webhooks owned by the application.
+type Transport struct {
+	rest          rest.Rest
+	applicationID snowflake.ID
+	hookName      string
+	logger        *slog.Logger
+}
+
+func New(client rest.Rest, applicationID snowflake.ID, hookName string, logger *slog.Logger) *Transport {
+	return &Transport{
+		rest:          client,
+		applicationID: applicationID,
+		hookName:      hookName,
+		logger:        logger,
+	}
+}
+
+func (t *Transport) Name() string {
+	return transport.Discord
+}
+
+func (t *Transport) Send(ctx context.Context, endpoint transport.Endpoint, msg transport.Message) (string, error) {
+	hook, err := t.loadOrCreateWebhook(ctx, endpoint.ChannelID)
+	if err != nil {
+		return "", fmt.Errorf("failed to get/create webhook: %w", err)
+	}
+
+	webhookMessage := (*discord.Message)(nil)
+	if msg.Voice && len(msg.Files) == 1 {
+		webhookMessage, err = t.sendVoiceMessage(ctx, hook, msg.Username, msg.AvatarURL, msg.Files[0])
+		if err != nil {
+			t.logger.Warn("failed to send voice message, falling back to audio file", "error", err)
+		}
+	}
+
+	if webhookMessage == nil {
+		messageBuilder := discord.NewWebhookMessageCreateBuilder().
+			SetAllowedMentions(&discord.AllowedMentions{}).
+			SetUsername(msg.Username).
+			SetAvatarURL(msg.AvatarURL).
+			SetContent(msg.Header + msg.Content)
+
+		for _, file := range msg.Files {
+			desc := file.Description
+			if desc == "" && file.DurationSecs != nil {
+				desc = "Voice message (" + formatDuration(*file.DurationSecs) + ")"
+			}
+			messageBuilder.AddFile(file.Name, desc, bytes.NewReader(file.Body))
+		}
+
+		webhookMessage, err = t.rest.CreateWebhookMessage(hook.ID(), hook.Token, messageBuilder.Build(), true, 0, rest.WithCtx(ctx))
+		if err != nil {
+			return "", err
+		}
+	}
+
+	return webhookMessage.ID.String(), nil
+}
+
+func (t *Transport) Edit(ctx context.Context, endpoint transport.Endpoint, messageID string, msg transport.Message) error {
+	id, err := snowflake.Parse(messageID)
+	if err != nil {
+		return err
+	}
+
+	hook, err := t.loadOrCreateWebhook(ctx, endpoint.ChannelID)
+	if err != nil {
+		return fmt.Errorf("failed to load or create webhook: %w", err)
+	}
+
+	_, err = t.rest.UpdateWebhookMessage(hook.ID(), hook.Token, id, discord.NewWebhookMessageUpdateBuilder().
+		SetContent(msg.Header+msg.Content).
+		Build(), 0, rest.WithCtx(ctx))
+	return err
+}
+
+func (t *Transport) Delete(ctx context.Context, endpoint transport.Endpoint, messageID string) error {
+	id, err := snowflake.Parse(messageID)
+	if err != nil {
+		return err
+	}
+
+	hook, err := t.loadOrCreateWebhook(ctx, endpoint.ChannelID)
+	if err != nil {
+		return fmt.Errorf("failed to load or create webhook: %w", err)
+	}
+
+	return t.rest.DeleteWebhookMessage(hook.ID(), hook.Token, id, 0, rest.WithCtx(ctx))
+}
+
+func (t *Transport) React(ctx context.Context, endpoint transport.Endpoint, messageID, emoji string) error {
+	id, err := snowflake.Parse(messageID)
+	if err != nil {
+		return err
+	}
+	return t.rest.AddReaction(endpoint.ChannelID, id, emoji, rest.WithCtx(ctx))
+}
+
+func (t *Transport) loadOrCreateWebhook(ctx context.Context, channelID snowflake.ID) (*discord.IncomingWebhook, error) {
+	webhooks, err := t.rest.GetWebhooks(channelID, rest.WithCtx(ctx))
+	if err != nil {
+		return nil, err
+	}
+
+	for _, webhook := range webhooks {
+		if webhook, ok := webhook.(discord.IncomingWebhook); ok && webhook.ApplicationID != nil && *webhook.ApplicationID == t.applicationID {
+			return &webhook, nil
+		}
+	}
+
+	return t.rest.CreateWebhook(channelID, discord.WebhookCreate{
+		Name: t.hookName,
+	}, rest.WithCtx(ctx))
+}
+
+type voiceMessageCreate struct {
+	Username        string                   `json:"username,omitempty"`
+	AvatarURL       string                   `json:"avatar_url,omitempty"`
+	Flags           discord.MessageFlags     `json:"flags"`
+	AllowedMentions *discord.AllowedMentions `json:"allowed_mentions"`
+	Attachments     []voiceAttachmentCreate  `json:"attachments"`
+}
+
+type voiceAttachmentCreate struct {
+	ID           int     `json:"id"`
+	Filename     string  `json:"filename"`
+	DurationSecs float64 `json:"duration_secs"`
+	Waveform     string  `json:"waveform"`
+}
+
+// sendVoiceMessage re-sends the original OGG/Opus file with its waveform and duration,
+// which disgo's webhook builder cannot express.
+func (t *Transport) sendVoiceMessage(ctx context.Context, hook *discord.IncomingWebhook, username, avatarURL string, file transport.File) (*discord.Message, error) {
+	if file.DurationSecs == nil || file.Waveform == nil || (file.ContentType != "" && !strings.HasPrefix(file.ContentType, "audio/ogg")) {
+		return nil, transport.ErrUnsupported
+	}
+
+	payload, err := discord.PayloadWithFiles(voiceMessageCreate{
+		Username:        username,
+		AvatarURL:       avatarURL,
+		Flags:           discord.MessageFlagIsVoiceMessage,
+		AllowedMentions: &discord.AllowedMentions{},
+		Attachments: []voiceAttachmentCreate{{
+			Filename:     file.Name,
+			DurationSecs: *file.DurationSecs,
+			Waveform:     *file.Waveform,
+		}},
+	}, discord.NewFile(file.Name, "", bytes.NewReader(file.Body)))
+	if err != nil {
+		return nil, err
+	}
+
+	message := (*discord.Message)(nil)
+	err = t.rest.Do(rest.CreateWebhookMessage.Compile(discord.QueryValues{"wait": true}, hook.ID(), hook.Token), payload, &message, rest.WithCtx(ctx))
+	return message, err
+}
+
+func formatDuration(secs float64) string {
+	total := int(secs + 0.5)
+	return fmt.Sprintf("%d:%02d", total/60, total%60)
+}
@@ -0,0 +1,352 @@
+package irc
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/mandriota/bridge-discord-bot/internal/texts"
+	"github.com/mandriota/bridge-discord-bot/internal/transport"
+)
+
+const (
+	Name = "irc"
+
+	// maxLineLength leaves room for the prefix the server adds when relaying to other clients
+	maxLineLength  = 400
+	lineInterval   = 300 * time.Millisecond
+	reconnectDelay = 15 * time.Second
+)
+
+var errNotConnected = errors.New("not connected to IRC server")
+
+type Config struct {
+	Server   string
+	TLS      bool
+	Nick     string
+	Password string
+	// AvatarTemplate is the avatar URL of IRC users in Discord, with {nick} replaced by the nick.
+	AvatarTemplate string
+}
+
+// Transport relays messages to IRC channels as a single client and receives messages posted there.
+// Endpoint addresses are channel names.
+type Transport struct {
+	cfg       Config
+	endpoints map[string]transport.Endpoint
+	logger    *slog.Logger
+
+	mu        sync.Mutex
+	conn      net.Conn
+	nick      string
+	lastWrite time.Time
+}
+
+func New(cfg Config, endpoints []transport.Endpoint, logger *slog.Logger) *Transport {
+	t := &Transport{
+		cfg:       cfg,
+		endpoints: map[string]transport.Endpoint{},
+		logger:    logger,
+		nick:      cfg.Nick,
+	}
+	for _, endpoint := range endpoints {
+		t.endpoints[strings.ToLower(endpoint.Address)] = endpoint
+	}
+	return t
+}
+
+func (t *Transport) Name() string {
+	return Name
+}
+
+func (t *Transport) Send(ctx context.Context, endpoint transport.Endpoint, msg transport.Message) (string, error) {
+	text := &strings.Builder{}
+	if quote := msg.QuotedReply(); quote != "" {
+		text.WriteString(quote)
+		text.WriteByte('\n')
+	}
+	text.WriteString(texts.PlainText(msg.Content))
+	for _, file := range msg.Files {
+		text.WriteByte('\n')
+		text.WriteString(file.URL)
+	}
+
+	if !isChannelName(endpoint.Address) {
+		return "", fmt.Errorf("invalid IRC channel name %q", endpoint.Address)
+	}
+
+	prefix := "<" + stripControl(msg.Username) + "> "
+	for _, line := range splitLines(text.String()) {
+		line = strings.TrimRight(line, " \t")
+		if line == "" {
+			continue
+		}
+
+		for line != "" {
+			cut := len(line)
+			if len(prefix)+cut > maxLineLength {
+				cut = maxLineLength - len(prefix)
+				for cut > 0 && !isRuneStart(line[cut]) {
+					cut--
+				}
+			}
+
+			if err := t.writeLine(ctx, "PRIVMSG "+endpoint.Address+" :"+prefix+line[:cut]); err != nil {
+				return "", err
+			}
+			line = line[cut:]
+		}
+	}
+
+	// IRC messages have no IDs, the bridge only needs a unique one
+	return transport.NewID().String(), nil
+}
+
+func (t *Transport) Edit(ctx context.Context, endpoint transport.Endpoint, messageID string, msg transport.Message) error {
+	return transport.ErrUnsupported
+}
+
+func (t *Transport) Delete(ctx context.Context, endpoint transport.Endpoint, messageID string) error {
+	return transport.ErrUnsupported
+}
+
+func (t *Transport) React(ctx context.Context, endpoint transport.Endpoint, messageID, emoji string) error {
+	return transport.ErrUnsupported
+}
+
+// Listen connects to the server, joins the channels of the endpoints and relays
+// channel messages to the receiver, reconnecting until ctx is done.
+func (t *Transport) Listen(ctx context.Context, receiver transport.Receiver) error {
+	for {
+		err := t.session(ctx, receiver)
+		if ctx.Err() != nil {
+			return nil
+		}
+		t.logger.Error("IRC connection lost", "error", err, "server", t.cfg.Server)
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(reconnectDelay):
+		}
+	}
+}
+
+func (t *Transport) session(ctx context.Context, receiver transport.Receiver) error {
+	dialer := &net.Dialer{Timeout: 30 * time.Second}
+
+	conn := net.Conn(nil)
+	err := error(nil)
+	if t.cfg.TLS {
+		conn, err = (&tls.Dialer{NetDialer: dialer}).DialContext(ctx, "tcp", t.cfg.Server)
+	} else {
+		conn, err = dialer.DialContext(ctx, "tcp", t.cfg.Server)
+	}
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	stop := context.AfterFunc(ctx, func() {
+		conn.Close()
+	})
+	defer stop()
+
+	t.mu.Lock()
+	t.conn = conn
+	t.nick = t.cfg.Nick
+	t.mu.Unlock()
+
+	defer func() {
+		t.mu.Lock()
+		t.conn = nil
+		t.mu.Unlock()
+	}()
+
+	if t.cfg.Password != "" {
+		t.writeRaw("PASS " + t.cfg.Password)
+	}
+	t.writeRaw("NICK " + t.cfg.Nick)
+	t.writeRaw("USER " + t.cfg.Nick + " 0 * :" + t.cfg.Nick)
+
+	scanner := bufio.NewScanner(conn)
+	for scanner.Scan() {
+		prefix, command, params := parseLine(scanner.Text())
+
+		switch command {
+		case "PING":
+			t.writeRaw("PONG :" + strings.Join(params, " "))
+		case "001":
+			for channel := range t.endpoints {
+				t.writeRaw("JOIN " + channel)
+			}
+		case "433":
+			t.mu.Lock()
+			t.nick += "_"
+			nick := t.nick
+			t.mu.Unlock()
+			t.writeRaw("NICK " + nick)
+		case "PRIVMSG":
+			if len(params) < 2 {
+				continue
+			}
+			t.receive(receiver, prefix, params[0], params[1])
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	return errors.New("connection closed by server")
+}
+
+func (t *Transport) receive(receiver transport.Receiver, prefix, target, text string) {
+	endpoint, ok := t.endpoints[strings.ToLower(target)]
+	if !ok {
+		return
+	}
+
+	nick, _, _ := strings.Cut(prefix, "!")
+
+	if strings.HasPrefix(text, "\x01") {
+		action, ok := strings.CutPrefix(strings.Trim(text, "\x01"), "ACTION ")
+		if !ok {
+			return
+		}
+		text = "*" + stripFormatting(action) + "*"
+	} else {
+		text = stripFormatting(text)
+	}
+
+	receiver.ReceiveCreate(endpoint, transport.Incoming{
+		Message: transport.Message{
+			AuthorID:  strings.ToLower(nick),
+			Username:  nick,
+			AvatarURL: texts.ExpandTemplate(t.cfg.AvatarTemplate, map[string]string{"nick": nick}),
+			Content:   text,
+		},
+		ID:     transport.NewID().String(),
+		Origin: t.cfg.Server,
+	})
+}
+
+func (t *Transport) writeRaw(line string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.conn == nil {
+		return errNotConnected
+	}
+
+	t.conn.SetWriteDeadline(time.Now().Add(30 * time.Second))
+	_, err := fmt.Fprintf(t.conn, "%s\r\n", line)
+	return err
+}
+
+// writeLine writes a line no sooner than lineInterval after the previous one, so the server does not drop the client for flooding.
+func (t *Transport) writeLine(ctx context.Context, line string) error {
+	t.mu.Lock()
+	wait := time.Until(t.lastWrite.Add(lineInterval))
+	t.lastWrite = time.Now().Add(max(wait, 0))
+	t.mu.Unlock()
+
+	if wait > 0 {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(wait):
+		}
+	}
+
+	return t.writeRaw(line)
+}
+
+// parseLine splits a raw IRC line into its prefix, command and parameters, the trailing one included.
+func parseLine(line string) (prefix, command string, params []string) {
+	line = strings.TrimRight(line, "\r")
+
+	if strings.HasPrefix(line, "@") {
+		_, line, _ = strings.Cut(line, " ")
+	}
+	if strings.HasPrefix(line, ":") {
+		prefix, line, _ = strings.Cut(line[1:], " ")
+	}
+
+	line, trailing, hasTrailing := strings.Cut(line, " :")
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return prefix, "", nil
+	}
+
+	params = fields[1:]
+	if hasTrailing {
+		params = append(params, trailing)
+	}
+	return prefix, strings.ToUpper(fields[0]), params
+}
+
+// stripFormatting removes mIRC bold, italic, underline, reverse, color and reset codes.
+func stripFormatting(s string) string {
+	sb := strings.Builder{}
+
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\x02', '\x1d', '\x1f', '\x1e', '\x11', '\x16', '\x0f':
+			continue
+		case '\x03':
+			// color code: up to two digits of foreground and optionally a comma and two digits of background
+			i += countDigits(s[i+1:], 2)
+			if i+2 < len(s) && s[i+1] == ',' && countDigits(s[i+2:], 2) > 0 {
+				i += 1 + countDigits(s[i+2:], 2)
+			}
+			continue
+		}
+		sb.WriteByte(s[i])
+	}
+
+	return sb.String()
+}
+
+func countDigits(s string, limit int) int {
+	n := 0
+	for n < len(s) && n < limit && s[n] >= '0' && s[n] <= '9' {
+		n++
+	}
+	return n
+}
+
+// splitLines splits s on every character servers may take for the end of a line,
+// so content can never end the PRIVMSG early and inject commands of its own.
+func splitLines(s string) []string {
+	return strings.FieldsFunc(s, func(r rune) bool {
+		return r == '\r' || r == '\n' || r == '\x00'
+	})
+}
+
+func stripControl(s string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, s)
+}
+
+// isChannelName reports whether s can be sent as the target of a command without ending its parameter.
+func isChannelName(s string) bool {
+	return s != "" && !strings.ContainsFunc(s, func(r rune) bool {
+		return r == ' ' || r == ',' || unicode.IsControl(r)
+	})
+}
+
+func isRuneStart(b byte) bool {
+	return b&0xC0 != 0x80
+}
@@ -0,0 +1,222 @@
+package irc
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mandriota/bridge-discord-bot/internal/transport"
+)
+
+type receiver struct {
+	creates chan transport.Incoming
+}
+
+func (r *receiver) ReceiveCreate(endpoint transport.Endpoint, msg transport.Incoming) {
+	r.creates <- msg
+}
+
+func (r *receiver) ReceiveUpdate(endpoint transport.Endpoint, msg transport.Incoming) {}
+
+func (r *receiver) ReceiveDelete(endpoint transport.Endpoint, messageID string) {}
+
+// server is an in-process IRC server accepting a single client.
+type server struct {
+	listener net.Listener
+	conn     net.Conn
+	lines    chan string
+}
+
+func newServer(t *testing.T) *server {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	return &server{listener: listener, lines: make(chan string, 100)}
+}
+
+func (s *server) accept(t *testing.T) {
+	conn, err := s.listener.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	s.conn = conn
+
+	go func() {
+		scanner := bufio.NewScanner(conn)
+		for scanner.Scan() {
+			s.lines <- scanner.Text()
+		}
+		close(s.lines)
+	}()
+}
+
+func (s *server) send(t *testing.T, line string) {
+	if _, err := fmt.Fprintf(s.conn, "%s\r\n", line); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func (s *server) expect(t *testing.T, prefix string) string {
+	t.Helper()
+
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case line, ok := <-s.lines:
+			if !ok {
+				t.Fatalf("connection closed waiting for %q", prefix)
+			}
+			if strings.HasPrefix(line, prefix) {
+				return line
+			}
+		case <-timeout:
+			t.Fatalf("timed out waiting for %q", prefix)
+		}
+	}
+}
+
+func connect(t *testing.T) (*Transport, *server, *receiver, transport.Endpoint) {
+	s := newServer(t)
+	endpoint := transport.Endpoint{ChannelID: transport.NewID(), Transport: Name, Address: "#bridge"}
+
+	tr := New(Config{
+		Server:         s.listener.Addr().String(),
+		Nick:           "bridge",
+		AvatarTemplate: "https://avatars.test/{nick}",
+	}, []transport.Endpoint{endpoint}, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	r := &receiver{creates: make(chan transport.Incoming, 10)}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	go tr.Listen(ctx, r)
+
+	s.accept(t)
+	s.expect(t, "NICK bridge")
+	s.expect(t, "USER bridge")
+	s.send(t, ":irc.test 001 bridge :Welcome")
+	s.expect(t, "JOIN #bridge")
+
+	return tr, s, r, endpoint
+}
+
+func TestListen(t *testing.T) {
+	_, s, r, _ := connect(t)
+
+	s.send(t, "PING :irc.test")
+	s.expect(t, "PONG :irc.test")
+
+	s.send(t, ":Alice!alice@host PRIVMSG #Bridge :hello \x02world\x02")
+	s.send(t, ":Bob!bob@host PRIVMSG #elsewhere :not bridged")
+	s.send(t, ":Bob!bob@host PRIVMSG #bridge :\x01ACTION waves\x01")
+
+	for _, want := range []transport.Incoming{
+		{Message: transport.Message{AuthorID: "alice", Username: "Alice", AvatarURL: "https://avatars.test/Alice", Content: "hello world"}},
+		{Message: transport.Message{AuthorID: "bob", Username: "Bob", AvatarURL: "https://avatars.test/Bob", Content: "*waves*"}},
+	} {
+		select {
+		case got := <-r.creates:
+			if got.AuthorID != want.AuthorID || got.Username != want.Username || got.AvatarURL != want.AvatarURL || got.Content != want.Content {
+				t.Errorf("received %+v, want %+v", got.Message, want.Message)
+			}
+			if got.ID == "" || got.Origin != s.listener.Addr().String() {
+				t.Errorf("received ID %q from %q", got.ID, got.Origin)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for message")
+		}
+	}
+}
+
+func TestSend(t *testing.T) {
+	tr, s, _, endpoint := connect(t)
+	ctx := context.Background()
+
+	id, err := tr.Send(ctx, endpoint, transport.Message{
+		Username: "Carol",
+		Header:   "-# > **Dave** earlier message",
+		Content:  "first\nsecond",
+		Files:    []transport.File{{Name: "a.png", URL: "https://cdn.test/a.png"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, want := range []string{
+		"PRIVMSG #bridge :<Carol> > Dave earlier message",
+		"PRIVMSG #bridge :<Carol> first",
+		"PRIVMSG #bridge :<Carol> second",
+		"PRIVMSG #bridge :<Carol> https://cdn.test/a.png",
+	} {
+		if got := s.expect(t, "PRIVMSG"); got != want {
+			t.Errorf("sent %q, want %q", got, want)
+		}
+	}
+
+	otherID, err := tr.Send(ctx, endpoint, transport.Message{Username: "Carol", Content: "again"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id == "" || id == otherID {
+		t.Errorf("message IDs %q and %q are not unique", id, otherID)
+	}
+	s.expect(t, "PRIVMSG")
+
+	if err := tr.Edit(ctx, endpoint, id, transport.Message{Content: "edited"}); !errors.Is(err, transport.ErrUnsupported) {
+		t.Errorf("Edit returned %v", err)
+	}
+	if err := tr.Delete(ctx, endpoint, id); !errors.Is(err, transport.ErrUnsupported) {
+		t.Errorf("Delete returned %v", err)
+	}
+}
+
+func TestSendSplitsLongLines(t *testing.T) {
+	tr, s, _, endpoint := connect(t)
+
+	content := strings.Repeat("é", maxLineLength)
+	if _, err := tr.Send(context.Background(), endpoint, transport.Message{Username: "Carol", Content: content}); err != nil {
+		t.Fatal(err)
+	}
+
+	sent := ""
+	for sent != content {
+		line := s.expect(t, "PRIVMSG")
+		if len(line)-len("PRIVMSG #bridge :") > maxLineLength {
+			t.Fatalf("sent line of %d bytes", len(line))
+		}
+		sent += strings.TrimPrefix(line, "PRIVMSG #bridge :<Carol> ")
+	}
+}
+
+func TestSendInjection(t *testing.T) {
+	tr, s, _, endpoint := connect(t)
+	ctx := context.Background()
+
+	if _, err := tr.Send(ctx, endpoint, transport.Message{
+		Username: "Eve\r\nJOIN #secret",
+		Content:  "hi\rQUIT :x\x00PART #bridge\n\rJOIN #secret",
+	}); err != nil {
+		t.Fatal(err)
+	}
+	s.send(t, "PING :done")
+
+	for line := s.expect(t, ""); line != "PONG :done"; line = s.expect(t, "") {
+		if !strings.HasPrefix(line, "PRIVMSG #bridge :<EveJOIN #secret> ") || strings.ContainsAny(line, "\r\x00") {
+			t.Errorf("sent %q", line)
+		}
+	}
+
+	if _, err := tr.Send(ctx, transport.Endpoint{Transport: Name, Address: "#bridge\r\nQUIT"}, transport.Message{Content: "hi"}); err == nil {
+		t.Error("sent to invalid channel name")
+	}
+}
@@ -0,0 +1,714 @@
+package matrix
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mandriota/bridge-discord-bot/internal/cache"
+	"github.com/mandriota/bridge-discord-bot/internal/texts"
+	"github.com/mandriota/bridge-discord-bot/internal/transport"
+)
+
+const (
+	Name = "matrix"
+
+	transactionCacheSize = 1000
+	transactionCacheTTL  = time.Hour
+)
+
+var errFileTooLarge = errors.New("matrix: file too large")
+
+type Config struct {
+	// HomeserverURL is the client-server API base URL, as in https://matrix.example.org.
+	HomeserverURL string
+	ServerName    string
+	ListenAddr    string
+	ASToken       string
+	HSToken       string
+	BotLocalpart  string
+	// GhostPrefix is the localpart prefix of users puppeting authors from other platforms.
+	GhostPrefix string
+	// MaxFileSize limits files downloaded from Matrix, larger files are only mentioned by name.
+	MaxFileSize int
+	// AvatarTemplate is the avatar URL of Matrix users in Discord, with {localpart}, {server} and {media_id} replaced.
+	// Homeservers only serve media to authenticated users, so avatars need a public mirror of them or a generated image.
+	// Users without an avatar get none if the template contains {media_id}.
+	AvatarTemplate string
+}
+
+// Error is an error response of the client-server API.
+type Error struct {
+	Status  int
+	ErrCode string `json:"errcode"`
+	Message string `json:"error"`
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("matrix: %d %s: %s", e.Status, e.ErrCode, e.Message)
+}
+
+type ghost struct {
+	registered  bool
+	displayName string
+	avatarURL   string
+	rooms       map[string]struct{}
+}
+
+type profile struct {
+	DisplayName string `json:"displayname"`
+	AvatarURL   string `json:"avatar_url"`
+}
+
+// Transport is a Matrix application service. Authors from other platforms are puppeted
+// by ghost users, and Matrix users are shown in Discord with their profile.
+// Endpoint addresses are room IDs.
+type Transport struct {
+	cfg       Config
+	endpoints map[string]transport.Endpoint
+	client    *http.Client
+	logger    *slog.Logger
+
+	transactions *cache.TTL[string]
+
+	mu       sync.Mutex
+	ghosts   map[string]*ghost
+	profiles map[string]profile
+}
+
+func New(cfg Config, endpoints []transport.Endpoint, logger *slog.Logger) *Transport {
+	t := &Transport{
+		cfg:          cfg,
+		endpoints:    map[string]transport.Endpoint{},
+		client:       &http.Client{Timeout: 30 * time.Second},
+		logger:       logger,
+		transactions: cache.NewTTL[string](transactionCacheSize, transactionCacheTTL),
+		ghosts:       map[string]*ghost{},
+		profiles:     map[string]profile{},
+	}
+	for _, endpoint := range endpoints {
+		t.endpoints[endpoint.Address] = endpoint
+	}
+	return t
+}
+
+func (t *Transport) Name() string {
+	return Name
+}
+
+func (t *Transport) botUserID() string {
+	return "@" + t.cfg.BotLocalpart + ":" + t.cfg.ServerName
+}
+
+func (t *Transport) isBridgeUser(userID string) bool {
+	return userID == t.botUserID() || strings.HasPrefix(userID, "@"+t.cfg.GhostPrefix) && strings.HasSuffix(userID, ":"+t.cfg.ServerName)
+}
+
+// ghostLocalpart escapes the author ID into the characters allowed in user IDs.
+func (t *Transport) ghostLocalpart(authorID string) string {
+	sb := strings.Builder{}
+	sb.WriteString(t.cfg.GhostPrefix)
+
+	for _, b := range []byte(strings.ToLower(authorID)) {
+		if 'a' <= b && b <= 'z' || '0' <= b && b <= '9' || b == '.' || b == '_' || b == '-' {
+			sb.WriteByte(b)
+		} else {
+			fmt.Fprintf(&sb, "=%02x", b)
+		}
+	}
+
+	return sb.String()
+}
+
+func (t *Transport) do(ctx context.Context, method, path string, query url.Values, body any, out any) error {
+	reqBody := io.Reader(nil)
+	contentType := "application/json"
+
+	switch body := body.(type) {
+	case nil:
+	case transport.File:
+		reqBody = bytes.NewReader(body.Body)
+		contentType = body.ContentType
+		if contentType == "" {
+			contentType = "application/octet-stream"
+		}
+	default:
+		encoded, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reqBody = bytes.NewReader(encoded)
+	}
+
+	endpoint := strings.TrimSuffix(t.cfg.HomeserverURL, "/") + path
+	if len(query) > 0 {
+		endpoint += "?" + query.Encode()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, endpoint, reqBody)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+t.cfg.ASToken)
+	if reqBody != nil {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		apiErr := &Error{Status: resp.StatusCode}
+		json.NewDecoder(resp.Body).Decode(apiErr)
+		return apiErr
+	}
+
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+func asUser(userID string) url.Values {
+	return url.Values{"user_id": {userID}}
+}
+
+func (t *Transport) upload(ctx context.Context, file transport.File) (string, error) {
+	resp := struct {
+		ContentURI string `json:"content_uri"`
+	}{}
+	err := t.do(ctx, http.MethodPost, "/_matrix/media/v3/upload", url.Values{"filename": {file.Name}}, file, &resp)
+	return resp.ContentURI, err
+}
+
+func (t *Transport) uploadFromURL(ctx context.Context, fileURL string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fileURL, nil)
+	if err != nil {
+		return "", err
+	}
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("failed to download %s: %s", fileURL, resp.Status)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+
+	return t.upload(ctx, transport.File{Name: "avatar", ContentType: resp.Header.Get("Content-Type"), Body: body})
+}
+
+// download fetches media through the authenticated media API, refusing files larger than MaxFileSize.
+func (t *Transport) download(ctx context.Context, mxc string) ([]byte, error) {
+	serverAndID, ok := strings.CutPrefix(mxc, "mxc://")
+	if !ok {
+		return nil, fmt.Errorf("matrix: invalid content URI %q", mxc)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(t.cfg.HomeserverURL, "/")+"/_matrix/client/v1/media/download/"+serverAndID, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+t.cfg.ASToken)
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		apiErr := &Error{Status: resp.StatusCode}
+		json.NewDecoder(resp.Body).Decode(apiErr)
+		return nil, apiErr
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, int64(t.cfg.MaxFileSize)+1))
+	if err != nil {
+		return nil, err
+	} else if len(body) > t.cfg.MaxFileSize {
+		return nil, errFileTooLarge
+	}
+	return body, nil
+}
+
+func (t *Transport) avatarURL(userID, mxc string) string {
+	localpart, _, _ := strings.Cut(strings.TrimPrefix(userID, "@"), ":")
+	server, mediaID, _ := strings.Cut(strings.TrimPrefix(mxc, "mxc://"), "/")
+	if mediaID == "" && strings.Contains(t.cfg.AvatarTemplate, "{media_id}") {
+		return ""
+	}
+
+	return texts.ExpandTemplate(t.cfg.AvatarTemplate, map[string]string{
+		"localpart": localpart,
+		"server":    server,
+		"media_id":  mediaID,
+	})
+}
+
+// ensureGhost registers the ghost of the author, keeps its profile in sync
+// with the rendered name and avatar, and makes it join the room.
+func (t *Transport) ensureGhost(ctx context.Context, roomID string, msg transport.Message) (string, error) {
+	if msg.AuthorID == "" {
+		return t.botUserID(), nil
+	}
+
+	localpart := t.ghostLocalpart(msg.AuthorID)
+	userID := "@" + localpart + ":" + t.cfg.ServerName
+
+	t.mu.Lock()
+	g, ok := t.ghosts[userID]
+	if !ok {
+		g = &ghost{rooms: map[string]struct{}{}}
+		t.ghosts[userID] = g
+	}
+	state := *g
+	_, joined := g.rooms[roomID]
+	t.mu.Unlock()
+
+	if !state.registered {
+		err := t.do(ctx, http.MethodPost, "/_matrix/client/v3/register", nil, map[string]any{
+			"type":          "m.login.application_service",
+			"username":      localpart,
+			"inhibit_login": true,
+		}, nil)
+		if apiErr := (*Error)(nil); err != nil && !(errors.As(err, &apiErr) && apiErr.ErrCode == "M_USER_IN_USE") {
+			return "", fmt.Errorf("failed to register ghost: %w", err)
+		}
+	}
+
+	if state.displayName != msg.Username {
+		if err := t.do(ctx, http.MethodPut, "/_matrix/client/v3/profile/"+url.PathEscape(userID)+"/displayname", asUser(userID), map[string]string{
+			"displayname": msg.Username,
+		}, nil); err != nil {
+			t.logger.Warn("failed to set ghost display name", "error", err, "user_id", userID)
+		}
+	}
+
+	if msg.AvatarURL != "" && state.avatarURL != msg.AvatarURL {
+		if mxc, err := t.uploadFromURL(ctx, msg.AvatarURL); err != nil {
+			t.logger.Warn("failed to upload ghost avatar", "error", err, "user_id", userID)
+		} else if err := t.do(ctx, http.MethodPut, "/_matrix/client/v3/profile/"+url.PathEscape(userID)+"/avatar_url", asUser(userID), map[string]string{
+			"avatar_url": mxc,
+		}, nil); err != nil {
+			t.logger.Warn("failed to set ghost avatar", "error", err, "user_id", userID)
+		}
+	}
+
+	if !joined {
+		// rooms are usually invite-only, the bot user invites ghosts before they join
+		t.do(ctx, http.MethodPost, "/_matrix/client/v3/rooms/"+url.PathEscape(roomID)+"/invite", nil, map[string]string{
+			"user_id": userID,
+		}, nil)
+		if err := t.do(ctx, http.MethodPost, "/_matrix/client/v3/join/"+url.PathEscape(roomID), asUser(userID), map[string]any{}, nil); err != nil {
+			return "", fmt.Errorf("failed to join ghost: %w", err)
+		}
+	}
+
+	t.mu.Lock()
+	g.registered = true
+	g.displayName = msg.Username
+	g.avatarURL = msg.AvatarURL
+	g.rooms[roomID] = struct{}{}
+	t.mu.Unlock()
+
+	return userID, nil
+}
+
+func (t *Transport) sendEvent(ctx context.Context, roomID, userID, eventType string, content any) (string, error) {
+	resp := struct {
+		EventID string `json:"event_id"`
+	}{}
+	path := "/_matrix/client/v3/rooms/" + url.PathEscape(roomID) + "/send/" + eventType + "/" + transport.NewID().String()
+	err := t.do(ctx, http.MethodPut, path, asUser(userID), content, &resp)
+	return resp.EventID, err
+}
+
+func msgType(contentType string) string {
+	switch {
+	case strings.HasPrefix(contentType, "image/"):
+		return "m.image"
+	case strings.HasPrefix(contentType, "audio/"):
+		return "m.audio"
+	case strings.HasPrefix(contentType, "video/"):
+		return "m.video"
+	}
+	return "m.file"
+}
+
+func (t *Transport) Send(ctx context.Context, endpoint transport.Endpoint, msg transport.Message) (string, error) {
+	userID, err := t.ensureGhost(ctx, endpoint.Address, msg)
+	if err != nil {
+		return "", err
+	}
+
+	relatesTo := map[string]any(nil)
+	body := texts.PlainText(msg.Content)
+	if msg.ReplyTo != "" {
+		relatesTo = map[string]any{"m.in_reply_to": map[string]string{"event_id": transport.MessageIDParts(msg.ReplyTo)[0]}}
+	} else if quote := msg.QuotedReply(); quote != "" {
+		body = quote + "\n\n" + body
+	}
+
+	// the text and each file are separate events, the message is identified by all of them
+	eventIDs := []string{}
+	if strings.TrimSpace(body) != "" {
+		content := map[string]any{
+			"msgtype": "m.text",
+			"body":    body,
+		}
+		if relatesTo != nil {
+			content["m.relates_to"] = relatesTo
+		}
+
+		eventID, err := t.sendEvent(ctx, endpoint.Address, userID, "m.room.message", content)
+		if err != nil {
+			return "", err
+		}
+		eventIDs = append(eventIDs, eventID)
+	}
+
+	for _, file := range msg.Files {
+		fileEventID, err := t.sendFile(ctx, endpoint.Address, userID, file)
+		if err != nil {
+			if len(eventIDs) > 0 {
+				t.logger.Error("failed to send file to Matrix", "error", err, "file", file.Name)
+				continue
+			}
+			return "", err
+		}
+		eventIDs = append(eventIDs, fileEventID)
+	}
+
+	if len(eventIDs) == 0 {
+		return "", errors.New("empty message")
+	}
+	return strings.Join(eventIDs, ","), nil
+}
+
+func (t *Transport) sendFile(ctx context.Context, roomID, userID string, file transport.File) (string, error) {
+	mxc, err := t.upload(ctx, file)
+	if err != nil {
+		return "", fmt.Errorf("failed to upload file: %w", err)
+	}
+
+	return t.sendEvent(ctx, roomID, userID, "m.room.message", map[string]any{
+		"msgtype": msgType(file.ContentType),
+		"body":    file.Name,
+		"url":     mxc,
+		"info": map[string]any{
+			"mimetype": file.ContentType,
+			"size":     len(file.Body),
+		},
+	})
+}
+
+func (t *Transport) Edit(ctx context.Context, endpoint transport.Endpoint, messageID string, msg transport.Message) error {
+	userID, err := t.ensureGhost(ctx, endpoint.Address, msg)
+	if err != nil {
+		return err
+	}
+
+	body := texts.PlainText(msg.Content)
+	if quote := msg.QuotedReply(); msg.ReplyTo == "" && quote != "" {
+		body = quote + "\n\n" + body
+	}
+
+	_, err = t.sendEvent(ctx, endpoint.Address, userID, "m.room.message", map[string]any{
+		"msgtype": "m.text",
+		"body":    "* " + body,
+		"m.new_content": map[string]any{
+			"msgtype": "m.text",
+			"body":    body,
+		},
+		"m.relates_to": map[string]any{
+			"rel_type": "m.replace",
+			"event_id": transport.MessageIDParts(messageID)[0],
+		},
+	})
+	return err
+}
+
+func (t *Transport) Delete(ctx context.Context, endpoint transport.Endpoint, messageID string) error {
+	for _, eventID := range transport.MessageIDParts(messageID) {
+		path := "/_matrix/client/v3/rooms/" + url.PathEscape(endpoint.Address) + "/redact/" + url.PathEscape(eventID) + "/" + transport.NewID().String()
+		if err := t.do(ctx, http.MethodPut, path, nil, map[string]any{}, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (t *Transport) React(ctx context.Context, endpoint transport.Endpoint, messageID, emoji string) error {
+	_, err := t.sendEvent(ctx, endpoint.Address, t.botUserID(), "m.reaction", map[string]any{
+		"m.relates_to": map[string]any{
+			"rel_type": "m.annotation",
+			"event_id": transport.MessageIDParts(messageID)[0],
+			"key":      emoji,
+		},
+	})
+	return err
+}
+
+//=:matrix:appservice
+
+type event struct {
+	Type     string          `json:"type"`
+	EventID  string          `json:"event_id"`
+	RoomID   string          `json:"room_id"`
+	Sender   string          `json:"sender"`
+	StateKey *string         `json:"state_key"`
+	Redacts  string          `json:"redacts"`
+	Content  json.RawMessage `json:"content"`
+}
+
+type messageContent struct {
+	MsgType string `json:"msgtype"`
+	Body    string `json:"body"`
+	URL     string `json:"url"`
+	Info    *struct {
+		Size     int    `json:"size"`
+		MimeType string `json:"mimetype"`
+	} `json:"info"`
+	NewContent *messageContent `json:"m.new_content"`
+	RelatesTo  *struct {
+		RelType   string `json:"rel_type"`
+		EventID   string `json:"event_id"`
+		InReplyTo *struct {
+			EventID string `json:"event_id"`
+		} `json:"m.in_reply_to"`
+	} `json:"m.relates_to"`
+	Redacts string `json:"redacts"`
+
+	DisplayName string `json:"displayname"`
+	AvatarURL   string `json:"avatar_url"`
+}
+
+// Listen serves the application service API the homeserver pushes room events to.
+func (t *Transport) Listen(ctx context.Context, receiver transport.Receiver) error {
+	mux := http.NewServeMux()
+	mux.HandleFunc("PUT /_matrix/app/v1/transactions/{txnID}", func(w http.ResponseWriter, r *http.Request) {
+		t.handleTransaction(w, r, receiver)
+	})
+	mux.HandleFunc("GET /_matrix/app/v1/users/{userID}", t.handleQuery)
+	mux.HandleFunc("GET /_matrix/app/v1/rooms/{alias}", t.handleQuery)
+
+	for roomID := range t.endpoints {
+		if err := t.do(ctx, http.MethodPost, "/_matrix/client/v3/join/"+url.PathEscape(roomID), nil, map[string]any{}, nil); err != nil {
+			t.logger.Warn("failed to join Matrix room", "error", err, "room_id", roomID)
+		}
+	}
+
+	server := &http.Server{
+		Addr:    t.cfg.ListenAddr,
+		Handler: mux,
+	}
+
+	stop := context.AfterFunc(ctx, func() {
+		server.Shutdown(context.Background())
+	})
+	defer stop()
+
+	if err := server.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+func (t *Transport) authorized(r *http.Request) bool {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok {
+		token = r.URL.Query().Get("access_token")
+	}
+	return subtle.ConstantTimeCompare([]byte(token), []byte(t.cfg.HSToken)) == 1
+}
+
+func writeError(w http.ResponseWriter, status int, errCode, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"errcode": errCode, "error": message})
+}
+
+func (t *Transport) handleQuery(w http.ResponseWriter, r *http.Request) {
+	if !t.authorized(r) {
+		writeError(w, http.StatusForbidden, "M_FORBIDDEN", "invalid homeserver token")
+		return
+	}
+	// ghosts are registered on demand, nothing exists before that
+	writeError(w, http.StatusNotFound, "M_NOT_FOUND", "not found")
+}
+
+func (t *Transport) handleTransaction(w http.ResponseWriter, r *http.Request, receiver transport.Receiver) {
+	if !t.authorized(r) {
+		writeError(w, http.StatusForbidden, "M_FORBIDDEN", "invalid homeserver token")
+		return
+	}
+
+	transaction := struct {
+		Events []event `json:"events"`
+	}{}
+	if err := json.NewDecoder(r.Body).Decode(&transaction); err != nil {
+		writeError(w, http.StatusBadRequest, "M_BAD_JSON", err.Error())
+		return
+	}
+
+	// the homeserver retries transactions until they are acknowledged
+	if txnID := r.PathValue("txnID"); !t.transactions.Contains(txnID) {
+		t.transactions.Add(txnID)
+		for _, ev := range transaction.Events {
+			t.handleEvent(receiver, ev)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write([]byte("{}"))
+}
+
+func (t *Transport) handleEvent(receiver transport.Receiver, ev event) {
+	endpoint, ok := t.endpoints[ev.RoomID]
+	if !ok || t.isBridgeUser(ev.Sender) {
+		return
+	}
+
+	content := messageContent{}
+	if err := json.Unmarshal(ev.Content, &content); err != nil {
+		t.logger.Warn("failed to decode Matrix event", "error", err, "event_id", ev.EventID)
+		return
+	}
+
+	switch ev.Type {
+	case "m.room.member":
+		if ev.StateKey != nil && *ev.StateKey == ev.Sender {
+			t.mu.Lock()
+			t.profiles[ev.Sender] = profile{DisplayName: content.DisplayName, AvatarURL: content.AvatarURL}
+			t.mu.Unlock()
+		}
+	case "m.room.redaction":
+		redacts := ev.Redacts
+		if redacts == "" {
+			redacts = content.Redacts
+		}
+		receiver.ReceiveDelete(endpoint, redacts)
+	case "m.room.message":
+		if content.RelatesTo != nil && content.RelatesTo.RelType == "m.replace" && content.NewContent != nil {
+			incoming, ok := t.incoming(ev, *content.NewContent)
+			if ok {
+				incoming.ID = content.RelatesTo.EventID
+				receiver.ReceiveUpdate(endpoint, incoming)
+			}
+			return
+		}
+
+		incoming, ok := t.incoming(ev, content)
+		if !ok {
+			return
+		}
+		if content.RelatesTo != nil && content.RelatesTo.InReplyTo != nil {
+			incoming.ReplyTo = content.RelatesTo.InReplyTo.EventID
+			incoming.Content = stripReplyFallback(incoming.Content)
+		}
+		receiver.ReceiveCreate(endpoint, incoming)
+	}
+}
+
+func (t *Transport) incoming(ev event, content messageContent) (transport.Incoming, bool) {
+	sender := t.loadProfile(ev.Sender)
+	_, origin, _ := strings.Cut(ev.Sender, ":")
+
+	incoming := transport.Incoming{
+		Message: transport.Message{
+			AuthorID:  ev.Sender,
+			Username:  sender.DisplayName,
+			AvatarURL: t.avatarURL(ev.Sender, sender.AvatarURL),
+		},
+		ID:     ev.EventID,
+		Origin: origin,
+	}
+
+	switch content.MsgType {
+	case "m.text":
+		incoming.Content = content.Body
+	case "m.emote":
+		incoming.Content = "*" + content.Body + "*"
+	case "m.image", "m.file", "m.audio", "m.video":
+		file := transport.File{Name: content.Body}
+		if content.Info != nil {
+			file.Size = content.Info.Size
+			file.ContentType = content.Info.MimeType
+		}
+		if file.Size > t.cfg.MaxFileSize {
+			incoming.Content += "\n-# " + file.Name + " is too large to bridge"
+			break
+		}
+
+		// media URLs need the access token, so files are always handed over with their body and without URL
+		body, err := t.download(context.Background(), content.URL)
+		if errors.Is(err, errFileTooLarge) {
+			incoming.Content += "\n-# " + file.Name + " is too large to bridge"
+			break
+		} else if err != nil {
+			t.logger.Error("failed to download Matrix file", "error", err, "event_id", ev.EventID)
+			return incoming, false
+		}
+
+		file.Body = body
+		file.Size = len(body)
+		incoming.Files = []transport.File{file}
+	default:
+		// notices are sent by bots, relaying them risks loops between bridges
+		return incoming, false
+	}
+
+	return incoming, true
+}
+
+// loadProfile returns the profile of a Matrix user, falling back to the localpart as display name.
+func (t *Transport) loadProfile(userID string) profile {
+	t.mu.Lock()
+	p, ok := t.profiles[userID]
+	t.mu.Unlock()
+	if ok {
+		return withDefaultDisplayName(userID, p)
+	}
+
+	if err := t.do(context.Background(), http.MethodGet, "/_matrix/client/v3/profile/"+url.PathEscape(userID), nil, nil, &p); err != nil {
+		t.logger.Warn("failed to fetch Matrix profile", "error", err, "user_id", userID)
+	}
+	t.mu.Lock()
+	t.profiles[userID] = p
+	t.mu.Unlock()
+
+	return withDefaultDisplayName(userID, p)
+}
+
+func withDefaultDisplayName(userID string, p profile) profile {
+	if p.DisplayName == "" {
+		p.DisplayName, _, _ = strings.Cut(strings.TrimPrefix(userID, "@"), ":")
+	}
+	return p
+}
+
+// stripReplyFallback removes the quote of the replied message clients prepend to the body of replies.
+func stripReplyFallback(body string) string {
+	return strings.TrimPrefix(body[texts.SkipPrefixedLine(body, ">"):], "\n")
+}
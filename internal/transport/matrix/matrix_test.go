@@ -0,0 +1,421 @@
+package matrix
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/mandriota/bridge-discord-bot/internal/transport"
+)
+
+const (
+	asToken = "as-secret"
+	hsToken = "hs-secret"
+)
+
+type request struct {
+	method string
+	path   string
+	userID string
+	body   map[string]any
+}
+
+func (r request) String() string {
+	return r.method + " " + r.path
+}
+
+// homeserver is a stand-in for the client-server API, numbering sent events from 1.
+type homeserver struct {
+	t      *testing.T
+	server *httptest.Server
+
+	mu       sync.Mutex
+	requests []request
+	nextID   int
+}
+
+func newHomeserver(t *testing.T) *homeserver {
+	hs := &homeserver{t: t}
+	hs.server = httptest.NewServer(http.HandlerFunc(hs.serve))
+	t.Cleanup(hs.server.Close)
+	return hs
+}
+
+func (hs *homeserver) serve(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == "/avatar.png" {
+		w.Header().Set("Content-Type", "image/png")
+		io.WriteString(w, "png")
+		return
+	}
+	if r.Header.Get("Authorization") != "Bearer "+asToken {
+		writeError(w, http.StatusUnauthorized, "M_UNKNOWN_TOKEN", "invalid token")
+		return
+	}
+
+	req := request{method: r.Method, path: r.URL.EscapedPath(), userID: r.URL.Query().Get("user_id"), body: map[string]any{}}
+	if r.Header.Get("Content-Type") == "application/json" {
+		if err := json.NewDecoder(r.Body).Decode(&req.body); err != nil {
+			hs.t.Error(err)
+		}
+	}
+
+	hs.mu.Lock()
+	hs.requests = append(hs.requests, req)
+	hs.mu.Unlock()
+
+	switch {
+	case strings.HasPrefix(req.path, "/_matrix/client/v1/media/download/"):
+		switch strings.TrimPrefix(req.path, "/_matrix/client/v1/media/download/") {
+		case "other.test/cat":
+			io.WriteString(w, "meow")
+		case "other.test/lying":
+			io.WriteString(w, strings.Repeat("x", 100))
+		default:
+			writeError(w, http.StatusNotFound, "M_NOT_FOUND", "not found")
+		}
+	case strings.HasPrefix(req.path, "/_matrix/media/v3/upload"):
+		if r.URL.Query().Get("filename") == "huge.bin" {
+			writeError(w, http.StatusRequestEntityTooLarge, "M_TOO_LARGE", "too large")
+			return
+		}
+		fmt.Fprintf(w, `{"content_uri":"mxc://hs.test/%s"}`, r.URL.Query().Get("filename"))
+	case strings.Contains(req.path, "/send/"):
+		hs.mu.Lock()
+		hs.nextID++
+		eventID := fmt.Sprintf("$%d", hs.nextID)
+		hs.mu.Unlock()
+		fmt.Fprintf(w, `{"event_id":%q}`, eventID)
+	case strings.HasPrefix(req.path, "/_matrix/client/v3/profile/") && r.Method == http.MethodGet:
+		io.WriteString(w, `{"displayname":"Alice","avatar_url":"mxc://hs.test/alice"}`)
+	default:
+		io.WriteString(w, "{}")
+	}
+}
+
+func (hs *homeserver) takeRequests() []request {
+	hs.mu.Lock()
+	defer hs.mu.Unlock()
+
+	requests := hs.requests
+	hs.requests = nil
+	return requests
+}
+
+func newTransport(hs *homeserver) (*Transport, transport.Endpoint) {
+	endpoint := transport.Endpoint{ChannelID: transport.NewID(), Transport: Name, Address: "!room:hs.test"}
+	return New(Config{
+		HomeserverURL:  hs.server.URL + "/",
+		ServerName:     "hs.test",
+		ASToken:        asToken,
+		HSToken:        hsToken,
+		BotLocalpart:   "bridge",
+		GhostPrefix:    "_discord_",
+		MaxFileSize:    10,
+		AvatarTemplate: "https://media.test/{server}/{media_id}?user={localpart}",
+	}, []transport.Endpoint{endpoint}, slog.New(slog.NewTextHandler(io.Discard, nil))), endpoint
+}
+
+func relatesTo(req request) map[string]any {
+	relatesTo, _ := req.body["m.relates_to"].(map[string]any)
+	return relatesTo
+}
+
+func TestSend(t *testing.T) {
+	hs := newHomeserver(t)
+	tr, endpoint := newTransport(hs)
+	ctx := context.Background()
+
+	msg := transport.Message{
+		AuthorID:  "Discord:42",
+		Username:  "Bob",
+		AvatarURL: hs.server.URL + "/avatar.png",
+		Content:   "**hello** world",
+		Files: []transport.File{
+			{Name: "a.png", ContentType: "image/png", Body: []byte("png")},
+			{Name: "b.txt", ContentType: "text/plain", Body: []byte("txt")},
+		},
+	}
+	id, err := tr.Send(ctx, endpoint, msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id != "$1,$2,$3" {
+		t.Errorf("Send returned ID %q", id)
+	}
+
+	const ghost = "@_discord_discord=3a42:hs.test"
+	requests := hs.takeRequests()
+	got := []string{}
+	for _, req := range requests {
+		got = append(got, req.String())
+	}
+	want := []string{
+		"POST /_matrix/client/v3/register",
+		"PUT /_matrix/client/v3/profile/" + ghost + "/displayname",
+		"POST /_matrix/media/v3/upload",
+		"PUT /_matrix/client/v3/profile/" + ghost + "/avatar_url",
+		"POST /_matrix/client/v3/rooms/%21room:hs.test/invite",
+		"POST /_matrix/client/v3/join/%21room:hs.test",
+		"PUT /_matrix/client/v3/rooms/%21room:hs.test/send/m.room.message/",
+		"POST /_matrix/media/v3/upload",
+		"PUT /_matrix/client/v3/rooms/%21room:hs.test/send/m.room.message/",
+		"POST /_matrix/media/v3/upload",
+		"PUT /_matrix/client/v3/rooms/%21room:hs.test/send/m.room.message/",
+	}
+	if len(got) != len(want) {
+		t.Fatalf("requested %q, want %q", got, want)
+	}
+	for i := range want {
+		if !strings.HasPrefix(got[i], want[i]) {
+			t.Errorf("request %d is %q, want %q", i, got[i], want[i])
+		}
+	}
+
+	if requests[0].body["username"] != "_discord_discord=3a42" || requests[1].body["displayname"] != "Bob" || requests[3].body["avatar_url"] != "mxc://hs.test/avatar" {
+		t.Errorf("registered ghost with %+v", requests[:4])
+	}
+	if text := requests[6]; text.userID != ghost || text.body["msgtype"] != "m.text" || text.body["body"] != "hello world" {
+		t.Errorf("sent text %+v", text)
+	}
+	if file := requests[8]; file.body["msgtype"] != "m.image" || file.body["body"] != "a.png" || file.body["url"] != "mxc://hs.test/a.png" {
+		t.Errorf("sent file %+v", file)
+	}
+	if file := requests[10]; file.body["msgtype"] != "m.file" || file.body["url"] != "mxc://hs.test/b.txt" {
+		t.Errorf("sent file %+v", file)
+	}
+
+	// the ghost is set up once
+	if _, err := tr.Send(ctx, endpoint, transport.Message{AuthorID: msg.AuthorID, Username: msg.Username, AvatarURL: msg.AvatarURL, Content: "again"}); err != nil {
+		t.Fatal(err)
+	}
+	if requests := hs.takeRequests(); len(requests) != 1 || !strings.Contains(requests[0].path, "/send/") {
+		t.Errorf("requested %q", requests)
+	}
+}
+
+func TestSendWithoutAuthor(t *testing.T) {
+	hs := newHomeserver(t)
+	tr, endpoint := newTransport(hs)
+
+	if _, err := tr.Send(context.Background(), endpoint, transport.Message{Content: "notice"}); err != nil {
+		t.Fatal(err)
+	}
+	if requests := hs.takeRequests(); len(requests) != 1 || requests[0].userID != "@bridge:hs.test" {
+		t.Errorf("requested %q", requests)
+	}
+}
+
+func TestSendFileFailure(t *testing.T) {
+	hs := newHomeserver(t)
+	tr, endpoint := newTransport(hs)
+	ctx := context.Background()
+
+	// a file failing after the text is left out of the message
+	id, err := tr.Send(ctx, endpoint, transport.Message{
+		Content: "text",
+		Files:   []transport.File{{Name: "huge.bin", Body: []byte("bin")}, {Name: "b.txt", Body: []byte("txt")}},
+	})
+	if err != nil || id != "$1,$2" {
+		t.Errorf("Send returned %q, %v", id, err)
+	}
+
+	// without any event sent, the message fails
+	_, err = tr.Send(ctx, endpoint, transport.Message{Files: []transport.File{{Name: "huge.bin", Body: []byte("bin")}}})
+	if apiErr := (*Error)(nil); !errors.As(err, &apiErr) || apiErr.Status != http.StatusRequestEntityTooLarge || apiErr.ErrCode != "M_TOO_LARGE" {
+		t.Errorf("Send returned %v", err)
+	}
+}
+
+func TestReplyEditReactDelete(t *testing.T) {
+	hs := newHomeserver(t)
+	tr, endpoint := newTransport(hs)
+	ctx := context.Background()
+
+	// a reply to a message of several events refers to its first one, and the quote is left to Matrix
+	if _, err := tr.Send(ctx, endpoint, transport.Message{
+		Header:  "-# > **Alice** hello",
+		Content: "hi",
+		ReplyTo: "$7,$8",
+	}); err != nil {
+		t.Fatal(err)
+	}
+	requests := hs.takeRequests()
+	inReplyTo, _ := relatesTo(requests[0])["m.in_reply_to"].(map[string]any)
+	if inReplyTo["event_id"] != "$7" || requests[0].body["body"] != "hi" {
+		t.Errorf("sent reply %+v", requests[0].body)
+	}
+
+	// without the replied message on Matrix, the quote stands in for it
+	if _, err := tr.Send(ctx, endpoint, transport.Message{Header: "-# > **Alice** hello", Content: "hi"}); err != nil {
+		t.Fatal(err)
+	}
+	requests = hs.takeRequests()
+	if relatesTo(requests[0]) != nil || requests[0].body["body"] != "> Alice hello\n\nhi" {
+		t.Errorf("sent reply %+v", requests[0].body)
+	}
+
+	id := "$1,$2,$3"
+	if err := tr.Edit(ctx, endpoint, id, transport.Message{Content: "_edited_"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := tr.React(ctx, endpoint, id, "👍"); err != nil {
+		t.Fatal(err)
+	}
+	if err := tr.Delete(ctx, endpoint, id); err != nil {
+		t.Fatal(err)
+	}
+
+	requests = hs.takeRequests()
+	if len(requests) != 5 {
+		t.Fatalf("requested %q", requests)
+	}
+
+	edit := requests[0]
+	newContent, _ := edit.body["m.new_content"].(map[string]any)
+	if relatesTo(edit)["rel_type"] != "m.replace" || relatesTo(edit)["event_id"] != "$1" || edit.body["body"] != "* edited" || newContent["body"] != "edited" {
+		t.Errorf("sent edit %+v", edit.body)
+	}
+
+	reaction := requests[1]
+	if !strings.Contains(reaction.path, "/send/m.reaction/") || reaction.userID != "@bridge:hs.test" || relatesTo(reaction)["event_id"] != "$1" || relatesTo(reaction)["key"] != "👍" {
+		t.Errorf("sent reaction %v %+v", reaction, reaction.body)
+	}
+
+	for i, eventID := range []string{"$1", "$2", "$3"} {
+		prefix := "PUT /_matrix/client/v3/rooms/%21room:hs.test/redact/" + eventID + "/"
+		if got := requests[2+i].String(); !strings.HasPrefix(got, prefix) {
+			t.Errorf("requested %q, want %q", got, prefix)
+		}
+	}
+}
+
+type received struct {
+	kind string
+	msg  transport.Incoming
+}
+
+type receiver struct {
+	endpoint transport.Endpoint
+	received []received
+}
+
+func (r *receiver) ReceiveCreate(endpoint transport.Endpoint, msg transport.Incoming) {
+	r.receive(endpoint, received{"create", msg})
+}
+
+func (r *receiver) ReceiveUpdate(endpoint transport.Endpoint, msg transport.Incoming) {
+	r.receive(endpoint, received{"update", msg})
+}
+
+func (r *receiver) ReceiveDelete(endpoint transport.Endpoint, messageID string) {
+	r.receive(endpoint, received{"delete", transport.Incoming{ID: messageID}})
+}
+
+func (r *receiver) receive(endpoint transport.Endpoint, got received) {
+	if endpoint != r.endpoint {
+		panic(fmt.Sprintf("received for endpoint %+v", endpoint))
+	}
+	r.received = append(r.received, got)
+}
+
+func transaction(t *testing.T, tr *Transport, r transport.Receiver, token, txnID string, events ...string) int {
+	body := `{"events":[` + strings.Join(events, ",") + `]}`
+	req := httptest.NewRequest(http.MethodPut, "/_matrix/app/v1/transactions/"+txnID, strings.NewReader(body))
+	req.SetPathValue("txnID", txnID)
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	w := httptest.NewRecorder()
+	tr.handleTransaction(w, req, r)
+	return w.Code
+}
+
+func TestListen(t *testing.T) {
+	hs := newHomeserver(t)
+	tr, endpoint := newTransport(hs)
+	r := &receiver{endpoint: endpoint}
+
+	events := []string{
+		`{"type":"m.room.member","room_id":"!room:hs.test","sender":"@carol:other.test","state_key":"@carol:other.test","content":{"membership":"join","displayname":"Carol","avatar_url":"mxc://other.test/carol"}}`,
+		`{"type":"m.room.message","event_id":"$a","room_id":"!room:hs.test","sender":"@carol:other.test","content":{"msgtype":"m.text","body":"**hello**"}}`,
+		`{"type":"m.room.message","event_id":"$b","room_id":"!elsewhere:hs.test","sender":"@carol:other.test","content":{"msgtype":"m.text","body":"other room"}}`,
+		`{"type":"m.room.message","event_id":"$c","room_id":"!room:hs.test","sender":"@_discord_42:hs.test","content":{"msgtype":"m.text","body":"own ghost"}}`,
+		`{"type":"m.room.message","event_id":"$d","room_id":"!room:hs.test","sender":"@bot:other.test","content":{"msgtype":"m.notice","body":"notice"}}`,
+		`{"type":"m.room.message","event_id":"$e","room_id":"!room:hs.test","sender":"@alice:hs.test","content":{"msgtype":"m.emote","body":"waves"}}`,
+		`{"type":"m.room.message","event_id":"$f","room_id":"!room:hs.test","sender":"@carol:other.test","content":{"msgtype":"m.text","body":"> <@alice:hs.test> hello\n> there\n\nreply","m.relates_to":{"m.in_reply_to":{"event_id":"$1"}}}}`,
+		`{"type":"m.room.message","event_id":"$g","room_id":"!room:hs.test","sender":"@carol:other.test","content":{"msgtype":"m.text","body":"* edited","m.new_content":{"msgtype":"m.text","body":"edited"},"m.relates_to":{"rel_type":"m.replace","event_id":"$a"}}}`,
+		`{"type":"m.room.message","event_id":"$h","room_id":"!room:hs.test","sender":"@carol:other.test","content":{"msgtype":"m.image","body":"cat.png","url":"mxc://other.test/cat","info":{"size":3,"mimetype":"image/png"}}}`,
+		`{"type":"m.room.message","event_id":"$k","room_id":"!room:hs.test","sender":"@carol:other.test","content":{"msgtype":"m.file","body":"big.bin","url":"mxc://other.test/big","info":{"size":1000}}}`,
+		`{"type":"m.room.message","event_id":"$l","room_id":"!room:hs.test","sender":"@carol:other.test","content":{"msgtype":"m.file","body":"lying.bin","url":"mxc://other.test/lying","info":{"size":3}}}`,
+		`{"type":"m.room.message","event_id":"$m","room_id":"!room:hs.test","sender":"@carol:other.test","content":{"msgtype":"m.file","body":"gone.bin","url":"mxc://other.test/gone"}}`,
+		// ghosts of other bridges on other servers are not ours
+		`{"type":"m.room.member","room_id":"!room:hs.test","sender":"@_discord_7:other.test","state_key":"@_discord_7:other.test","content":{"membership":"join","displayname":"Dan"}}`,
+		`{"type":"m.room.message","event_id":"$n","room_id":"!room:hs.test","sender":"@_discord_7:other.test","content":{"msgtype":"m.text","body":"foreign ghost"}}`,
+		`{"type":"m.room.redaction","event_id":"$i","room_id":"!room:hs.test","sender":"@carol:other.test","redacts":"$a","content":{}}`,
+		`{"type":"m.room.redaction","event_id":"$j","room_id":"!room:hs.test","sender":"@carol:other.test","content":{"redacts":"$h"}}`,
+	}
+
+	if code := transaction(t, tr, r, "wrong", "1", events...); code != http.StatusForbidden || len(r.received) != 0 {
+		t.Fatalf("unauthorized transaction returned %d and relayed %+v", code, r.received)
+	}
+	if code := transaction(t, tr, r, hsToken, "1", events...); code != http.StatusOK {
+		t.Fatalf("transaction returned %d", code)
+	}
+	// retries of an acknowledged transaction are not relayed again
+	if code := transaction(t, tr, r, hsToken, "1", events...); code != http.StatusOK {
+		t.Fatalf("retried transaction returned %d", code)
+	}
+
+	carolAvatar := "https://media.test/other.test/carol?user=carol"
+	want := []received{
+		{"create", transport.Incoming{Message: transport.Message{AuthorID: "@carol:other.test", Username: "Carol", AvatarURL: carolAvatar, Content: "**hello**"}, ID: "$a", Origin: "other.test"}},
+		{"create", transport.Incoming{Message: transport.Message{AuthorID: "@alice:hs.test", Username: "Alice", AvatarURL: "https://media.test/hs.test/alice?user=alice", Content: "*waves*"}, ID: "$e", Origin: "hs.test"}},
+		{"create", transport.Incoming{Message: transport.Message{AuthorID: "@carol:other.test", Username: "Carol", AvatarURL: carolAvatar, Content: "reply", ReplyTo: "$1"}, ID: "$f", Origin: "other.test"}},
+		{"update", transport.Incoming{Message: transport.Message{AuthorID: "@carol:other.test", Username: "Carol", AvatarURL: carolAvatar, Content: "edited"}, ID: "$a", Origin: "other.test"}},
+		{"create", transport.Incoming{Message: transport.Message{AuthorID: "@carol:other.test", Username: "Carol", AvatarURL: carolAvatar, Content: "\n-# big.bin is too large to bridge"}, ID: "$k", Origin: "other.test"}},
+		{"create", transport.Incoming{Message: transport.Message{AuthorID: "@carol:other.test", Username: "Carol", AvatarURL: carolAvatar, Content: "\n-# lying.bin is too large to bridge"}, ID: "$l", Origin: "other.test"}},
+		{"create", transport.Incoming{Message: transport.Message{AuthorID: "@_discord_7:other.test", Username: "Dan", Content: "foreign ghost"}, ID: "$n", Origin: "other.test"}},
+		{"delete", transport.Incoming{ID: "$a"}},
+		{"delete", transport.Incoming{ID: "$h"}},
+	}
+
+	got := []received{}
+	for _, rec := range r.received {
+		if len(rec.msg.Files) > 0 {
+			file := rec.msg.Files[0]
+			if rec.msg.ID != "$h" || file.Name != "cat.png" || file.URL != "" || string(file.Body) != "meow" || file.Size != 4 || file.ContentType != "image/png" {
+				t.Errorf("received file %+v", rec.msg)
+			}
+			continue
+		}
+		got = append(got, rec)
+	}
+	if len(got) != len(want) {
+		t.Fatalf("received %+v, want %+v", got, want)
+	}
+	for i := range want {
+		if got[i].kind != want[i].kind || fmt.Sprint(got[i].msg) != fmt.Sprint(want[i].msg) {
+			t.Errorf("received %s %+v, want %s %+v", got[i].kind, got[i].msg, want[i].kind, want[i].msg)
+		}
+	}
+
+	// the profile of Alice is fetched once, Carol's is known from the membership event
+	profiles := 0
+	for _, req := range hs.takeRequests() {
+		if req.method == http.MethodGet && strings.Contains(req.path, "alice") {
+			profiles++
+		} else if strings.Contains(req.path, "carol") {
+			t.Errorf("requested %v", req)
+		}
+	}
+	if profiles != 1 {
+		t.Errorf("fetched %d profiles", profiles)
+	}
+}
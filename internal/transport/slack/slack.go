@@ -0,0 +1,591 @@
+package slack
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/mandriota/bridge-discord-bot/internal/cache"
+	"github.com/mandriota/bridge-discord-bot/internal/texts"
+	"github.com/mandriota/bridge-discord-bot/internal/transport"
+)
+
+const (
+	Name = "slack"
+
+	filePrefix      = "file:"
+	maxCallAttempts = 3
+	reconnectDelay  = 5 * time.Second
+	eventCacheSize  = 1000
+	eventCacheTTL   = time.Hour
+	maxThreadRoots  = 10000
+)
+
+var errFileTooLarge = errors.New("slack: file too large")
+
+type Config struct {
+	// APIURL is the Web API base URL, as in https://slack.com/api.
+	APIURL string
+	// AppToken is the app-level token opening Socket Mode connections.
+	AppToken string
+	BotToken string
+	// MaxFileSize limits files downloaded from Slack, larger files are only mentioned by name.
+	MaxFileSize int
+}
+
+// Error is an unsuccessful response of the Web API.
+type Error struct {
+	Method string
+	Code   string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("slack: %s: %s", e.Method, e.Code)
+}
+
+type user struct {
+	name      string
+	avatarURL string
+}
+
+// Transport posts to Slack channels under the names and avatars of authors and receives
+// messages posted there through Socket Mode. Endpoint addresses are channel IDs.
+//
+// Messages with files are identified by the timestamp of their text, if any, followed by
+// the IDs of the files prefixed by "file:".
+type Transport struct {
+	cfg       Config
+	endpoints map[string]transport.Endpoint
+	client    *http.Client
+	logger    *slog.Logger
+
+	events *cache.TTL[string]
+
+	mu          sync.Mutex
+	users       map[string]user
+	threadRoots map[string]string
+}
+
+func New(cfg Config, endpoints []transport.Endpoint, logger *slog.Logger) *Transport {
+	t := &Transport{
+		cfg:         cfg,
+		endpoints:   map[string]transport.Endpoint{},
+		client:      &http.Client{Timeout: time.Minute},
+		logger:      logger,
+		events:      cache.NewTTL[string](eventCacheSize, eventCacheTTL),
+		users:       map[string]user{},
+		threadRoots: map[string]string{},
+	}
+	for _, endpoint := range endpoints {
+		t.endpoints[endpoint.Address] = endpoint
+	}
+	return t
+}
+
+func (t *Transport) Name() string {
+	return Name
+}
+
+// call invokes a Web API method with a form encoded body, waiting out rate limits.
+func (t *Transport) call(ctx context.Context, token, method string, params url.Values, out any) error {
+	for attempt := 1; ; attempt++ {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimSuffix(t.cfg.APIURL, "/")+"/"+method, strings.NewReader(params.Encode()))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		resp, err := t.client.Do(req)
+		if err != nil {
+			return err
+		}
+
+		if resp.StatusCode == http.StatusTooManyRequests && attempt < maxCallAttempts {
+			resp.Body.Close()
+			retryAfter, _ := strconv.Atoi(resp.Header.Get("Retry-After"))
+
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(time.Duration(max(retryAfter, 1)) * time.Second):
+			}
+			continue
+		}
+
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return err
+		}
+
+		result := struct {
+			OK    bool   `json:"ok"`
+			Error string `json:"error"`
+		}{}
+		if err := json.Unmarshal(body, &result); err != nil {
+			return fmt.Errorf("slack: %s: %s", method, resp.Status)
+		}
+		if !result.OK {
+			return &Error{Method: method, Code: result.Error}
+		}
+
+		if out == nil {
+			return nil
+		}
+		return json.Unmarshal(body, out)
+	}
+}
+
+// threadRoot returns the timestamp of the message starting the thread of the message, as Slack only threads replies under it.
+func (t *Transport) threadRoot(ts string) string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if root, ok := t.threadRoots[ts]; ok {
+		return root
+	}
+	return ts
+}
+
+func (t *Transport) saveThreadRoot(ts, root string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if len(t.threadRoots) >= maxThreadRoots {
+		clear(t.threadRoots)
+	}
+	t.threadRoots[ts] = root
+}
+
+func formatText(msg transport.Message) string {
+	text := texts.MarkdownToMrkdwn(msg.Content)
+	if quote := msg.QuotedReply(); msg.ReplyTo == "" && quote != "" {
+		text = "&gt; " + strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;").Replace(strings.TrimPrefix(quote, "> ")) + "\n" + text
+	}
+	return text
+}
+
+func (t *Transport) Send(ctx context.Context, endpoint transport.Endpoint, msg transport.Message) (string, error) {
+	threadTS := ""
+	if msg.ReplyTo != "" {
+		if firstPart := transport.MessageIDParts(msg.ReplyTo)[0]; !strings.HasPrefix(firstPart, filePrefix) {
+			threadTS = t.threadRoot(firstPart)
+		}
+	}
+
+	parts := []string{}
+
+	if text := formatText(msg); strings.TrimSpace(text) != "" {
+		params := url.Values{
+			"channel":      {endpoint.Address},
+			"text":         {text},
+			"username":     {msg.Username},
+			"unfurl_links": {"false"},
+		}
+		if msg.AvatarURL != "" {
+			params.Set("icon_url", msg.AvatarURL)
+		}
+		if threadTS != "" {
+			params.Set("thread_ts", threadTS)
+		}
+
+		posted := struct {
+			TS string `json:"ts"`
+		}{}
+		if err := t.call(ctx, t.cfg.BotToken, "chat.postMessage", params, &posted); err != nil {
+			return "", err
+		}
+		parts = append(parts, posted.TS)
+
+		if threadTS != "" {
+			t.saveThreadRoot(posted.TS, threadTS)
+		}
+	}
+
+	if len(msg.Files) > 0 {
+		// files are posted by the bot itself, the comment names the author when there is no text to do so
+		comment := ""
+		if len(parts) == 0 {
+			comment = "*" + strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;").Replace(msg.Username) + "*"
+		}
+
+		fileIDs, err := t.uploadFiles(ctx, endpoint.Address, threadTS, comment, msg.Files)
+		if err != nil {
+			if len(parts) == 0 {
+				return "", err
+			}
+			t.logger.Error("failed to upload files to Slack", "error", err)
+		}
+		for _, fileID := range fileIDs {
+			parts = append(parts, filePrefix+fileID)
+		}
+	}
+
+	if len(parts) == 0 {
+		return "", errors.New("empty message")
+	}
+	return strings.Join(parts, ","), nil
+}
+
+// uploadFiles uploads the files and shares them in the channel as a single message.
+func (t *Transport) uploadFiles(ctx context.Context, channelID, threadTS, comment string, files []transport.File) ([]string, error) {
+	uploaded := []map[string]string{}
+	fileIDs := []string{}
+
+	for _, file := range files {
+		if file.Body == nil {
+			continue
+		}
+
+		target := struct {
+			UploadURL string `json:"upload_url"`
+			FileID    string `json:"file_id"`
+		}{}
+		if err := t.call(ctx, t.cfg.BotToken, "files.getUploadURLExternal", url.Values{
+			"filename": {file.Name},
+			"length":   {strconv.Itoa(len(file.Body))},
+		}, &target); err != nil {
+			return nil, err
+		}
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, target.UploadURL, bytes.NewReader(file.Body))
+		if err != nil {
+			return nil, err
+		}
+		resp, err := t.client.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("slack: file upload failed: %s", resp.Status)
+		}
+
+		uploaded = append(uploaded, map[string]string{"id": target.FileID, "title": file.Name})
+		fileIDs = append(fileIDs, target.FileID)
+	}
+
+	if len(uploaded) == 0 {
+		return nil, nil
+	}
+
+	encoded, err := json.Marshal(uploaded)
+	if err != nil {
+		return nil, err
+	}
+
+	params := url.Values{
+		"files":      {string(encoded)},
+		"channel_id": {channelID},
+	}
+	if threadTS != "" {
+		params.Set("thread_ts", threadTS)
+	}
+	if comment != "" {
+		params.Set("initial_comment", comment)
+	}
+
+	return fileIDs, t.call(ctx, t.cfg.BotToken, "files.completeUploadExternal", params, nil)
+}
+
+func (t *Transport) Edit(ctx context.Context, endpoint transport.Endpoint, messageID string, msg transport.Message) error {
+	ts := transport.MessageIDParts(messageID)[0]
+	if strings.HasPrefix(ts, filePrefix) {
+		return transport.ErrUnsupported
+	}
+
+	return t.call(ctx, t.cfg.BotToken, "chat.update", url.Values{
+		"channel": {endpoint.Address},
+		"ts":      {ts},
+		"text":    {formatText(msg)},
+	}, nil)
+}
+
+func (t *Transport) Delete(ctx context.Context, endpoint transport.Endpoint, messageID string) error {
+	for _, part := range transport.MessageIDParts(messageID) {
+		err := error(nil)
+		if fileID, ok := strings.CutPrefix(part, filePrefix); ok {
+			err = t.call(ctx, t.cfg.BotToken, "files.delete", url.Values{"file": {fileID}}, nil)
+		} else {
+			err = t.call(ctx, t.cfg.BotToken, "chat.delete", url.Values{"channel": {endpoint.Address}, "ts": {part}}, nil)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// React is unsupported, as Slack reactions are added by emoji name rather than by the emoji itself.
+func (t *Transport) React(ctx context.Context, endpoint transport.Endpoint, messageID, emoji string) error {
+	return transport.ErrUnsupported
+}
+
+//=:slack:socket_mode
+
+type file struct {
+	Name               string `json:"name"`
+	Mimetype           string `json:"mimetype"`
+	Size               int    `json:"size"`
+	URLPrivateDownload string `json:"url_private_download"`
+}
+
+type message struct {
+	Type            string   `json:"type"`
+	Subtype         string   `json:"subtype"`
+	Channel         string   `json:"channel"`
+	User            string   `json:"user"`
+	BotID           string   `json:"bot_id"`
+	Text            string   `json:"text"`
+	TS              string   `json:"ts"`
+	ThreadTS        string   `json:"thread_ts"`
+	Files           []file   `json:"files"`
+	Message         *message `json:"message"`
+	PreviousMessage *message `json:"previous_message"`
+	DeletedTS       string   `json:"deleted_ts"`
+}
+
+type envelope struct {
+	EnvelopeID string `json:"envelope_id"`
+	Type       string `json:"type"`
+	Payload    struct {
+		EventID string  `json:"event_id"`
+		TeamID  string  `json:"team_id"`
+		Event   message `json:"event"`
+	} `json:"payload"`
+}
+
+// Listen receives events through Socket Mode until ctx is done, reconnecting when Slack asks to or the connection fails.
+func (t *Transport) Listen(ctx context.Context, receiver transport.Receiver) error {
+	for {
+		err := t.session(ctx, receiver)
+		if ctx.Err() != nil {
+			return nil
+		}
+		if err == nil {
+			continue
+		}
+		t.logger.Error("Slack connection lost", "error", err)
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(reconnectDelay):
+		}
+	}
+}
+
+func (t *Transport) session(ctx context.Context, receiver transport.Receiver) error {
+	connection := struct {
+		URL string `json:"url"`
+	}{}
+	if err := t.call(ctx, t.cfg.AppToken, "apps.connections.open", url.Values{}, &connection); err != nil {
+		return err
+	}
+
+	conn, _, err := websocket.DefaultDialer.DialContext(ctx, connection.URL, nil)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	stop := context.AfterFunc(ctx, func() {
+		conn.Close()
+	})
+	defer stop()
+
+	for {
+		env := envelope{}
+		if err := conn.ReadJSON(&env); err != nil {
+			return err
+		}
+
+		// events are redelivered when not acknowledged in time, so acknowledge before handling
+		if env.EnvelopeID != "" {
+			if err := conn.WriteJSON(map[string]string{"envelope_id": env.EnvelopeID}); err != nil {
+				return err
+			}
+		}
+
+		switch env.Type {
+		case "disconnect":
+			return nil
+		case "events_api":
+			if eventID := env.Payload.EventID; eventID != "" {
+				if t.events.Contains(eventID) {
+					continue
+				}
+				t.events.Add(eventID)
+			}
+			t.handleEvent(ctx, receiver, env.Payload.TeamID, env.Payload.Event)
+		}
+	}
+}
+
+func (t *Transport) handleEvent(ctx context.Context, receiver transport.Receiver, teamID string, ev message) {
+	endpoint, ok := t.endpoints[ev.Channel]
+	if ev.Type != "message" || !ok {
+		return
+	}
+
+	switch ev.Subtype {
+	case "", "file_share", "thread_broadcast", "me_message":
+		incoming, ok := t.incoming(ctx, teamID, ev, true)
+		if !ok {
+			return
+		}
+		if ev.Subtype == "me_message" {
+			incoming.Content = "*" + incoming.Content + "*"
+		}
+		receiver.ReceiveCreate(endpoint, incoming)
+	case "message_changed":
+		// unfurling links changes messages without changing their text
+		if ev.Message == nil || ev.PreviousMessage != nil && ev.PreviousMessage.Text == ev.Message.Text {
+			return
+		}
+		if incoming, ok := t.incoming(ctx, teamID, *ev.Message, false); ok {
+			receiver.ReceiveUpdate(endpoint, incoming)
+		}
+	case "message_deleted":
+		// deleted messages of bots, the bridge included, are not bridged in the first place
+		if ev.PreviousMessage != nil && ev.PreviousMessage.BotID != "" {
+			return
+		}
+		receiver.ReceiveDelete(endpoint, ev.DeletedTS)
+	}
+}
+
+func (t *Transport) incoming(ctx context.Context, teamID string, m message, withFiles bool) (transport.Incoming, bool) {
+	// messages of bots, the bridge's own included, are never relayed to avoid loops
+	if m.BotID != "" || m.User == "" {
+		return transport.Incoming{}, false
+	}
+
+	author := t.loadUser(ctx, m.User)
+	incoming := transport.Incoming{
+		Message: transport.Message{
+			AuthorID:  m.User,
+			Username:  author.name,
+			AvatarURL: author.avatarURL,
+			Content: texts.MrkdwnToMarkdown(m.Text, func(userID string) string {
+				return t.loadUser(ctx, userID).name
+			}),
+		},
+		ID:     m.TS,
+		Origin: teamID,
+	}
+
+	if m.ThreadTS != "" && m.ThreadTS != m.TS {
+		incoming.ReplyTo = m.ThreadTS
+		t.saveThreadRoot(m.TS, m.ThreadTS)
+	}
+
+	if withFiles {
+		for _, f := range m.Files {
+			if f.Size > t.cfg.MaxFileSize || f.URLPrivateDownload == "" {
+				incoming.Content += "\n-# " + f.Name + " is too large to bridge"
+				continue
+			}
+
+			body, err := t.download(ctx, f.URLPrivateDownload)
+			if errors.Is(err, errFileTooLarge) {
+				incoming.Content += "\n-# " + f.Name + " is too large to bridge"
+				continue
+			} else if err != nil {
+				t.logger.Error("failed to download Slack file", "error", err, "file", f.Name)
+				continue
+			}
+
+			incoming.Files = append(incoming.Files, transport.File{
+				Name:        f.Name,
+				ContentType: f.Mimetype,
+				Size:        len(body),
+				Body:        body,
+			})
+		}
+	}
+
+	if strings.TrimSpace(incoming.Content) == "" && len(incoming.Files) == 0 {
+		return incoming, false
+	}
+	return incoming, true
+}
+
+// download fetches a private file, which requires the bot token, so files are handed over with their body and without URL.
+func (t *Transport) download(ctx context.Context, fileURL string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fileURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+t.cfg.BotToken)
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("slack: file download failed: %s", resp.Status)
+	}
+
+	// the size reported with the event is not checked against the file actually served
+	body, err := io.ReadAll(io.LimitReader(resp.Body, int64(t.cfg.MaxFileSize)+1))
+	if err != nil {
+		return nil, err
+	} else if len(body) > t.cfg.MaxFileSize {
+		return nil, errFileTooLarge
+	}
+	return body, nil
+}
+
+// loadUser returns the display name and avatar of a Slack user, falling back to the user ID.
+func (t *Transport) loadUser(ctx context.Context, userID string) user {
+	t.mu.Lock()
+	u, ok := t.users[userID]
+	t.mu.Unlock()
+	if ok {
+		return u
+	}
+
+	info := struct {
+		User struct {
+			Name    string `json:"name"`
+			Profile struct {
+				DisplayName string `json:"display_name"`
+				RealName    string `json:"real_name"`
+				Image192    string `json:"image_192"`
+			} `json:"profile"`
+		} `json:"user"`
+	}{}
+	if err := t.call(ctx, t.cfg.BotToken, "users.info", url.Values{"user": {userID}}, &info); err != nil {
+		t.logger.Warn("failed to fetch Slack user", "error", err, "user_id", userID)
+		return user{name: userID}
+	}
+
+	u = user{name: info.User.Profile.DisplayName, avatarURL: info.User.Profile.Image192}
+	if u.name == "" {
+		u.name = info.User.Profile.RealName
+	}
+	if u.name == "" {
+		u.name = info.User.Name
+	}
+
+	t.mu.Lock()
+	t.users[userID] = u
+	t.mu.Unlock()
+
+	return u
+}
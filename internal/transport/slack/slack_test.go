@@ -0,0 +1,382 @@
+package slack
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/mandriota/bridge-discord-bot/internal/transport"
+)
+
+const (
+	appToken = "xapp-test"
+	botToken = "xoxb-test"
+)
+
+type call struct {
+	method string
+	params map[string]string
+}
+
+// slackStub serves the Web API methods the transport calls, file uploads and downloads, and a Socket Mode connection.
+type slackStub struct {
+	t      *testing.T
+	server *httptest.Server
+
+	mu      sync.Mutex
+	calls   []call
+	nextTS  int
+	uploads map[string]string
+
+	envelopes chan any
+	acks      chan string
+}
+
+func newSlackStub(t *testing.T) *slackStub {
+	s := &slackStub{t: t, uploads: map[string]string{}, envelopes: make(chan any, 10), acks: make(chan string, 10)}
+	s.server = httptest.NewServer(http.HandlerFunc(s.serve))
+	t.Cleanup(s.server.Close)
+	return s
+}
+
+func (s *slackStub) serve(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case r.URL.Path == "/socket":
+		s.serveSocket(w, r)
+		return
+	case strings.HasPrefix(r.URL.Path, "/upload/"):
+		body, _ := io.ReadAll(r.Body)
+		s.mu.Lock()
+		s.uploads[strings.TrimPrefix(r.URL.Path, "/upload/")] = string(body)
+		s.mu.Unlock()
+		return
+	case strings.HasPrefix(r.URL.Path, "/files/"):
+		if r.Header.Get("Authorization") != "Bearer "+botToken {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		io.WriteString(w, strings.TrimPrefix(r.URL.Path, "/files/"))
+		return
+	}
+
+	method := strings.TrimPrefix(r.URL.Path, "/api/")
+	token := botToken
+	if method == "apps.connections.open" {
+		token = appToken
+	}
+	if r.Header.Get("Authorization") != "Bearer "+token {
+		json.NewEncoder(w).Encode(map[string]any{"ok": false, "error": "invalid_auth"})
+		return
+	}
+
+	r.ParseForm()
+	c := call{method: method, params: map[string]string{}}
+	for key := range r.PostForm {
+		c.params[key] = r.PostForm.Get(key)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	result := map[string]any{"ok": true}
+	switch method {
+	case "apps.connections.open":
+		result["url"] = "ws" + strings.TrimPrefix(s.server.URL, "http") + "/socket"
+	case "users.info":
+		result["user"] = map[string]any{"name": "carol", "profile": map[string]string{"display_name": "Carol", "image_192": "https://avatars.test/carol"}}
+	case "chat.postMessage":
+		s.nextTS++
+		result["ts"] = fmt.Sprintf("100.%06d", s.nextTS)
+	case "files.getUploadURLExternal":
+		fileID := "F" + c.params["filename"]
+		result["upload_url"] = s.server.URL + "/upload/" + fileID
+		result["file_id"] = fileID
+	}
+
+	if method != "apps.connections.open" && method != "users.info" {
+		s.calls = append(s.calls, c)
+	}
+	json.NewEncoder(w).Encode(result)
+}
+
+func (s *slackStub) serveSocket(w http.ResponseWriter, r *http.Request) {
+	conn, err := (&websocket.Upgrader{}).Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	go func() {
+		for {
+			ack := map[string]string{}
+			if err := conn.ReadJSON(&ack); err != nil {
+				return
+			}
+			s.acks <- ack["envelope_id"]
+		}
+	}()
+
+	conn.WriteJSON(map[string]string{"type": "hello"})
+	for {
+		select {
+		case env := <-s.envelopes:
+			if err := conn.WriteJSON(env); err != nil {
+				return
+			}
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+func (s *slackStub) takeCalls() []call {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	calls := s.calls
+	s.calls = nil
+	return calls
+}
+
+func newTransport(s *slackStub) (*Transport, transport.Endpoint) {
+	endpoint := transport.Endpoint{ChannelID: transport.NewID(), Transport: Name, Address: "C1"}
+	return New(Config{
+		APIURL:      s.server.URL + "/api",
+		AppToken:    appToken,
+		BotToken:    botToken,
+		MaxFileSize: 8,
+	}, []transport.Endpoint{endpoint}, slog.New(slog.NewTextHandler(io.Discard, nil))), endpoint
+}
+
+func TestSend(t *testing.T) {
+	s := newSlackStub(t)
+	tr, endpoint := newTransport(s)
+	ctx := context.Background()
+
+	id, err := tr.Send(ctx, endpoint, transport.Message{
+		Username:  "Alice",
+		AvatarURL: "https://avatars.test/alice",
+		Header:    "-# > **Bob** earlier",
+		Content:   "**hello** <world>",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id != "100.000001" {
+		t.Errorf("Send returned ID %q", id)
+	}
+
+	calls := s.takeCalls()
+	if len(calls) != 1 || calls[0].method != "chat.postMessage" {
+		t.Fatalf("called %+v", calls)
+	}
+	want := map[string]string{
+		"channel":      "C1",
+		"text":         "&gt; Bob earlier\n*hello* &lt;world&gt;",
+		"username":     "Alice",
+		"icon_url":     "https://avatars.test/alice",
+		"unfurl_links": "false",
+	}
+	for key, value := range want {
+		if calls[0].params[key] != value {
+			t.Errorf("sent %s %q, want %q", key, calls[0].params[key], value)
+		}
+	}
+
+	if err := tr.Edit(ctx, endpoint, id, transport.Message{Content: "edited"}); err != nil {
+		t.Fatal(err)
+	}
+	calls = s.takeCalls()
+	if len(calls) != 1 || calls[0].method != "chat.update" || calls[0].params["ts"] != id || calls[0].params["text"] != "edited" {
+		t.Errorf("called %+v", calls)
+	}
+
+	if err := tr.React(ctx, endpoint, id, "👍"); !errors.Is(err, transport.ErrUnsupported) {
+		t.Errorf("React returned %v", err)
+	}
+}
+
+func TestSendReplyThreads(t *testing.T) {
+	s := newSlackStub(t)
+	tr, endpoint := newTransport(s)
+	ctx := context.Background()
+
+	root, err := tr.Send(ctx, endpoint, transport.Message{Username: "Alice", Content: "root"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	reply, err := tr.Send(ctx, endpoint, transport.Message{Username: "Bob", Header: "-# > **Alice** root", Content: "reply", ReplyTo: root + ",file:Fa.png"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Slack threads only under the first message of a thread
+	if _, err := tr.Send(ctx, endpoint, transport.Message{Username: "Carol", Content: "nested", ReplyTo: reply}); err != nil {
+		t.Fatal(err)
+	}
+
+	calls := s.takeCalls()
+	if calls[1].params["thread_ts"] != root || calls[1].params["text"] != "reply" {
+		t.Errorf("sent reply %+v", calls[1].params)
+	}
+	if calls[2].params["thread_ts"] != root {
+		t.Errorf("sent nested reply %+v", calls[2].params)
+	}
+}
+
+func TestSendFiles(t *testing.T) {
+	s := newSlackStub(t)
+	tr, endpoint := newTransport(s)
+	ctx := context.Background()
+
+	id, err := tr.Send(ctx, endpoint, transport.Message{
+		Username: "Alice",
+		Content:  "files",
+		Files: []transport.File{
+			{Name: "a.png", Body: []byte("png")},
+			{Name: "b.txt", Body: []byte("txt")},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id != "100.000001,file:Fa.png,file:Fb.txt" {
+		t.Fatalf("Send returned ID %q", id)
+	}
+	if s.uploads["Fa.png"] != "png" || s.uploads["Fb.txt"] != "txt" {
+		t.Errorf("uploaded %q", s.uploads)
+	}
+
+	calls := s.takeCalls()
+	complete := calls[len(calls)-1]
+	if complete.method != "files.completeUploadExternal" || complete.params["channel_id"] != "C1" || complete.params["initial_comment"] != "" {
+		t.Errorf("completed upload with %+v", complete)
+	}
+
+	if err := tr.Delete(ctx, endpoint, id); err != nil {
+		t.Fatal(err)
+	}
+	got := []string{}
+	for _, c := range s.takeCalls() {
+		got = append(got, c.method+" "+c.params["ts"]+c.params["file"])
+	}
+	if want := "chat.delete 100.000001; files.delete Fa.png; files.delete Fb.txt"; strings.Join(got, "; ") != want {
+		t.Errorf("called %q, want %q", got, want)
+	}
+
+	// without text, the bot names the author in the comment of the files
+	if _, err := tr.Send(ctx, endpoint, transport.Message{Username: "Bob", Files: []transport.File{{Name: "c.png", Body: []byte("png")}}}); err != nil {
+		t.Fatal(err)
+	}
+	calls = s.takeCalls()
+	if complete := calls[len(calls)-1]; complete.params["initial_comment"] != "*Bob*" {
+		t.Errorf("completed upload with %+v", complete)
+	}
+}
+
+type received struct {
+	kind string
+	msg  transport.Incoming
+}
+
+type receiver chan received
+
+func (r receiver) ReceiveCreate(endpoint transport.Endpoint, msg transport.Incoming) {
+	r <- received{"create", msg}
+}
+
+func (r receiver) ReceiveUpdate(endpoint transport.Endpoint, msg transport.Incoming) {
+	r <- received{"update", msg}
+}
+
+func (r receiver) ReceiveDelete(endpoint transport.Endpoint, messageID string) {
+	r <- received{"delete", transport.Incoming{ID: messageID}}
+}
+
+func eventEnvelope(id string, event message) envelope {
+	env := envelope{EnvelopeID: "env-" + id, Type: "events_api"}
+	env.Payload.EventID = id
+	env.Payload.TeamID = "T1"
+	env.Payload.Event = event
+	return env
+}
+
+func TestListen(t *testing.T) {
+	s := newSlackStub(t)
+	tr, _ := newTransport(s)
+
+	s.envelopes <- eventEnvelope("E1", message{Type: "message", Channel: "C1", User: "U1", Text: "*bold* <@U1>", TS: "1.1"})
+	s.envelopes <- eventEnvelope("E1", message{Type: "message", Channel: "C1", User: "U1", Text: "redelivered", TS: "1.1"})
+	s.envelopes <- eventEnvelope("E2", message{Type: "message", Channel: "C2", User: "U1", Text: "other channel", TS: "1.2"})
+	s.envelopes <- eventEnvelope("E3", message{Type: "message", Channel: "C1", BotID: "B1", Text: "bot", TS: "1.3"})
+	s.envelopes <- eventEnvelope("E4", message{Type: "message", Channel: "C1", User: "U1", Text: "in thread", TS: "1.4", ThreadTS: "1.1"})
+	s.envelopes <- eventEnvelope("E5", message{Type: "message", Subtype: "message_changed", Channel: "C1",
+		Message:         &message{User: "U1", Text: "edited", TS: "1.1"},
+		PreviousMessage: &message{User: "U1", Text: "*bold* <@U1>", TS: "1.1"},
+	})
+	s.envelopes <- eventEnvelope("E6", message{Type: "message", Subtype: "message_deleted", Channel: "C1", DeletedTS: "1.4", PreviousMessage: &message{User: "U1"}})
+	s.envelopes <- eventEnvelope("E7", message{Type: "message", Subtype: "file_share", Channel: "C1", User: "U1", TS: "1.5", Files: []file{
+		{Name: "small.bin", Size: 8, URLPrivateDownload: s.server.URL + "/files/12345678"},
+		{Name: "lying.bin", Size: 1, URLPrivateDownload: s.server.URL + "/files/123456789"},
+		{Name: "large.bin", Size: 9, URLPrivateDownload: s.server.URL + "/files/123456789"},
+	}})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	r := make(receiver, 10)
+	go tr.Listen(ctx, r)
+
+	next := func() received {
+		t.Helper()
+		select {
+		case got := <-r:
+			return got
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for message")
+			return received{}
+		}
+	}
+
+	got := next()
+	if got.kind != "create" || got.msg.ID != "1.1" || got.msg.Content != "**bold** @Carol" || got.msg.Username != "Carol" || got.msg.AvatarURL != "https://avatars.test/carol" || got.msg.Origin != "T1" {
+		t.Errorf("received %+v", got)
+	}
+
+	got = next()
+	if got.kind != "create" || got.msg.ID != "1.4" || got.msg.ReplyTo != "1.1" {
+		t.Errorf("received %+v", got)
+	}
+
+	got = next()
+	if got.kind != "update" || got.msg.ID != "1.1" || got.msg.Content != "edited" {
+		t.Errorf("received %+v", got)
+	}
+
+	got = next()
+	if got.kind != "delete" || got.msg.ID != "1.4" {
+		t.Errorf("received %+v", got)
+	}
+
+	got = next()
+	if got.kind != "create" || len(got.msg.Files) != 1 || string(got.msg.Files[0].Body) != "12345678" ||
+		got.msg.Content != "\n-# lying.bin is too large to bridge\n-# large.bin is too large to bridge" {
+		t.Errorf("received %+v", got)
+	}
+
+	for range 8 {
+		select {
+		case <-s.acks:
+		case <-time.After(5 * time.Second):
+			t.Fatal("envelope not acknowledged")
+		}
+	}
+}
@@ -0,0 +1,690 @@
+package telegram
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"log/slog"
+	"mime/multipart"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf16"
+
+	"github.com/mandriota/bridge-discord-bot/internal/texts"
+	"github.com/mandriota/bridge-discord-bot/internal/transport"
+)
+
+const (
+	Name = "telegram"
+
+	maxTextLength    = 4096
+	maxCaptionLength = 1024
+	maxCallAttempts  = 3
+	reconnectDelay   = 5 * time.Second
+)
+
+var errFileTooLarge = errors.New("telegram: file too large")
+
+type Config struct {
+	// BaseURL is the Bot API server, as in https://api.telegram.org.
+	BaseURL     string
+	Token       string
+	PollTimeout time.Duration
+	// MaxFileSize limits files downloaded from Telegram, larger files are only mentioned by name.
+	MaxFileSize int
+	// AvatarTemplate is the avatar URL of Telegram users in Discord, with {id} and {username} replaced.
+	AvatarTemplate string
+}
+
+// Error is an unsuccessful response of the Bot API.
+type Error struct {
+	Code        int    `json:"error_code"`
+	Description string `json:"description"`
+	Parameters  *struct {
+		RetryAfter int `json:"retry_after"`
+	} `json:"parameters"`
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("telegram: %d: %s", e.Code, e.Description)
+}
+
+// Transport relays messages to Telegram groups as a bot and receives messages posted there by long polling.
+// Endpoint addresses are chat IDs.
+type Transport struct {
+	cfg       Config
+	endpoints map[string]transport.Endpoint
+	client    *http.Client
+	logger    *slog.Logger
+	botID     int64
+}
+
+func New(cfg Config, endpoints []transport.Endpoint, logger *slog.Logger) *Transport {
+	t := &Transport{
+		cfg:       cfg,
+		endpoints: map[string]transport.Endpoint{},
+		client:    &http.Client{Timeout: cfg.PollTimeout + time.Minute},
+		logger:    logger,
+	}
+	for _, endpoint := range endpoints {
+		t.endpoints[endpoint.Address] = endpoint
+	}
+	return t
+}
+
+func (t *Transport) Name() string {
+	return Name
+}
+
+func (t *Transport) methodURL(method string) string {
+	return strings.TrimSuffix(t.cfg.BaseURL, "/") + "/bot" + t.cfg.Token + "/" + method
+}
+
+// call invokes a Bot API method, waiting out flood limits. Params with a file are sent as a multipart form.
+func (t *Transport) call(ctx context.Context, method string, params map[string]any, file *upload, out any) error {
+	for attempt := 1; ; attempt++ {
+		err := t.do(ctx, method, params, file, out)
+
+		apiErr := (*Error)(nil)
+		if !errors.As(err, &apiErr) || apiErr.Parameters == nil || apiErr.Parameters.RetryAfter == 0 || attempt == maxCallAttempts {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(time.Duration(apiErr.Parameters.RetryAfter) * time.Second):
+		}
+	}
+}
+
+type upload struct {
+	field string
+	file  transport.File
+}
+
+func (t *Transport) do(ctx context.Context, method string, params map[string]any, file *upload, out any) error {
+	body := &bytes.Buffer{}
+	contentType := "application/json"
+
+	if file == nil {
+		if err := json.NewEncoder(body).Encode(params); err != nil {
+			return err
+		}
+	} else {
+		form := multipart.NewWriter(body)
+		for key, value := range params {
+			field, ok := value.(string)
+			if !ok {
+				encoded, err := json.Marshal(value)
+				if err != nil {
+					return err
+				}
+				field = string(encoded)
+			}
+			form.WriteField(key, field)
+		}
+
+		part, err := form.CreateFormFile(file.field, file.file.Name)
+		if err != nil {
+			return err
+		}
+		part.Write(file.file.Body)
+		form.Close()
+
+		contentType = form.FormDataContentType()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.methodURL(method), body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		// the error quotes the URL, which contains the token
+		return fmt.Errorf("telegram: %s request failed: %w", method, errors.Unwrap(err))
+	}
+	defer resp.Body.Close()
+
+	result := struct {
+		OK     bool            `json:"ok"`
+		Result json.RawMessage `json:"result"`
+		Error
+	}{}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return fmt.Errorf("telegram: %s: %s", method, resp.Status)
+	}
+	if !result.OK {
+		return &result.Error
+	}
+
+	if out == nil {
+		return nil
+	}
+	return json.Unmarshal(result.Result, out)
+}
+
+// formatText renders the author in bold followed by the text, as bots cannot post under other names.
+func formatText(msg transport.Message, withQuote bool) string {
+	sb := strings.Builder{}
+	sb.WriteString("<b>")
+	sb.WriteString(html.EscapeString(msg.Username))
+	sb.WriteString("</b>")
+
+	body := texts.PlainText(msg.Content)
+	if quote := msg.QuotedReply(); withQuote && quote != "" {
+		body = quote + "\n" + body
+	}
+	if strings.TrimSpace(body) != "" {
+		sb.WriteByte('\n')
+		sb.WriteString(html.EscapeString(body))
+	}
+
+	return sb.String()
+}
+
+func hasText(msg transport.Message) bool {
+	return strings.TrimSpace(texts.PlainText(msg.Content)) != "" || msg.QuotedReply() != ""
+}
+
+// truncate cuts s to n UTF-16 code units, the unit Telegram measures text length in.
+func truncate(s string, n int) string {
+	units := 0
+	for i, r := range s {
+		units += utf16.RuneLen(r)
+		if units > n-1 {
+			return s[:i] + "…"
+		}
+	}
+	return s
+}
+
+func utf16Len(s string) int {
+	units := 0
+	for _, r := range s {
+		units += utf16.RuneLen(r)
+	}
+	return units
+}
+
+func fileMethod(file transport.File, voice bool) (method, field string) {
+	switch {
+	case voice:
+		return "sendVoice", "voice"
+	case file.ContentType == "image/gif":
+		return "sendAnimation", "animation"
+	case strings.HasPrefix(file.ContentType, "image/"):
+		return "sendPhoto", "photo"
+	case strings.HasPrefix(file.ContentType, "video/"):
+		return "sendVideo", "video"
+	case strings.HasPrefix(file.ContentType, "audio/"):
+		return "sendAudio", "audio"
+	}
+	return "sendDocument", "document"
+}
+
+func (t *Transport) sendFile(ctx context.Context, params map[string]any, file transport.File, voice bool) (sent message, err error) {
+	method, field := fileMethod(file, voice)
+
+	send := func(method, field string) error {
+		if file.Body == nil {
+			params[field] = file.URL
+			return t.call(ctx, method, params, nil, &sent)
+		}
+		return t.call(ctx, method, params, &upload{field: field, file: file}, &sent)
+	}
+
+	err = send(method, field)
+	if apiErr := (*Error)(nil); errors.As(err, &apiErr) && apiErr.Code == http.StatusBadRequest && method != "sendDocument" {
+		// photos over the dimension limits and media in unexpected formats are still accepted as documents
+		delete(params, field)
+		err = send("sendDocument", "document")
+	}
+	return sent, err
+}
+
+func (t *Transport) Send(ctx context.Context, endpoint transport.Endpoint, msg transport.Message) (string, error) {
+	// replies to a message split into several Telegram messages refer to its first part
+	replyTo, replyErr := strconv.ParseInt(transport.MessageIDParts(msg.ReplyTo)[0], 10, 64)
+
+	params := func() map[string]any {
+		params := map[string]any{
+			"chat_id":    endpoint.Address,
+			"parse_mode": "HTML",
+		}
+		if replyErr == nil {
+			params["reply_parameters"] = map[string]any{
+				"message_id":                  replyTo,
+				"allow_sending_without_reply": true,
+			}
+		}
+		return params
+	}
+
+	text := formatText(msg, replyErr != nil)
+	messageIDs := []string{}
+
+	// a single file carries the text as caption, so the message stays one Telegram message
+	if len(msg.Files) == 1 && utf16Len(text) <= maxCaptionLength {
+		fileParams := params()
+		fileParams["caption"] = text
+		sent, err := t.sendFile(ctx, fileParams, msg.Files[0], msg.Voice)
+		if err != nil {
+			return "", err
+		}
+		return strconv.FormatInt(sent.MessageID, 10), nil
+	}
+
+	if hasText(msg) || len(msg.Files) == 0 {
+		textParams := params()
+		textParams["text"] = truncate(text, maxTextLength)
+		textParams["link_preview_options"] = map[string]any{"is_disabled": true}
+
+		sent := message{}
+		if err := t.call(ctx, "sendMessage", textParams, nil, &sent); err != nil {
+			return "", err
+		}
+		messageIDs = append(messageIDs, strconv.FormatInt(sent.MessageID, 10))
+	}
+
+	for _, file := range msg.Files {
+		fileParams := params()
+		fileParams["caption"] = "<b>" + html.EscapeString(msg.Username) + "</b>"
+		sent, err := t.sendFile(ctx, fileParams, file, false)
+		if err != nil {
+			if len(messageIDs) > 0 {
+				t.logger.Error("failed to send file to Telegram", "error", err, "file", file.Name)
+				continue
+			}
+			return "", err
+		}
+		messageIDs = append(messageIDs, strconv.FormatInt(sent.MessageID, 10))
+	}
+
+	if len(messageIDs) == 0 {
+		return "", errors.New("empty message")
+	}
+	// messages split into several Telegram messages are identified by all of their IDs
+	return strings.Join(messageIDs, ","), nil
+}
+
+func (t *Transport) Edit(ctx context.Context, endpoint transport.Endpoint, messageID string, msg transport.Message) error {
+	id, err := strconv.ParseInt(transport.MessageIDParts(messageID)[0], 10, 64)
+	if err != nil {
+		return err
+	}
+
+	text := formatText(msg, msg.ReplyTo == "")
+	params := map[string]any{
+		"chat_id":    endpoint.Address,
+		"message_id": id,
+		"parse_mode": "HTML",
+		"text":       truncate(text, maxTextLength),
+	}
+
+	err = t.call(ctx, "editMessageText", params, nil, nil)
+
+	apiErr := (*Error)(nil)
+	if errors.As(err, &apiErr) && strings.Contains(apiErr.Description, "no text in the message") {
+		delete(params, "text")
+		params["caption"] = truncate(text, maxCaptionLength)
+		err = t.call(ctx, "editMessageCaption", params, nil, nil)
+	}
+	if errors.As(err, &apiErr) && strings.Contains(apiErr.Description, "message is not modified") {
+		return nil
+	}
+	return err
+}
+
+func (t *Transport) Delete(ctx context.Context, endpoint transport.Endpoint, messageID string) error {
+	for _, part := range transport.MessageIDParts(messageID) {
+		id, err := strconv.ParseInt(part, 10, 64)
+		if err != nil {
+			return err
+		}
+
+		if err := t.call(ctx, "deleteMessage", map[string]any{
+			"chat_id":    endpoint.Address,
+			"message_id": id,
+		}, nil, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (t *Transport) React(ctx context.Context, endpoint transport.Endpoint, messageID, emoji string) error {
+	id, err := strconv.ParseInt(transport.MessageIDParts(messageID)[0], 10, 64)
+	if err != nil {
+		return err
+	}
+
+	return t.call(ctx, "setMessageReaction", map[string]any{
+		"chat_id":    endpoint.Address,
+		"message_id": id,
+		"reaction":   []map[string]string{{"type": "emoji", "emoji": emoji}},
+	}, nil, nil)
+}
+
+//=:telegram:updates
+
+type user struct {
+	ID        int64  `json:"id"`
+	IsBot     bool   `json:"is_bot"`
+	FirstName string `json:"first_name"`
+	LastName  string `json:"last_name"`
+	Username  string `json:"username"`
+}
+
+type chat struct {
+	ID    int64  `json:"id"`
+	Title string `json:"title"`
+}
+
+type entity struct {
+	Type     string `json:"type"`
+	Offset   int    `json:"offset"`
+	Length   int    `json:"length"`
+	URL      string `json:"url"`
+	Language string `json:"language"`
+}
+
+type media struct {
+	FileID   string   `json:"file_id"`
+	FileName string   `json:"file_name"`
+	MimeType string   `json:"mime_type"`
+	FileSize int      `json:"file_size"`
+	Duration *float64 `json:"duration"`
+}
+
+type message struct {
+	MessageID       int64    `json:"message_id"`
+	From            *user    `json:"from"`
+	Chat            chat     `json:"chat"`
+	Text            string   `json:"text"`
+	Entities        []entity `json:"entities"`
+	Caption         string   `json:"caption"`
+	CaptionEntities []entity `json:"caption_entities"`
+	ReplyToMessage  *message `json:"reply_to_message"`
+	Photo           []media  `json:"photo"`
+	Document        *media   `json:"document"`
+	Video           *media   `json:"video"`
+	Animation       *media   `json:"animation"`
+	Audio           *media   `json:"audio"`
+	Voice           *media   `json:"voice"`
+	Sticker         *struct {
+		media
+		Emoji      string `json:"emoji"`
+		IsAnimated bool   `json:"is_animated"`
+		IsVideo    bool   `json:"is_video"`
+	} `json:"sticker"`
+	ForumTopicCreated *struct{} `json:"forum_topic_created"`
+}
+
+type update struct {
+	UpdateID      int64    `json:"update_id"`
+	Message       *message `json:"message"`
+	EditedMessage *message `json:"edited_message"`
+}
+
+// Listen long polls updates of the chats of the endpoints until ctx is done.
+func (t *Transport) Listen(ctx context.Context, receiver transport.Receiver) error {
+	me := user{}
+	if err := t.call(ctx, "getMe", map[string]any{}, nil, &me); err != nil {
+		return err
+	}
+	t.botID = me.ID
+
+	offset := int64(0)
+	for {
+		updates := []update{}
+		err := t.call(ctx, "getUpdates", map[string]any{
+			"offset":          offset,
+			"timeout":         int(t.cfg.PollTimeout.Seconds()),
+			"allowed_updates": []string{"message", "edited_message"},
+		}, nil, &updates)
+		if ctx.Err() != nil {
+			return nil
+		}
+		if err != nil {
+			t.logger.Error("failed to get Telegram updates", "error", err)
+
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-time.After(reconnectDelay):
+			}
+			continue
+		}
+
+		for _, u := range updates {
+			offset = u.UpdateID + 1
+
+			switch {
+			case u.Message != nil:
+				if incoming, endpoint, ok := t.incoming(ctx, u.Message, true); ok {
+					receiver.ReceiveCreate(endpoint, incoming)
+				}
+			case u.EditedMessage != nil:
+				if incoming, endpoint, ok := t.incoming(ctx, u.EditedMessage, false); ok {
+					receiver.ReceiveUpdate(endpoint, incoming)
+				}
+			}
+		}
+	}
+}
+
+func (t *Transport) incoming(ctx context.Context, m *message, withFiles bool) (transport.Incoming, transport.Endpoint, bool) {
+	endpoint, ok := t.endpoints[strconv.FormatInt(m.Chat.ID, 10)]
+	if !ok || m.From == nil || m.From.ID == t.botID {
+		return transport.Incoming{}, endpoint, false
+	}
+
+	authorID := strconv.FormatInt(m.From.ID, 10)
+	incoming := transport.Incoming{
+		Message: transport.Message{
+			AuthorID: authorID,
+			Username: strings.TrimSpace(m.From.FirstName + " " + m.From.LastName),
+			AvatarURL: texts.ExpandTemplate(t.cfg.AvatarTemplate, map[string]string{
+				"id":       authorID,
+				"username": m.From.Username,
+			}),
+		},
+		ID:     strconv.FormatInt(m.MessageID, 10),
+		Origin: m.Chat.Title,
+	}
+
+	if m.Text != "" {
+		incoming.Content = entitiesToMarkdown(m.Text, m.Entities)
+	} else {
+		incoming.Content = entitiesToMarkdown(m.Caption, m.CaptionEntities)
+	}
+
+	// in forum groups every message of a topic replies to the message creating the topic
+	if m.ReplyToMessage != nil && m.ReplyToMessage.ForumTopicCreated == nil {
+		incoming.ReplyTo = strconv.FormatInt(m.ReplyToMessage.MessageID, 10)
+	}
+
+	if !withFiles {
+		return incoming, endpoint, true
+	}
+
+	attached := []media{}
+	if len(m.Photo) > 0 {
+		// sizes are ordered from the smallest
+		photo := m.Photo[len(m.Photo)-1]
+		photo.MimeType = "image/jpeg"
+		attached = append(attached, withDefaultFileName(photo, "photo.jpg"))
+	}
+	if m.Document != nil {
+		attached = append(attached, withDefaultFileName(*m.Document, "file"))
+	}
+	if m.Video != nil {
+		attached = append(attached, withDefaultFileName(*m.Video, "video.mp4"))
+	}
+	if m.Animation != nil {
+		attached = append(attached, withDefaultFileName(*m.Animation, "animation.mp4"))
+	}
+	if m.Audio != nil {
+		attached = append(attached, withDefaultFileName(*m.Audio, "audio"))
+	}
+	if m.Voice != nil {
+		attached = append(attached, withDefaultFileName(*m.Voice, "voice.ogg"))
+	}
+	if sticker := m.Sticker; sticker != nil {
+		if sticker.IsAnimated || sticker.IsVideo {
+			incoming.Content += sticker.Emoji
+		} else {
+			sticker.MimeType = "image/webp"
+			attached = append(attached, withDefaultFileName(sticker.media, "sticker.webp"))
+		}
+	}
+
+	for _, file := range attached {
+		if file.FileSize > t.cfg.MaxFileSize {
+			incoming.Content += "\n-# " + file.FileName + " is too large to bridge"
+			continue
+		}
+
+		body, err := t.download(ctx, file.FileID)
+		if errors.Is(err, errFileTooLarge) {
+			incoming.Content += "\n-# " + file.FileName + " is too large to bridge"
+			continue
+		} else if err != nil {
+			t.logger.Error("failed to download Telegram file", "error", err, "file", file.FileName)
+			continue
+		}
+
+		incoming.Files = append(incoming.Files, transport.File{
+			Name:         file.FileName,
+			ContentType:  file.MimeType,
+			Size:         len(body),
+			Body:         body,
+			DurationSecs: file.Duration,
+		})
+	}
+
+	if strings.TrimSpace(incoming.Content) == "" && len(incoming.Files) == 0 {
+		return incoming, endpoint, false
+	}
+	return incoming, endpoint, true
+}
+
+func withDefaultFileName(file media, name string) media {
+	if file.FileName == "" {
+		file.FileName = name
+	}
+	return file
+}
+
+// download fetches a file through the Bot API. The file URL contains the bot token, so files are
+// always handed over with their body and without URL.
+func (t *Transport) download(ctx context.Context, fileID string) ([]byte, error) {
+	file := struct {
+		FilePath string `json:"file_path"`
+	}{}
+	if err := t.call(ctx, "getFile", map[string]any{"file_id": fileID}, nil, &file); err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(t.cfg.BaseURL, "/")+"/file/bot"+t.cfg.Token+"/"+file.FilePath, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return nil, errors.New("telegram: file download failed")
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("telegram: file download failed: %s", resp.Status)
+	}
+	// the size is missing from file objects of some messages, so it is only known once downloaded
+	body, err := io.ReadAll(io.LimitReader(resp.Body, int64(t.cfg.MaxFileSize)+1))
+	if err != nil {
+		return nil, err
+	} else if len(body) > t.cfg.MaxFileSize {
+		return nil, errFileTooLarge
+	}
+	return body, nil
+}
+
+// entitiesToMarkdown renders formatting entities of a Telegram message as Discord markdown.
+func entitiesToMarkdown(text string, entities []entity) string {
+	if len(entities) == 0 {
+		return text
+	}
+
+	markers := func(e entity) (open, close string) {
+		switch e.Type {
+		case "bold":
+			return "**", "**"
+		case "italic":
+			return "*", "*"
+		case "underline":
+			return "__", "__"
+		case "strikethrough":
+			return "~~", "~~"
+		case "spoiler":
+			return "||", "||"
+		case "code":
+			return "`", "`"
+		case "pre":
+			return "```" + e.Language + "\n", "\n```"
+		case "text_link":
+			return "[", "](" + e.URL + ")"
+		}
+		return "", ""
+	}
+
+	// outer entities open first and close last
+	sorted := append([]entity(nil), entities...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if sorted[i].Offset != sorted[j].Offset {
+			return sorted[i].Offset < sorted[j].Offset
+		}
+		return sorted[i].Length > sorted[j].Length
+	})
+
+	units := utf16.Encode([]rune(text))
+	sb := strings.Builder{}
+
+	for pos := 0; pos <= len(units); pos++ {
+		for i := len(sorted) - 1; i >= 0; i-- {
+			if e := sorted[i]; e.Length > 0 && e.Offset+e.Length == pos {
+				_, close := markers(e)
+				sb.WriteString(close)
+			}
+		}
+		for _, e := range sorted {
+			if e.Length > 0 && e.Offset == pos {
+				open, _ := markers(e)
+				sb.WriteString(open)
+			}
+		}
+
+		if pos == len(units) {
+			break
+		}
+		// a surrogate pair is decoded as a whole, markers never fall between its halves
+		if utf16.IsSurrogate(rune(units[pos])) && pos+1 < len(units) {
+			sb.WriteRune(utf16.DecodeRune(rune(units[pos]), rune(units[pos+1])))
+			pos++
+		} else {
+			sb.WriteRune(rune(units[pos]))
+		}
+	}
+
+	return sb.String()
+}
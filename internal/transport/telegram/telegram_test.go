@@ -0,0 +1,328 @@
+package telegram
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mandriota/bridge-discord-bot/internal/transport"
+)
+
+const token = "123:secret"
+
+type call struct {
+	method string
+	params map[string]any
+	file   string
+}
+
+// botAPI is a stand-in for the Bot API server, numbering sent messages from 1.
+type botAPI struct {
+	t      *testing.T
+	server *httptest.Server
+
+	mu      sync.Mutex
+	calls   []call
+	nextID  int64
+	updates chan []update
+	files   map[string]string
+}
+
+func newBotAPI(t *testing.T) *botAPI {
+	api := &botAPI{t: t, updates: make(chan []update, 10), files: map[string]string{}}
+	api.server = httptest.NewServer(http.HandlerFunc(api.serve))
+	t.Cleanup(api.server.Close)
+	return api
+}
+
+func (api *botAPI) serve(w http.ResponseWriter, r *http.Request) {
+	if path, ok := strings.CutPrefix(r.URL.Path, "/file/bot"+token+"/"); ok {
+		io.WriteString(w, api.files[path])
+		return
+	}
+
+	method, ok := strings.CutPrefix(r.URL.Path, "/bot"+token+"/")
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	c := call{method: method, params: map[string]any{}}
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/") {
+		if err := r.ParseMultipartForm(1 << 20); err != nil {
+			api.t.Error(err)
+		}
+		for key, values := range r.MultipartForm.Value {
+			c.params[key] = values[0]
+		}
+		for _, headers := range r.MultipartForm.File {
+			c.file = headers[0].Filename
+		}
+	} else if err := json.NewDecoder(r.Body).Decode(&c.params); err != nil {
+		api.t.Error(err)
+	}
+
+	result := any(true)
+	switch method {
+	case "getMe":
+		result = user{ID: 99, IsBot: true}
+	case "getUpdates":
+		select {
+		case updates := <-api.updates:
+			result = updates
+		case <-time.After(100 * time.Millisecond):
+			result = []update{}
+		}
+	case "getFile":
+		result = map[string]string{"file_path": c.params["file_id"].(string)}
+	case "sendMessage", "sendPhoto", "sendDocument", "sendVoice":
+		api.mu.Lock()
+		api.nextID++
+		result = message{MessageID: api.nextID}
+		api.mu.Unlock()
+	}
+
+	if method != "getUpdates" && method != "getMe" && method != "getFile" {
+		api.mu.Lock()
+		api.calls = append(api.calls, c)
+		api.mu.Unlock()
+	}
+
+	json.NewEncoder(w).Encode(map[string]any{"ok": true, "result": result})
+}
+
+func (api *botAPI) takeCalls() []call {
+	api.mu.Lock()
+	defer api.mu.Unlock()
+
+	calls := api.calls
+	api.calls = nil
+	return calls
+}
+
+func newTransport(api *botAPI) (*Transport, transport.Endpoint) {
+	endpoint := transport.Endpoint{ChannelID: transport.NewID(), Transport: Name, Address: "-100"}
+	return New(Config{
+		BaseURL:        api.server.URL,
+		Token:          token,
+		PollTimeout:    time.Second,
+		MaxFileSize:    8,
+		AvatarTemplate: "https://avatars.test/{username}",
+	}, []transport.Endpoint{endpoint}, slog.New(slog.NewTextHandler(io.Discard, nil))), endpoint
+}
+
+func TestSend(t *testing.T) {
+	api := newBotAPI(t)
+	tr, endpoint := newTransport(api)
+	ctx := context.Background()
+
+	id, err := tr.Send(ctx, endpoint, transport.Message{Username: "Alice <3", Content: "**hello** world"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id != "1" {
+		t.Errorf("Send returned ID %q", id)
+	}
+
+	calls := api.takeCalls()
+	if len(calls) != 1 || calls[0].method != "sendMessage" || calls[0].params["text"] != "<b>Alice &lt;3</b>\nhello world" || calls[0].params["chat_id"] != "-100" {
+		t.Errorf("sent %+v", calls)
+	}
+}
+
+func TestSendReply(t *testing.T) {
+	api := newBotAPI(t)
+	tr, endpoint := newTransport(api)
+
+	// a reply to a split message refers to its first part, and the quote is left to Telegram
+	if _, err := tr.Send(context.Background(), endpoint, transport.Message{
+		Username: "Bob",
+		Header:   "-# > **Alice** hello",
+		Content:  "hi",
+		ReplyTo:  "7,8",
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	calls := api.takeCalls()
+	replyParameters, _ := calls[0].params["reply_parameters"].(map[string]any)
+	if replyParameters["message_id"] != float64(7) || calls[0].params["text"] != "<b>Bob</b>\nhi" {
+		t.Errorf("sent %+v", calls[0].params)
+	}
+
+	// without the replied message on Telegram, the quote stands in for it
+	if _, err := tr.Send(context.Background(), endpoint, transport.Message{
+		Username: "Bob",
+		Header:   "-# > **Alice** hello",
+		Content:  "hi",
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	calls = api.takeCalls()
+	if _, ok := calls[0].params["reply_parameters"]; ok || calls[0].params["text"] != "<b>Bob</b>\n&gt; Alice hello\nhi" {
+		t.Errorf("sent %+v", calls[0].params)
+	}
+}
+
+func TestSendSplit(t *testing.T) {
+	api := newBotAPI(t)
+	tr, endpoint := newTransport(api)
+	ctx := context.Background()
+
+	id, err := tr.Send(ctx, endpoint, transport.Message{
+		Username: "Alice",
+		Content:  "two files",
+		Files: []transport.File{
+			{Name: "a.png", ContentType: "image/png", Body: []byte("png")},
+			{Name: "b.txt", ContentType: "text/plain", Body: []byte("txt")},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id != "1,2,3" {
+		t.Fatalf("Send returned ID %q", id)
+	}
+	if parts := transport.MessageIDParts(id); len(parts) != 3 || parts[0] != "1" {
+		t.Errorf("ID %q splits into %q", id, parts)
+	}
+
+	calls := api.takeCalls()
+	if len(calls) != 3 || calls[1].method != "sendPhoto" || calls[1].file != "a.png" || calls[2].method != "sendDocument" || calls[2].file != "b.txt" {
+		t.Errorf("sent %+v", calls)
+	}
+
+	if err := tr.Edit(ctx, endpoint, id, transport.Message{Username: "Alice", Content: "edited"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := tr.React(ctx, endpoint, id, "👍"); err != nil {
+		t.Fatal(err)
+	}
+	if err := tr.Delete(ctx, endpoint, id); err != nil {
+		t.Fatal(err)
+	}
+
+	calls = api.takeCalls()
+	got := []string{}
+	for _, c := range calls {
+		got = append(got, c.method+" "+strings.TrimSuffix(strings.TrimPrefix(mustJSON(c.params["message_id"]), "\""), "\""))
+	}
+	want := []string{"editMessageText 1", "setMessageReaction 1", "deleteMessage 1", "deleteMessage 2", "deleteMessage 3"}
+	if strings.Join(got, "; ") != strings.Join(want, "; ") {
+		t.Errorf("called %q, want %q", got, want)
+	}
+	if calls[0].params["text"] != "<b>Alice</b>\nedited" {
+		t.Errorf("edited to %q", calls[0].params["text"])
+	}
+}
+
+func TestSendSingleFile(t *testing.T) {
+	api := newBotAPI(t)
+	tr, endpoint := newTransport(api)
+
+	id, err := tr.Send(context.Background(), endpoint, transport.Message{
+		Username: "Alice",
+		Content:  "caption",
+		Files:    []transport.File{{Name: "voice.ogg", ContentType: "audio/ogg", Body: []byte("ogg")}},
+		Voice:    true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	calls := api.takeCalls()
+	if id != "1" || len(calls) != 1 || calls[0].method != "sendVoice" || calls[0].params["caption"] != "<b>Alice</b>\ncaption" {
+		t.Errorf("sent %q as %+v", id, calls)
+	}
+}
+
+type received struct {
+	kind     string
+	endpoint transport.Endpoint
+	msg      transport.Incoming
+}
+
+type receiver chan received
+
+func (r receiver) ReceiveCreate(endpoint transport.Endpoint, msg transport.Incoming) {
+	r <- received{"create", endpoint, msg}
+}
+
+func (r receiver) ReceiveUpdate(endpoint transport.Endpoint, msg transport.Incoming) {
+	r <- received{"update", endpoint, msg}
+}
+
+func (r receiver) ReceiveDelete(endpoint transport.Endpoint, messageID string) {
+	r <- received{"delete", endpoint, transport.Incoming{ID: messageID}}
+}
+
+func TestListen(t *testing.T) {
+	api := newBotAPI(t)
+	tr, endpoint := newTransport(api)
+	api.files["small"] = "12345678"
+	api.files["large"] = "123456789"
+
+	from := &user{ID: 5, FirstName: "Carol", LastName: "Smith", Username: "carol"}
+	group := chat{ID: -100, Title: "Group"}
+	api.updates <- []update{
+		{UpdateID: 1, Message: &message{MessageID: 10, From: from, Chat: group, Text: "bold text", Entities: []entity{{Type: "bold", Offset: 0, Length: 4}}}},
+		{UpdateID: 2, Message: &message{MessageID: 11, From: from, Chat: chat{ID: -200}, Text: "other chat"}},
+		{UpdateID: 3, Message: &message{MessageID: 12, From: &user{ID: 99, IsBot: true}, Chat: group, Text: "own message"}},
+		{UpdateID: 4, Message: &message{MessageID: 13, From: from, Chat: group, Text: "reply", ReplyToMessage: &message{MessageID: 2}}},
+		{UpdateID: 5, EditedMessage: &message{MessageID: 10, From: from, Chat: group, Text: "edited"}},
+		{UpdateID: 6, Message: &message{MessageID: 14, From: from, Chat: group, Caption: "files", Document: &media{FileID: "small", FileName: "small.bin"}, Voice: &media{FileID: "large"}}},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	r := make(receiver, 10)
+	go tr.Listen(ctx, r)
+
+	next := func() received {
+		t.Helper()
+		select {
+		case got := <-r:
+			if got.endpoint != endpoint {
+				t.Errorf("received for endpoint %+v", got.endpoint)
+			}
+			return got
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for message")
+			return received{}
+		}
+	}
+
+	got := next()
+	if got.kind != "create" || got.msg.ID != "10" || got.msg.Content != "**bold** text" || got.msg.Username != "Carol Smith" || got.msg.AuthorID != "5" || got.msg.AvatarURL != "https://avatars.test/carol" || got.msg.Origin != "Group" {
+		t.Errorf("received %+v", got)
+	}
+
+	got = next()
+	if got.kind != "create" || got.msg.ID != "13" || got.msg.ReplyTo != "2" {
+		t.Errorf("received %+v", got)
+	}
+
+	got = next()
+	if got.kind != "update" || got.msg.ID != "10" || got.msg.Content != "edited" {
+		t.Errorf("received %+v", got)
+	}
+
+	// the voice message has no size, so it turns out too large only once downloaded
+	got = next()
+	if got.kind != "create" || len(got.msg.Files) != 1 || string(got.msg.Files[0].Body) != "12345678" || got.msg.Content != "files\n-# voice.ogg is too large to bridge" {
+		t.Errorf("received %+v", got)
+	}
+}
+
+func mustJSON(v any) string {
+	data, _ := json.Marshal(v)
+	return string(data)
+}
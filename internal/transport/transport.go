@@ -0,0 +1,110 @@
+package transport
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/disgoorg/snowflake/v2"
+	"github.com/mandriota/bridge-discord-bot/internal/texts"
+)
+
+// Discord is the name of the transport delivering to Discord channels through webhooks.
+const Discord = "discord"
+
+var ErrUnsupported = errors.New("operation not supported by transport")
+
+// Endpoint is a member of a virtual channel. Endpoints on other platforms
+// are identified in the bridge by a generated channel ID.
+type Endpoint struct {
+	ChannelID snowflake.ID
+	Transport string
+	Address   string
+}
+
+// Message is a platform-neutral message. Header and Content are Discord flavored markdown.
+type Message struct {
+	// AuthorID identifies the author across messages, for transports that show authors as separate users.
+	AuthorID  string
+	Username  string
+	AvatarURL string
+	Header    string
+	Content   string
+	Files     []File
+	// ReplyTo is the ID of the replied message on the platform of the endpoint, if known.
+	ReplyTo string
+	// Voice marks the only file as a voice message with duration and waveform.
+	Voice bool
+}
+
+// QuotedReply returns the quote of the replied message from the reply header as plain text, or "".
+func (m Message) QuotedReply() string {
+	for _, line := range strings.Split(m.Header, "\n") {
+		if strings.HasPrefix(line, "-# > ") {
+			return texts.PlainText(line)
+		}
+	}
+	return ""
+}
+
+type File struct {
+	Name        string
+	Description string
+	ContentType string
+	URL         string
+	Size        int
+	Body        []byte
+
+	DurationSecs *float64
+	Waveform     *string
+}
+
+// Incoming is a message a transport received from its platform.
+type Incoming struct {
+	Message
+	ID string
+	// Origin names the server or network the message came from.
+	Origin string
+}
+
+// MessageIDParts splits the ID of a message a transport sent as several messages on its platform,
+// which transports return as the IDs of those messages joined by commas.
+func MessageIDParts(messageID string) []string {
+	return strings.Split(messageID, ",")
+}
+
+type Transport interface {
+	Name() string
+	Send(ctx context.Context, endpoint Endpoint, msg Message) (messageID string, err error)
+	Edit(ctx context.Context, endpoint Endpoint, messageID string, msg Message) error
+	Delete(ctx context.Context, endpoint Endpoint, messageID string) error
+	React(ctx context.Context, endpoint Endpoint, messageID, emoji string) error
+}
+
+// Receiver accepts messages received by transports.
+type Receiver interface {
+	ReceiveCreate(endpoint Endpoint, msg Incoming)
+	ReceiveUpdate(endpoint Endpoint, msg Incoming)
+	ReceiveDelete(endpoint Endpoint, messageID string)
+}
+
+// Listener is implemented by transports that receive messages from their platform.
+// Listen blocks until ctx is done or the connection fails permanently.
+type Listener interface {
+	Listen(ctx context.Context, receiver Receiver) error
+}
+
+type Registry map[string]Transport
+
+func (r Registry) Register(t Transport) {
+	r[t.Name()] = t
+}
+
+var idSequence atomic.Uint64
+
+// NewID generates a snowflake for channels and messages of endpoints on other platforms.
+func NewID() snowflake.ID {
+	return snowflake.New(time.Now()) | snowflake.ID(idSequence.Add(1)&(1<<22-1))
+}
@@ -2,36 +2,148 @@ package main
 
 import (
 	"context"
+	"database/sql"
 	"log/slog"
 	"net/http"
 	"net/url"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
+	"time"
 
 	"github.com/disgoorg/disgo"
 	"github.com/disgoorg/disgo/bot"
 	"github.com/disgoorg/disgo/gateway"
 	"github.com/disgoorg/disgo/rest"
+	"github.com/disgoorg/snowflake/v2"
+	"github.com/mandriota/bridge-discord-bot/internal/cache"
 	"github.com/mandriota/bridge-discord-bot/internal/config"
 	"github.com/mandriota/bridge-discord-bot/internal/handler"
+	"github.com/mandriota/bridge-discord-bot/internal/ratelimit"
 	"github.com/mandriota/bridge-discord-bot/internal/repository"
+	"github.com/mandriota/bridge-discord-bot/internal/sequencer"
+	"github.com/mandriota/bridge-discord-bot/internal/sink"
+	"github.com/mandriota/bridge-discord-bot/internal/stream"
+	"github.com/mandriota/bridge-discord-bot/internal/transport"
+	"github.com/mandriota/bridge-discord-bot/internal/transport/api"
+	"github.com/mandriota/bridge-discord-bot/internal/transport/federation"
+	"github.com/mandriota/bridge-discord-bot/internal/transport/feed"
+	"github.com/mandriota/bridge-discord-bot/internal/transport/hook"
+	"github.com/mandriota/bridge-discord-bot/internal/transport/irc"
+	"github.com/mandriota/bridge-discord-bot/internal/transport/matrix"
+	"github.com/mandriota/bridge-discord-bot/internal/transport/slack"
+	"github.com/mandriota/bridge-discord-bot/internal/transport/telegram"
 	_ "github.com/mattn/go-sqlite3"
 )
 
 func main() {
 	ctx := context.Background()
 	cfg := config.Config{
-		DBPath:            "messages.db",
-		BotToken:          os.Getenv("BRIDGE_BOT_TOKEN"),
-		ProxyURL:          os.Getenv("PROXY_URL"),
-		ForwarderHookName: "Bridge",
-		MaxAttachmentSize: (1 << 20) * 10,
+		DBPath:              "messages.db",
+		BotToken:            os.Getenv("BRIDGE_BOT_TOKEN"),
+		ProxyURL:            os.Getenv("PROXY_URL"),
+		ForwarderHookName:   "Bridge",
+		DefaultNameTemplate: "{display_name}",
+		MaxAttachmentSize:   (1 << 20) * 10,
+		FanoutWorkers:       8,
+		EditDebounce:        750 * time.Millisecond,
+
+		MaxRevisionsPerMessage: 20,
+
+		AuthorRateLimitBurst:   5,
+		AuthorRateLimitRefill:  2 * time.Second,
+		ChannelRateLimitBurst:  20,
+		ChannelRateLimitRefill: 500 * time.Millisecond,
+		RateLimitNoticeEmoji:   "🐢",
+
+		EchoCacheSize:          10000,
+		EchoCacheTTL:           5 * time.Minute,
+		EchoCacheStatsInterval: time.Hour,
+
+		PinsFromOwnerOnly:   os.Getenv("BRIDGE_PINS_FROM_OWNER_ONLY") != "",
+		TypingRelayInterval: 8 * time.Second,
+
+		SinkWorkers:     4,
+		SinkMaxAttempts: 5,
+		SinkRetryDelay:  2 * time.Second,
+
+		APIListenAddr: os.Getenv("BRIDGE_API_LISTEN_ADDR"),
+		// base64 encoded attachments grow by a third
+		APIMaxBodySize: (1<<20)*10*4/3 + 1<<20,
+		// events buffered per event stream subscriber before it is disconnected
+		StreamBufferSize: 256,
+
+		FeedPollInterval:      10 * time.Minute,
+		FeedMaxSize:           (1 << 20) * 5,
+		FeedMaxEntriesPerPoll: 5,
+		FeedSummaryLength:     300,
+
+		IRCServer:         os.Getenv("BRIDGE_IRC_SERVER"),
+		IRCTLS:            os.Getenv("BRIDGE_IRC_TLS") != "",
+		IRCNick:           "bridge",
+		IRCPassword:       os.Getenv("BRIDGE_IRC_PASSWORD"),
+		IRCChannels:       parseKeyValues(os.Getenv("BRIDGE_IRC_CHANNELS")),
+		IRCAvatarTemplate: "https://api.dicebear.com/9.x/identicon/png?seed={nick}",
+
+		MatrixHomeserverURL:  os.Getenv("BRIDGE_MATRIX_HOMESERVER_URL"),
+		MatrixServerName:     os.Getenv("BRIDGE_MATRIX_SERVER_NAME"),
+		MatrixListenAddr:     ":29330",
+		MatrixASToken:        os.Getenv("BRIDGE_MATRIX_AS_TOKEN"),
+		MatrixHSToken:        os.Getenv("BRIDGE_MATRIX_HS_TOKEN"),
+		MatrixBotLocalpart:   "bridge",
+		MatrixGhostPrefix:    "bridge_",
+		MatrixRooms:          parseKeyValues(os.Getenv("BRIDGE_MATRIX_ROOMS")),
+		MatrixAvatarTemplate: "https://api.dicebear.com/9.x/identicon/png?seed=matrix{localpart}",
+
+		TelegramAPIURL:         "https://api.telegram.org",
+		TelegramToken:          os.Getenv("BRIDGE_TELEGRAM_TOKEN"),
+		TelegramPollTimeout:    50 * time.Second,
+		TelegramChats:          parseKeyValues(os.Getenv("BRIDGE_TELEGRAM_CHATS")),
+		TelegramAvatarTemplate: "https://api.dicebear.com/9.x/identicon/png?seed=telegram{id}",
+
+		SlackAPIURL:   "https://slack.com/api",
+		SlackAppToken: os.Getenv("BRIDGE_SLACK_APP_TOKEN"),
+		SlackBotToken: os.Getenv("BRIDGE_SLACK_BOT_TOKEN"),
+		SlackChannels: parseKeyValues(os.Getenv("BRIDGE_SLACK_CHANNELS")),
+
+		FederationInstanceName: os.Getenv("BRIDGE_FEDERATION_INSTANCE_NAME"),
+		FederationListenAddr:   ":29340",
+		FederationPeerURLs:     parseKeyValues(os.Getenv("BRIDGE_FEDERATION_PEER_URLS")),
+		FederationPeerSecrets:  parseKeyValues(os.Getenv("BRIDGE_FEDERATION_PEER_SECRETS")),
+		FederationChannels:     parseList(os.Getenv("BRIDGE_FEDERATION_CHANNELS")),
+		// a message carries up to 10 base64 encoded attachments
+		FederationMaxBodySize: (1<<20)*10*10*4/3 + 1<<20,
+	}
+	if ircNick := os.Getenv("BRIDGE_IRC_NICK"); ircNick != "" {
+		cfg.IRCNick = ircNick
+	}
+	if matrixListenAddr := os.Getenv("BRIDGE_MATRIX_LISTEN_ADDR"); matrixListenAddr != "" {
+		cfg.MatrixListenAddr = matrixListenAddr
+	}
+	if matrixAvatarTemplate := os.Getenv("BRIDGE_MATRIX_AVATAR_TEMPLATE"); matrixAvatarTemplate != "" {
+		cfg.MatrixAvatarTemplate = matrixAvatarTemplate
+	}
+	if telegramAPIURL := os.Getenv("BRIDGE_TELEGRAM_API_URL"); telegramAPIURL != "" {
+		cfg.TelegramAPIURL = telegramAPIURL
+	}
+	if slackAPIURL := os.Getenv("BRIDGE_SLACK_API_URL"); slackAPIURL != "" {
+		cfg.SlackAPIURL = slackAPIURL
+	}
+	if federationListenAddr := os.Getenv("BRIDGE_FEDERATION_LISTEN_ADDR"); federationListenAddr != "" {
+		cfg.FederationListenAddr = federationListenAddr
 	}
 
 	eh := handler.EventHandler{
-		Ctx: ctx,
-		Cfg: cfg,
+		Ctx:            ctx,
+		Cfg:            cfg,
+		AuthorLimiter:  ratelimit.New(cfg.AuthorRateLimitBurst, cfg.AuthorRateLimitRefill),
+		ChannelLimiter: ratelimit.New(cfg.ChannelRateLimitBurst, cfg.ChannelRateLimitRefill),
+		EchoCache:      cache.NewTTL[handler.Echo](cfg.EchoCacheSize, cfg.EchoCacheTTL),
+		Fanout:         sequencer.New[snowflake.ID](cfg.FanoutWorkers),
+		Edits:          sequencer.NewDebouncer[snowflake.ID](cfg.EditDebounce, cfg.FanoutWorkers),
+		Sinks:          sink.New(ctx, cfg.SinkWorkers, cfg.SinkMaxAttempts, cfg.SinkRetryDelay, slog.Default()),
+		Stream:         stream.New(cfg.StreamBufferSize),
 	}
 
 	slog.Info("initializating database...")
@@ -62,10 +174,12 @@ func main() {
 
 	client, err := disgo.New(cfg.BotToken,
 		bot.WithRestClientConfigOpts(rest.WithHTTPClient(httpClient)),
+		bot.WithEventManagerConfigOpts(bot.WithGatewayHandlers(handler.GatewayHandlers())),
 		bot.WithGatewayConfigOpts(
 			gateway.WithIntents(
 				gateway.IntentGuilds,
 				gateway.IntentGuildMessages,
+				gateway.IntentGuildMessageTyping,
 				gateway.IntentGuildExpressions,
 				gateway.IntentMessageContent,
 			),
@@ -74,6 +188,9 @@ func main() {
 		bot.WithEventListenerFunc(eh.OnGuildMessageCreate),
 		bot.WithEventListenerFunc(eh.OnGuildMessageUpdate),
 		bot.WithEventListenerFunc(eh.OnGuildMessageDelete),
+		bot.WithEventListenerFunc(eh.OnGuildMessageDeleteBulk),
+		bot.WithEventListenerFunc(eh.OnGuildChannelPinsUpdate),
+		bot.WithEventListenerFunc(eh.OnGuildMemberTypingStart),
 	)
 	if err != nil {
 		slog.Error("failed to create client", "error", err)
@@ -81,7 +198,111 @@ func main() {
 	}
 	defer client.Close(ctx)
 
+	eh.Client = client
 	eh.Rest = client.Rest()
+	eh.Transports = transport.Registry{}
+	eh.Transports.Register(hook.New(client.Rest(), client.ApplicationID(), cfg.ForwarderHookName, client.Logger()))
+	eh.Transports.Register(api.Transport{})
+	eh.Transports.Register(feed.Transport{})
+
+	if cfg.IRCServer != "" {
+		ircEndpoints, err := linkEndpoints(ctx, eh.DB, irc.Name, cfg.IRCChannels)
+		if err != nil {
+			slog.Error("failed to link IRC channels", "error", err)
+			return
+		}
+
+		eh.Transports.Register(irc.New(irc.Config{
+			Server:         cfg.IRCServer,
+			TLS:            cfg.IRCTLS,
+			Nick:           cfg.IRCNick,
+			Password:       cfg.IRCPassword,
+			AvatarTemplate: cfg.IRCAvatarTemplate,
+		}, ircEndpoints, client.Logger()))
+	}
+
+	if cfg.MatrixHomeserverURL != "" {
+		matrixEndpoints, err := linkEndpoints(ctx, eh.DB, matrix.Name, cfg.MatrixRooms)
+		if err != nil {
+			slog.Error("failed to link Matrix rooms", "error", err)
+			return
+		}
+
+		eh.Transports.Register(matrix.New(matrix.Config{
+			HomeserverURL:  cfg.MatrixHomeserverURL,
+			ServerName:     cfg.MatrixServerName,
+			ListenAddr:     cfg.MatrixListenAddr,
+			ASToken:        cfg.MatrixASToken,
+			HSToken:        cfg.MatrixHSToken,
+			BotLocalpart:   cfg.MatrixBotLocalpart,
+			GhostPrefix:    cfg.MatrixGhostPrefix,
+			MaxFileSize:    cfg.MaxAttachmentSize,
+			AvatarTemplate: cfg.MatrixAvatarTemplate,
+		}, matrixEndpoints, client.Logger()))
+	}
+
+	if cfg.TelegramToken != "" {
+		telegramEndpoints, err := linkEndpoints(ctx, eh.DB, telegram.Name, cfg.TelegramChats)
+		if err != nil {
+			slog.Error("failed to link Telegram chats", "error", err)
+			return
+		}
+
+		eh.Transports.Register(telegram.New(telegram.Config{
+			BaseURL:        cfg.TelegramAPIURL,
+			Token:          cfg.TelegramToken,
+			PollTimeout:    cfg.TelegramPollTimeout,
+			MaxFileSize:    cfg.MaxAttachmentSize,
+			AvatarTemplate: cfg.TelegramAvatarTemplate,
+		}, telegramEndpoints, client.Logger()))
+	}
+
+	if cfg.SlackAppToken != "" && cfg.SlackBotToken != "" {
+		slackEndpoints, err := linkEndpoints(ctx, eh.DB, slack.Name, cfg.SlackChannels)
+		if err != nil {
+			slog.Error("failed to link Slack channels", "error", err)
+			return
+		}
+
+		eh.Transports.Register(slack.New(slack.Config{
+			APIURL:      cfg.SlackAPIURL,
+			AppToken:    cfg.SlackAppToken,
+			BotToken:    cfg.SlackBotToken,
+			MaxFileSize: cfg.MaxAttachmentSize,
+		}, slackEndpoints, client.Logger()))
+	}
+
+	if cfg.FederationInstanceName != "" {
+		// channels are given as peer/key, the key is only exchanged hashed
+		federationChannels := map[string]string{}
+		for _, channel := range cfg.FederationChannels {
+			if peerName, virtualChannelKey, ok := strings.Cut(channel, "/"); ok {
+				federationChannels[federation.Address(peerName, repository.HashVirtualChannelKey(virtualChannelKey))] = virtualChannelKey
+			}
+		}
+
+		federationEndpoints, err := linkEndpoints(ctx, eh.DB, federation.Name, federationChannels)
+		if err != nil {
+			slog.Error("failed to link federated channels", "error", err)
+			return
+		}
+
+		peers := map[string]federation.Peer{}
+		for peerName, peerURL := range cfg.FederationPeerURLs {
+			if cfg.FederationPeerSecrets[peerName] == "" {
+				slog.Error("federation peer has no secret", "peer", peerName)
+				continue
+			}
+			peers[peerName] = federation.Peer{URL: peerURL, Secret: cfg.FederationPeerSecrets[peerName]}
+		}
+
+		eh.Transports.Register(federation.New(federation.Config{
+			InstanceName: cfg.FederationInstanceName,
+			ListenAddr:   cfg.FederationListenAddr,
+			Peers:        peers,
+			MaxBodySize:  cfg.FederationMaxBodySize,
+		}, federationEndpoints, client.Logger()))
+	}
 
 	slog.Info("opening gateway...")
 
@@ -97,5 +318,92 @@ func main() {
 	slog.Info("listening...")
 
 	notifyCtx, _ := signal.NotifyContext(ctx, syscall.SIGINT, syscall.SIGTERM)
+
+	for _, t := range eh.Transports {
+		if listener, ok := t.(transport.Listener); ok {
+			go func() {
+				if err := listener.Listen(notifyCtx, &eh); err != nil {
+					slog.Error("transport stopped listening", "transport", t.Name(), "error", err)
+				}
+			}()
+		}
+	}
+
+	go eh.PollFeeds(notifyCtx)
+	go func() {
+		ticker := time.NewTicker(cfg.EchoCacheStatsInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-notifyCtx.Done():
+				return
+			case <-ticker.C:
+				logEchoCacheStats(eh.EchoCache)
+			}
+		}
+	}()
+
+	if cfg.APIListenAddr != "" {
+		go func() {
+			if err := eh.ServeAPI(notifyCtx); err != nil {
+				slog.Error("HTTP API stopped", "error", err)
+			}
+		}()
+	}
+
 	<-notifyCtx.Done()
+
+	slog.Info("waiting for pending forwards...")
+	eh.Edits.Flush()
+	eh.Fanout.Wait()
+	eh.Sinks.Wait()
+
+	logEchoCacheStats(eh.EchoCache)
+}
+
+func logEchoCacheStats(echoCache *cache.TTL[handler.Echo]) {
+	echoCacheStats := echoCache.Stats()
+	slog.Info("echo cache stats",
+		"size", echoCache.Len(),
+		"hits", echoCacheStats.Hits,
+		"misses", echoCacheStats.Misses,
+		"evictions", echoCacheStats.Evictions,
+		"expirations", echoCacheStats.Expirations,
+	)
+}
+
+// parseKeyValues parses comma separated key=value pairs, as in "#go=key1,#rust=key2".
+func parseKeyValues(s string) map[string]string {
+	pairs := map[string]string{}
+	for _, pair := range strings.Split(s, ",") {
+		if key, value, ok := strings.Cut(strings.TrimSpace(pair), "="); ok {
+			pairs[key] = value
+		}
+	}
+	return pairs
+}
+
+// parseList parses comma separated values, as in "beta/key1,gamma/key2".
+func parseList(s string) []string {
+	values := []string{}
+	for _, value := range strings.Split(s, ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+// linkEndpoints links endpoints of another platform, given as address to virtual channel key, to their virtual channels.
+func linkEndpoints(ctx context.Context, db *sql.DB, transportName string, virtualChannelKeys map[string]string) ([]transport.Endpoint, error) {
+	endpoints := []transport.Endpoint{}
+	for address, virtualChannelKey := range virtualChannelKeys {
+		endpoint, err := repository.LinkEndpoint(ctx, db, repository.HashVirtualChannelKey(virtualChannelKey), transportName, address, transportName+" "+address)
+		if err != nil {
+			return nil, err
+		}
+		endpoints = append(endpoints, endpoint)
+	}
+	return endpoints, nil
 }